@@ -0,0 +1,208 @@
+// Package agreement renders loan agreements and the agreement letters of the
+// individual investments. The wording comes from Go text/templates per loan
+// product; the rendered text is laid out as a PDF.
+package agreement
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"loan-engine/model"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Data is what an agreement template is executed with.
+type Data struct {
+	Loan *model.Loan
+	// Date is the date the agreement is drawn up; the schedule starts from it.
+	Date time.Time
+	// Schedule is the projected repayment schedule.
+	Schedule []model.Installment
+	// Investors are the active investments funding the loan.
+	Investors []model.Investment
+	// TotalRepayment is the sum of all scheduled installments.
+	TotalRepayment model.Money
+}
+
+// NewData prepares the template data of the loan, projecting its repayment
+// schedule from date.
+func NewData(l *model.Loan, date time.Time) (Data, error) {
+	schedule, err := model.GenerateSchedule(l, date)
+	if err != nil {
+		return Data{}, err
+	}
+
+	var total model.Money
+	for _, in := range schedule {
+		total = total.Add(in.Amount)
+	}
+
+	return Data{
+		Loan:           l,
+		Date:           date,
+		Schedule:       schedule,
+		Investors:      model.FilterInvestments(l.Investments, model.InvestmentActive),
+		TotalRepayment: total,
+	}, nil
+}
+
+// InvestmentData is what an investment agreement template is executed with.
+type InvestmentData struct {
+	Data
+	Investment model.Investment
+	// ExpectedReturn is the investment's share of Loan.ROI.
+	ExpectedReturn model.Money
+}
+
+// NewInvestmentData prepares the template data of every active investment of the loan.
+func NewInvestmentData(data Data) []InvestmentData {
+	returns := model.ExpectedReturns(data.Loan)
+
+	investments := make([]InvestmentData, len(data.Investors))
+	for i, inv := range data.Investors {
+		investments[i] = InvestmentData{Data: data, Investment: inv, ExpectedReturn: returns[inv.ID]}
+	}
+	return investments
+}
+
+const (
+	loanTemplate       = ""
+	investmentTemplate = ".investment"
+)
+
+// Renderer holds the agreement templates keyed by product.
+type Renderer struct {
+	templates map[string]*template.Template
+}
+
+// NewRenderer parses every "<product>.tmpl" (loan agreement) and
+// "<product>.investment.tmpl" (investment agreement) file at the root of
+// fsys. Both templates are required for model.DefaultProduct; they are used
+// for products without their own.
+func NewRenderer(fsys fs.FS) (*Renderer, error) {
+	names, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{templates: make(map[string]*template.Template, len(names))}
+	for _, name := range names {
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").ParseFS(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse agreement template %s: %w", name, err)
+		}
+		r.templates[strings.TrimSuffix(path.Base(name), ".tmpl")] = tmpl
+	}
+
+	for _, kind := range []string{loanTemplate, investmentTemplate} {
+		if _, ok := r.templates[model.DefaultProduct+kind]; !ok {
+			return nil, fmt.Errorf("agreement template %s%s.tmpl is missing", model.DefaultProduct, kind)
+		}
+	}
+	return r, nil
+}
+
+// DefaultRenderer returns a renderer with the templates built into the binary.
+func DefaultRenderer() *Renderer {
+	fsys, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	r, err := NewRenderer(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// execute runs the template of the given kind for the product.
+func (r *Renderer) execute(product, kind string, data interface{}) (string, error) {
+	tmpl, ok := r.templates[product+kind]
+	if !ok {
+		tmpl = r.templates[model.DefaultProduct+kind]
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute agreement template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Text executes the loan agreement template of the loan's product.
+func (r *Renderer) Text(data Data) (string, error) {
+	return r.execute(data.Loan.Product, loanTemplate, data)
+}
+
+// InvestmentText executes the investment agreement template of the loan's product.
+func (r *Renderer) InvestmentText(data InvestmentData) (string, error) {
+	return r.execute(data.Loan.Product, investmentTemplate, data)
+}
+
+// Render returns the loan agreement as a PDF. The footer of every page
+// carries the SHA-256 of the agreement text, so a printed copy can be matched
+// to the terms it was generated from.
+func (r *Renderer) Render(data Data) ([]byte, error) {
+	text, err := r.Text(data)
+	if err != nil {
+		return nil, err
+	}
+	return renderPDF(text, "Loan Agreement "+data.Loan.ID, data.Date, TextHash(text))
+}
+
+// RenderInvestment returns the investment agreement as a PDF, with the same
+// footer as Render.
+func (r *Renderer) RenderInvestment(data InvestmentData) ([]byte, error) {
+	text, err := r.InvestmentText(data)
+	if err != nil {
+		return nil, err
+	}
+	return renderPDF(text, "Investment Agreement "+data.Investment.ID, data.Date, TextHash(text))
+}
+
+// TextHash returns the hex SHA-256 of the agreement text.
+func TextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+var funcs = template.FuncMap{
+	"money": func(m model.Money) string {
+		return m.Grouped(",", ".")
+	},
+	"date": func(t time.Time) string {
+		return t.Format("2 January 2006")
+	},
+	"percent": func(rate float64) string {
+		return fmt.Sprintf("%.2f%%", rate)
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+	"cell": escapeCell,
+	"share": func(part, whole model.Money) string {
+		if whole.IsZero() {
+			return "0.00%"
+		}
+		return fmt.Sprintf("%.2f%%", float64(part.Minor())*100/float64(whole.Minor()))
+	},
+}
+
+// cellEscaper escapes the table delimiter and turns line breaks, which would
+// end the row, into spaces.
+var cellEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// escapeCell makes free text such as a name safe to put in a table row.
+func escapeCell(s string) string {
+	return cellEscaper.Replace(s)
+}
@@ -0,0 +1,197 @@
+package agreement_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"loan-engine/agreement"
+	"loan-engine/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func createAgreementLoan() *model.Loan {
+	return &model.Loan{
+		ID:                 "6f1c2a9e-3b7d-4c1a-9e2f-1a2b3c4d5e6f",
+		BorrowerID:         "borrower-123",
+		PrincipalAmount:    model.NewMoney(12000000),
+		Currency:           "IDR",
+		Rate:               12,
+		ROI:                model.NewMoney(1440000),
+		Tenor:              24,
+		RepaymentFrequency: model.FrequencyMonthly,
+		InterestMethod:     model.InterestAnnuity,
+		Product:            model.DefaultProduct,
+		State:              model.StateInvested,
+		Investments: []model.Investment{
+			{ID: "investment-1", InvestorID: "investor-1", Name: "Siti Rahayu", Amount: model.NewMoney(6000000), Status: model.InvestmentActive},
+			{ID: "investment-2", InvestorID: "investor-2", Name: "Budi Santoso", Amount: model.NewMoney(3000000), Status: model.InvestmentWithdrawn},
+			{ID: "investment-3", InvestorID: "investor-3", Name: "José Álvarez", Amount: model.NewMoney(6000000), Status: model.InvestmentActive},
+		},
+	}
+}
+
+var agreementDate = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// assertGolden compares got with testdata/name, rewriting the file with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test ./agreement -update to create the golden file")
+	assert.True(t, bytes.Equal(want, got), "%s differs from the golden file; run go test ./agreement -update after checking the change", name)
+}
+
+func TestRenderStandardAgreement(t *testing.T) {
+	data, err := agreement.NewData(createAgreementLoan(), agreementDate)
+	require.NoError(t, err)
+	renderer := agreement.DefaultRenderer()
+
+	text, err := renderer.Text(data)
+	require.NoError(t, err)
+	assertGolden(t, "standard.golden.txt", []byte(text))
+
+	pdf, err := renderer.Render(data)
+	require.NoError(t, err)
+	assertGolden(t, "standard.golden.pdf", pdf)
+
+	again, err := renderer.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, pdf, again, "rendering must be reproducible")
+
+	pages := regexp.MustCompile(`/Type /Page\b`).FindAll(pdf, -1)
+	assert.Greater(t, len(pages), 1)
+}
+
+func TestRenderStandardInvestmentAgreement(t *testing.T) {
+	data, err := agreement.NewData(createAgreementLoan(), agreementDate)
+	require.NoError(t, err)
+	renderer := agreement.DefaultRenderer()
+
+	investments := agreement.NewInvestmentData(data)
+	require.Len(t, investments, 2)
+	assert.Equal(t, "investment-3", investments[1].Investment.ID)
+	// The expected returns split the ROI exactly
+	assert.Equal(t, model.NewMoney(1440000), investments[0].ExpectedReturn.Add(investments[1].ExpectedReturn))
+
+	text, err := renderer.InvestmentText(investments[1])
+	require.NoError(t, err)
+	assertGolden(t, "standard.investment.golden.txt", []byte(text))
+	assert.NotContains(t, text, "Siti Rahayu", "a letter only names its own investor")
+
+	pdf, err := renderer.RenderInvestment(investments[1])
+	require.NoError(t, err)
+	assertGolden(t, "standard.investment.golden.pdf", pdf)
+}
+
+func TestRenderAgreementEscapesTableCells(t *testing.T) {
+	loan := createAgreementLoan()
+	loan.Investments[0].Name = "PT Maju | Jaya"
+	loan.Investments[2].Name = "José\nÁlvarez \\ Co"
+	data, err := agreement.NewData(loan, agreementDate)
+	require.NoError(t, err)
+	renderer := agreement.DefaultRenderer()
+
+	text, err := renderer.Text(data)
+	require.NoError(t, err)
+	assertGolden(t, "delimiters.golden.txt", []byte(text))
+	assert.Contains(t, text, `| 1 | PT Maju \| Jaya | investor-1 |`)
+	assert.Contains(t, text, `| 2 | José Álvarez \\ Co | investor-3 |`)
+
+	pdf, err := renderer.Render(data)
+	require.NoError(t, err)
+	assertGolden(t, "delimiters.golden.pdf", pdf)
+}
+
+func TestNewData(t *testing.T) {
+	data, err := agreement.NewData(createAgreementLoan(), agreementDate)
+	require.NoError(t, err)
+
+	assert.Len(t, data.Schedule, 24)
+	// Withdrawn investments are not party to the agreement
+	assert.Len(t, data.Investors, 2)
+
+	var principal model.Money
+	for _, in := range data.Schedule {
+		principal = principal.Add(in.Principal)
+	}
+	assert.Equal(t, model.NewMoney(12000000), principal)
+	assert.Equal(t, 1, data.TotalRepayment.Cmp(principal))
+}
+
+func TestRendererSelectsProductTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"standard.tmpl":            {Data: []byte("# Standard agreement for {{.Loan.BorrowerID}}")},
+		"standard.investment.tmpl": {Data: []byte("# Standard letter for {{.Investment.Name}}")},
+		"microloan.tmpl":           {Data: []byte("# Microloan agreement for {{.Loan.BorrowerID}}")},
+		"not-a-template":           {Data: []byte("ignored")},
+		"drafts/old.tmpl":          {Data: []byte("ignored")},
+	}
+	renderer, err := agreement.NewRenderer(fsys)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		product string
+		expect  string
+	}{
+		{product: "microloan", expect: "# Microloan agreement for borrower-123"},
+		{product: model.DefaultProduct, expect: "# Standard agreement for borrower-123"},
+		{product: "unknown", expect: "# Standard agreement for borrower-123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.product, func(t *testing.T) {
+			loan := createAgreementLoan()
+			loan.Product = tc.product
+
+			text, err := renderer.Text(agreement.Data{Loan: loan})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, text)
+
+			// Products without their own investment template fall back to the default one
+			text, err = renderer.InvestmentText(agreement.InvestmentData{Data: agreement.Data{Loan: loan}, Investment: loan.Investments[0]})
+			require.NoError(t, err)
+			assert.Equal(t, "# Standard letter for Siti Rahayu", text)
+		})
+	}
+}
+
+func TestNewRendererErrors(t *testing.T) {
+	letter := &fstest.MapFile{Data: []byte("letter")}
+
+	t.Run("Missing default template", func(t *testing.T) {
+		_, err := agreement.NewRenderer(fstest.MapFS{"microloan.tmpl": {Data: []byte("text")}, "standard.investment.tmpl": letter})
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing default investment template", func(t *testing.T) {
+		_, err := agreement.NewRenderer(fstest.MapFS{"standard.tmpl": {Data: []byte("text")}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid template", func(t *testing.T) {
+		_, err := agreement.NewRenderer(fstest.MapFS{"standard.tmpl": {Data: []byte("{{.Loan")}, "standard.investment.tmpl": letter})
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		renderer, err := agreement.NewRenderer(fstest.MapFS{"standard.tmpl": {Data: []byte("{{.Loan.Missing}}")}, "standard.investment.tmpl": letter})
+		require.NoError(t, err)
+		_, err = renderer.Text(agreement.Data{Loan: createAgreementLoan()})
+		assert.True(t, err != nil && strings.Contains(err.Error(), "Missing"))
+	})
+}
@@ -0,0 +1,211 @@
+package agreement
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// The rendered template text is laid out line by line:
+//
+//	# Title              centered document title
+//	## Heading           section heading
+//	| a | b | c |        table row; the first row of a table is its header,
+//	                     and \| and \\ in a cell stand for | and \
+//	@signature Label     signature block with name and date lines
+//	@pagebreak           start a new page
+//
+// Any other lines are paragraph text; blank lines separate paragraphs.
+
+const (
+	pageWidth    = 210.0
+	marginLeft   = 20.0
+	marginTop    = 20.0
+	marginBottom = 20.0
+	contentWidth = pageWidth - 2*marginLeft
+	lineHeight   = 5.5
+)
+
+func renderPDF(text, title string, date time.Time, hash string) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(marginLeft, marginTop, marginLeft)
+	pdf.SetAutoPageBreak(true, marginBottom)
+	// Fixed metadata keeps the output byte-for-byte reproducible
+	pdf.SetCreationDate(date)
+	pdf.SetModificationDate(date)
+	pdf.SetCatalogSort(true)
+	pdf.SetTitle(title, true)
+	pdf.AliasNbPages("{nb}")
+
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Arial", "", 7)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.CellFormat(contentWidth/2, 4, tr(title), "", 0, "L", false, 0, "")
+		pdf.CellFormat(contentWidth/2, 4, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 1, "R", false, 0, "")
+		pdf.CellFormat(contentWidth, 4, "Document hash (SHA-256): "+hash, "", 0, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+	pdf.AddPage()
+
+	var paragraph []string
+	var table [][]string
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		pdf.SetFont("Arial", "", 10)
+		pdf.MultiCell(contentWidth, lineHeight, tr(strings.Join(paragraph, " ")), "", "J", false)
+		pdf.Ln(2)
+		paragraph = nil
+	}
+	flushTable := func() {
+		if len(table) == 0 {
+			return
+		}
+		writeTable(pdf, tr, table)
+		table = nil
+	}
+
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+
+		if !strings.HasPrefix(line, "|") {
+			flushTable()
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "|") || strings.HasPrefix(line, "@") {
+			flushParagraph()
+		}
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "## "):
+			pdf.Ln(2)
+			pdf.SetFont("Arial", "B", 11)
+			pdf.MultiCell(contentWidth, 6, tr(strings.TrimPrefix(line, "## ")), "", "L", false)
+			pdf.Ln(1)
+		case strings.HasPrefix(line, "# "):
+			pdf.SetFont("Arial", "B", 16)
+			pdf.MultiCell(contentWidth, 9, tr(strings.TrimPrefix(line, "# ")), "", "C", false)
+			pdf.Ln(4)
+		case strings.HasPrefix(line, "|"):
+			table = append(table, splitRow(line))
+		case line == "@pagebreak":
+			pdf.AddPage()
+		case strings.HasPrefix(line, "@signature"):
+			writeSignature(pdf, tr, strings.TrimSpace(strings.TrimPrefix(line, "@signature")))
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flushParagraph()
+	flushTable()
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// splitRow returns the trimmed cells of a "| a | b |" row, unescaping \| and \\.
+func splitRow(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && (line[i+1] == '|' || line[i+1] == '\\'):
+			i++
+			cell.WriteByte(line[i])
+		case c == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	// Text after the last delimiter is a cell unless the row ends with one
+	if rest := strings.TrimSpace(cell.String()); rest != "" || len(cells) == 0 {
+		cells = append(cells, rest)
+	}
+	return cells
+}
+
+// writeTable draws the rows with equal column widths, repeating the header
+// row at the top of every page the table runs onto.
+func writeTable(pdf *gofpdf.Fpdf, tr func(string) string, rows [][]string) {
+	header, body := rows[0], rows[1:]
+	width := contentWidth / float64(len(header))
+	_, pageHeight := pdf.GetPageSize()
+
+	writeHeader := func() {
+		pdf.SetFont("Arial", "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for _, cell := range header {
+			pdf.CellFormat(width, 6, tr(cell), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	writeHeader()
+	pdf.SetFont("Arial", "", 9)
+	for _, row := range body {
+		if pdf.GetY()+6 > pageHeight-marginBottom {
+			pdf.AddPage()
+			writeHeader()
+			pdf.SetFont("Arial", "", 9)
+		}
+		for i := range header {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			align := "L"
+			if isNumeric(cell) {
+				align = "R"
+			}
+			pdf.CellFormat(width, 6, tr(cell), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(3)
+}
+
+// writeSignature draws a signature line with the label, name and date below it,
+// keeping the block on one page.
+func writeSignature(pdf *gofpdf.Fpdf, tr func(string) string, label string) {
+	const blockHeight = 36.0
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+blockHeight > pageHeight-marginBottom {
+		pdf.AddPage()
+	}
+
+	pdf.Ln(14)
+	y := pdf.GetY()
+	pdf.Line(marginLeft, y, marginLeft+80, y)
+	pdf.Ln(1)
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(80, 5, tr(label), "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 9)
+	pdf.CellFormat(80, 5, "Name:", "", 1, "L", false, 0, "")
+	pdf.CellFormat(80, 5, "Date:", "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != '.' && r != ',' && r != '-' && r != '%' {
+			return false
+		}
+	}
+	return true
+}
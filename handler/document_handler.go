@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"loan-engine/model"
+	"loan-engine/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DocumentHandler struct {
+	service *service.LoanService
+}
+
+func NewDocumentHandler(service *service.LoanService) *DocumentHandler {
+	return &DocumentHandler{service: service}
+}
+
+// GetDocument streams the document to an authenticated client.
+func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "docId")
+	if documentID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "document id is required")
+		return
+	}
+
+	h.serveDocument(w, r, documentID)
+}
+
+// DownloadDocument streams the document to anyone holding an unexpired link
+// issued by LoanService.DocumentURL.
+func (h *DocumentHandler) DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "docId")
+	if documentID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "document id is required")
+		return
+	}
+
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusForbidden, model.ErrDocumentLinkInvalid.Error())
+		return
+	}
+
+	err = h.service.VerifyDocumentLink(documentID, expires, q.Get("signature"))
+	if err != nil {
+		JSONErrorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	h.serveDocument(w, r, documentID)
+}
+
+// serveDocument writes the content with its type and ETag; http.ServeContent
+// answers conditional and range requests.
+func (h *DocumentHandler) serveDocument(w http.ResponseWriter, r *http.Request, documentID string) {
+	doc, body, err := h.service.GetDocument(r.Context(), documentID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("ETag", doc.ETag())
+	w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", documentFileName(doc)))
+	http.ServeContent(w, r, "", doc.CreatedAt, bytes.NewReader(body))
+}
+
+func documentFileName(doc *model.Document) string {
+	name := fmt.Sprintf("%s-%s", doc.Kind, doc.LoanID)
+	if doc.ContentType == "application/pdf" {
+		name += ".pdf"
+	}
+	return name
+}
@@ -2,10 +2,16 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"loan-engine/model"
+	"loan-engine/repository"
 	"loan-engine/service"
 
 	"github.com/go-chi/chi/v5"
@@ -19,6 +25,167 @@ func NewLoanHandler(service *service.LoanService) *LoanHandler {
 	return &LoanHandler{service: service}
 }
 
+func (h *LoanHandler) GetLoan(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	loan, err := h.service.GetLoan(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan retrieved successfully", loan)
+}
+
+func (h *LoanHandler) GetLoanPayouts(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	payouts, err := h.service.GetLoanPayouts(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan payouts retrieved successfully", payouts)
+}
+
+func (h *LoanHandler) GetInvestorPayouts(w http.ResponseWriter, r *http.Request) {
+	investorID := chi.URLParam(r, "investorId")
+	if investorID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "investor id is required")
+		return
+	}
+
+	payouts, err := h.service.GetInvestorPayouts(r.Context(), investorID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Investor payouts retrieved successfully", payouts)
+}
+
+func (h *LoanHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	installments, err := h.service.GetSchedule(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan schedule retrieved successfully", installments)
+}
+
+func (h *LoanHandler) GetTransitions(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	transitions, err := h.service.GetTransitions(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan transitions retrieved successfully", transitions)
+}
+
+func (h *LoanHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	documents, err := h.service.ListDocuments(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan documents retrieved successfully", documents)
+}
+
+func (h *LoanHandler) RegenerateDocuments(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	err := h.service.RegenerateAgreements(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusAccepted, "Loan document regeneration scheduled", "")
+}
+
+func (h *LoanHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	notifications, err := h.service.ListNotifications(r.Context(), loanID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan notifications retrieved successfully", notifications)
+}
+
+func (h *LoanHandler) ResendNotification(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	notificationID := chi.URLParam(r, "notificationId")
+	if loanID == "" || notificationID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id and notification id are required")
+		return
+	}
+
+	attempt, err := h.service.ResendNotification(r.Context(), loanID, notificationID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusCreated, "Notification resent successfully", attempt)
+}
+
+func (h *LoanHandler) ListLoans(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLoanFilter(r.URL.Query())
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.service.ListLoans(r.Context(), filter)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loans retrieved successfully", page)
+}
+
 func (h *LoanHandler) CreateLoan(w http.ResponseWriter, r *http.Request) {
 	var req model.CreateLoanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -28,7 +195,7 @@ func (h *LoanHandler) CreateLoan(w http.ResponseWriter, r *http.Request) {
 
 	loan, err := h.service.CreateLoan(r.Context(), req)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusInternalServerError, err.Error())
+		JSONServiceErrorResponse(w, r, err)
 		return
 	}
 
@@ -51,7 +218,7 @@ func (h *LoanHandler) ApproveLoan(w http.ResponseWriter, r *http.Request) {
 
 	err := h.service.ApproveLoan(r.Context(), req)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusInternalServerError, err.Error())
+		JSONServiceErrorResponse(w, r, err)
 		return
 	}
 
@@ -74,7 +241,7 @@ func (h *LoanHandler) AddInvestment(w http.ResponseWriter, r *http.Request) {
 
 	isInvested, err := h.service.AddInvestment(r.Context(), req)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusInternalServerError, err.Error())
+		JSONServiceErrorResponse(w, r, err)
 		return
 	}
 	data := ""
@@ -85,6 +252,31 @@ func (h *LoanHandler) AddInvestment(w http.ResponseWriter, r *http.Request) {
 	JSONSuccessResponse(w, http.StatusCreated, "Loan investment created successfully", data)
 }
 
+func (h *LoanHandler) WithdrawInvestment(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	investmentID := chi.URLParam(r, "investmentId")
+	if investmentID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "investment id is required")
+		return
+	}
+
+	err := h.service.WithdrawInvestment(r.Context(), model.WithdrawInvestmentRequest{
+		LoanID:       loanID,
+		InvestmentID: investmentID,
+	})
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan investment withdrawn successfully", "")
+}
+
 func (h *LoanHandler) DisburseLoan(w http.ResponseWriter, r *http.Request) {
 	loanID := chi.URLParam(r, "id")
 	if loanID == "" {
@@ -101,13 +293,164 @@ func (h *LoanHandler) DisburseLoan(w http.ResponseWriter, r *http.Request) {
 
 	err := h.service.DisburseLoan(r.Context(), req)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusInternalServerError, err.Error())
+		JSONServiceErrorResponse(w, r, err)
 		return
 	}
 
 	JSONSuccessResponse(w, http.StatusOK, "Loan disbursed successfully", "")
 }
 
+func parseLoanFilter(q url.Values) (model.LoanFilter, error) {
+	filter := model.LoanFilter{
+		State:      model.LoanState(q.Get("state")),
+		BorrowerID: q.Get("borrower_id"),
+		Sort:       model.SortOrder(q.Get("sort")),
+	}
+
+	if filter.Sort != "" && filter.Sort != model.SortAsc && filter.Sort != model.SortDesc {
+		return filter, fmt.Errorf("invalid sort %q, must be asc or desc", filter.Sort)
+	}
+
+	var err error
+	if filter.MinPrincipal, err = parseMoneyParam(q, "min_principal"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrincipal, err = parseMoneyParam(q, "max_principal"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = parseTimeParam(q, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeParam(q, "created_to"); err != nil {
+		return filter, err
+	}
+
+	if v := q.Get("limit"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit <= 0 {
+			return filter, errors.New("limit must be a positive integer")
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		filter.Cursor, err = model.DecodeLoanCursor(v)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func parseMoneyParam(q url.Values, key string) (*model.Money, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	m, err := model.ParseMoney(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a decimal amount", key)
+	}
+	return &m, nil
+}
+
+func parseTimeParam(q url.Values, key string) (*time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC3339 timestamp", key)
+	}
+	return &t, nil
+}
+
+func (h *LoanHandler) RejectLoan(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	var req model.RejectLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.LoanID = loanID
+
+	err := h.service.RejectLoan(r.Context(), req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan rejected successfully", "")
+}
+
+func (h *LoanHandler) CancelLoan(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	var req model.CancelLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.LoanID = loanID
+
+	err := h.service.CancelLoan(r.Context(), req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan cancelled successfully", "")
+}
+
+func (h *LoanHandler) RecordRepayment(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	var req model.RecordRepaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.LoanID = loanID
+
+	repayment, err := h.service.RecordRepayment(r.Context(), req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusCreated, "Loan repayment recorded successfully", repayment)
+}
+
+func (h *LoanHandler) MarkDefault(w http.ResponseWriter, r *http.Request) {
+	loanID := chi.URLParam(r, "id")
+	if loanID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "loan id is required")
+		return
+	}
+
+	err := h.service.MarkDefault(r.Context(), loanID, time.Now())
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Loan marked as defaulted successfully", "")
+}
+
 type SuccessResponse struct {
 	Status  string      `json:"status"`         // e.g., "success"
 	Message string      `json:"message"`        // Optional, can explain the success
@@ -115,11 +458,25 @@ type SuccessResponse struct {
 }
 
 type ErrorResponse struct {
-	Status  string `json:"status"`  // e.g., "error"
-	Message string `json:"message"` // Error message for the client
-	Code    int    `json:"code"`    // Optional, HTTP status code
+	Status    string `json:"status"`     // e.g., "error"
+	Message   string `json:"message"`    // Error message for the client
+	Code      int    `json:"code"`       // Optional, HTTP status code
+	ErrorCode string `json:"error_code"` // Machine-readable error code, e.g. "not_found"
 }
 
+// Machine-readable error codes returned in ErrorResponse.
+const (
+	ErrorCodeInvalidRequest         = "invalid_request"
+	ErrorCodeUnauthorized           = "unauthorized"
+	ErrorCodeForbidden              = "forbidden"
+	ErrorCodeNotFound               = "not_found"
+	ErrorCodeConflict               = "conflict"
+	ErrorCodeInvalidTransition      = "invalid_transition"
+	ErrorCodeConcurrentModification = "concurrent_modification"
+	ErrorCodeValidationFailed       = "validation_failed"
+	ErrorCodeInternal               = "internal_error"
+)
+
 func JSONSuccessResponse(w http.ResponseWriter, statusCode int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -132,12 +489,57 @@ func JSONSuccessResponse(w http.ResponseWriter, statusCode int, message string,
 }
 
 func JSONErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	JSONErrorResponseWithCode(w, statusCode, errorCodeForStatus(statusCode), message)
+}
+
+func JSONErrorResponseWithCode(w http.ResponseWriter, statusCode int, errorCode string, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	response := ErrorResponse{
-		Status:  "error",
-		Message: message,
-		Code:    statusCode,
+		Status:    "error",
+		Message:   message,
+		Code:      statusCode,
+		ErrorCode: errorCode,
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// JSONServiceErrorResponse maps a service error to its HTTP status and error
+// code. Unexpected errors are logged with the request ID and answered with a
+// fixed message, so database and driver details don't reach the client.
+func JSONServiceErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		JSONErrorResponseWithCode(w, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+	case errors.Is(err, model.ErrInvalidTransition):
+		JSONErrorResponseWithCode(w, http.StatusConflict, ErrorCodeInvalidTransition, err.Error())
+	case errors.Is(err, repository.ErrConcurrentModification):
+		JSONErrorResponseWithCode(w, http.StatusConflict, ErrorCodeConcurrentModification, err.Error())
+	case errors.Is(err, model.ErrValidationFailed):
+		JSONErrorResponseWithCode(w, http.StatusUnprocessableEntity, ErrorCodeValidationFailed, err.Error())
+	case errors.Is(err, model.ErrForbidden):
+		JSONErrorResponseWithCode(w, http.StatusForbidden, ErrorCodeForbidden, err.Error())
+	default:
+		log.Printf("Internal error handling %s %s (request %s): %v", r.Method, r.URL.Path, model.RequestIDFromContext(r.Context()), err)
+		JSONErrorResponseWithCode(w, http.StatusInternalServerError, ErrorCodeInternal, "internal error")
+	}
+}
+
+func errorCodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusUnprocessableEntity:
+		return ErrorCodeValidationFailed
+	default:
+		return ErrorCodeInternal
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"loan-engine/model"
+	"loan-engine/notification"
+)
+
+type NotificationHandler struct {
+	templates *notification.Templates
+}
+
+func NewNotificationHandler(templates *notification.Templates) *NotificationHandler {
+	return &NotificationHandler{templates: templates}
+}
+
+// PreviewNotification renders the templates of a notification type with sample
+// data. format=html and format=text return the body alone, e.g. for a browser.
+func (h *NotificationHandler) PreviewNotification(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	typ := model.NotificationType(q.Get("type"))
+	if typ == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "type is required")
+		return
+	}
+	locale := q.Get("locale")
+	if locale != "" && !model.IsValidLocale(locale) {
+		JSONErrorResponse(w, http.StatusBadRequest, "locale is invalid")
+		return
+	}
+
+	m, err := h.templates.Preview(typ, locale)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	switch q.Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(m.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(m.Text))
+	default:
+		JSONSuccessResponse(w, http.StatusOK, "Notification preview rendered successfully", m)
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"loan-engine/model"
+	"loan-engine/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type UserHandler struct {
+	service *service.UserService
+}
+
+func NewUserHandler(service *service.UserService) *UserHandler {
+	return &UserHandler{service: service}
+}
+
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.service.CreateUser(r.Context(), req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusCreated, "User created successfully", user)
+}
+
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.service.ListUsers(r.Context())
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Users retrieved successfully", users)
+}
+
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	var req model.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.service.UpdateUser(r.Context(), userID, req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "User updated successfully", user)
+}
+
+// GetCurrentUser returns the authenticated user, e.g. for a client to find
+// its own ID and roles.
+func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	JSONSuccessResponse(w, http.StatusOK, "User retrieved successfully", model.UserFromContext(r.Context()))
+}
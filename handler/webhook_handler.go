@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"loan-engine/model"
+	"loan-engine/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	service *service.WebhookService
+}
+
+func NewWebhookHandler(service *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateWebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscription, err := h.service.CreateSubscription(r.Context(), req)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusCreated, "Webhook subscription created successfully", subscription)
+}
+
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Webhook subscriptions retrieved successfully", subscriptions)
+}
+
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := chi.URLParam(r, "id")
+	if subscriptionID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "subscription id is required")
+		return
+	}
+
+	err := h.service.DeleteSubscription(r.Context(), subscriptionID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Webhook subscription deleted successfully", "")
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := chi.URLParam(r, "id")
+	if subscriptionID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "subscription id is required")
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), subscriptionID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Webhook deliveries retrieved successfully", deliveries)
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := chi.URLParam(r, "id")
+	deliveryID := chi.URLParam(r, "deliveryId")
+	if subscriptionID == "" || deliveryID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "subscription id and delivery id are required")
+		return
+	}
+
+	delivery, err := h.service.GetDelivery(r.Context(), subscriptionID, deliveryID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusOK, "Webhook delivery retrieved successfully", delivery)
+}
+
+func (h *WebhookHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := chi.URLParam(r, "id")
+	deliveryID := chi.URLParam(r, "deliveryId")
+	if subscriptionID == "" || deliveryID == "" {
+		JSONErrorResponse(w, http.StatusBadRequest, "subscription id and delivery id are required")
+		return
+	}
+
+	err := h.service.ReplayDelivery(r.Context(), subscriptionID, deliveryID)
+	if err != nil {
+		JSONServiceErrorResponse(w, r, err)
+		return
+	}
+
+	JSONSuccessResponse(w, http.StatusAccepted, "Webhook delivery queued for replay", "")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"loan-engine/config"
 	"log"
 	"net/http"
@@ -10,10 +11,13 @@ import (
 	"os/signal"
 	"time"
 
+	"loan-engine/agreement"
 	"loan-engine/handler"
+	"loan-engine/model"
 	"loan-engine/notification"
 	"loan-engine/repository"
 	"loan-engine/service"
+	"loan-engine/storage"
 
 	customMiddleware "loan-engine/middleware"
 
@@ -38,28 +42,155 @@ func main() {
 
 	// Initialize components
 	loanRepo := repository.NewLoanRepository(db)
-	emailSvc := notification.NewSendGridService(cfg.SendgridAPIKey)
-	loanSvc := service.NewLoanService(loanRepo, emailSvc)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	channel, err := newNotificationChannel(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize notifications: %v", err)
+	}
+	locking, err := service.ParseLockingStrategy(cfg.LoanLockingStrategy)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	lateFee, err := model.ParseMoney(cfg.LateFee)
+	if err != nil || lateFee.IsNegative() {
+		log.Fatalf("Invalid configuration: LATE_FEE must be a non-negative amount, got %q", cfg.LateFee)
+	}
+	templates := notification.DefaultTemplates()
+	if cfg.NotificationTemplateDir != "" {
+		templates, err = notification.NewTemplates(os.DirFS(cfg.NotificationTemplateDir))
+		if err != nil {
+			log.Fatalf("Failed to load notification templates: %v", err)
+		}
+	}
+	loanSvc := service.NewLoanService(loanRepo, notification.NewNotifier(channel, templates)).WithRetryPolicy(service.RetryPolicy{
+		MaxAttempts: cfg.LoanUpdateMaxAttempts,
+		BaseDelay:   cfg.LoanUpdateRetryBaseDelay,
+		MaxDelay:    cfg.LoanUpdateRetryMaxDelay,
+	}).WithLockingStrategy(locking).WithLateFee(lateFee)
+	documentStore, err := newDocumentStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize document store: %v", err)
+	}
+	loanSvc.WithDocumentStore(documentStore).WithDocumentLinks(service.DocumentLinks{
+		BaseURL: cfg.PublicBaseURL,
+		Secret:  cfg.DocumentLinkSecret,
+		TTL:     cfg.DocumentLinkTTL,
+	})
+	if cfg.AgreementTemplateDir != "" {
+		agreements, err := agreement.NewRenderer(os.DirFS(cfg.AgreementTemplateDir))
+		if err != nil {
+			log.Fatalf("Failed to load agreement templates: %v", err)
+		}
+		loanSvc.WithAgreementRenderer(agreements)
+	}
 	loanHandler := handler.NewLoanHandler(loanSvc)
+	documentHandler := handler.NewDocumentHandler(loanSvc)
+	notificationHandler := handler.NewNotificationHandler(templates)
+	webhookSvc := service.NewWebhookService(webhookRepo, &http.Client{Timeout: cfg.WebhookTimeout}, service.RetryPolicy{
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BaseDelay:   cfg.WebhookRetryBaseDelay,
+		MaxDelay:    cfg.WebhookRetryMaxDelay,
+	}, 2*cfg.WebhookTimeout)
+	webhookHandler := handler.NewWebhookHandler(webhookSvc)
+	userSvc := service.NewUserService(userRepo).WithPasswordCache(cfg.AuthCacheTTL)
+	if cfg.AuthUsername != "" && cfg.AuthPassword != "" {
+		err = userSvc.EnsureAdmin(context.Background(), cfg.AuthUsername, cfg.AuthPassword)
+		if err != nil {
+			log.Fatalf("Failed to create the admin user: %v", err)
+		}
+	}
+	userHandler := handler.NewUserHandler(userSvc)
+
+	// Domain event handlers
+	dispatcher := service.NewOutboxDispatcher(outboxRepo, service.RetryPolicy{
+		MaxAttempts: cfg.OutboxMaxAttempts,
+		BaseDelay:   cfg.OutboxRetryBaseDelay,
+		MaxDelay:    cfg.OutboxRetryMaxDelay,
+	}, cfg.OutboxLease)
+	dispatcher.Register(model.EventTypeLoanApproved, loanSvc.HandleLoanApproved)
+	dispatcher.Register(model.EventTypeInvestmentAdded, loanSvc.HandleInvestmentAdded)
+	dispatcher.Register(model.EventTypeLoanDisbursed, loanSvc.HandleLoanDisbursed)
+	dispatcher.Register(model.EventTypeLoanExpired, loanSvc.HandleLoanExpired)
+	dispatcher.Register(model.EventTypeAgreementsRequested, loanSvc.HandleAgreementsRequested)
+	dispatcher.Register(model.EventTypeAgreementsGenerated, loanSvc.HandleAgreementsGenerated)
+	dispatcher.Register(model.EventTypeLoanTransitioned, webhookSvc.HandleTransition)
+
+	// Background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go loanSvc.RunExpiryScheduler(workerCtx, cfg.FundingExpiryInterval, cfg.FundingExpiryBatchSize)
+	go dispatcher.Run(workerCtx, cfg.OutboxDispatchInterval, cfg.OutboxBatchSize)
+	go webhookSvc.Run(workerCtx, cfg.WebhookDeliveryInterval, cfg.WebhookBatchSize)
 
 	// Router setup
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(customMiddleware.RequestID)
 	r.Use(customMiddleware.MetricsMiddleware)
 
 	// Metrics endpoint
 	r.Handle("/metrics", promhttp.Handler())
 
-	// API routes with authentication
+	// Signed document links, e.g. from agreement emails
+	r.Get("/documents/{docId}", documentHandler.DownloadDocument)
+
+	// API routes with authentication, each allowed to the roles granting its permission
+	can := customMiddleware.RequirePermission
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Use(customMiddleware.BasicAuth)
+		r.Use(customMiddleware.BasicAuth(userSvc))
+		r.Use(customMiddleware.Idempotency(idempotencyRepo, cfg.IdempotencyKeyTTL))
+
+		r.Get("/me", userHandler.GetCurrentUser)
 
-		r.Post("/loans", loanHandler.CreateLoan)
+		r.With(can(model.PermissionViewLoans)).Get("/loans", loanHandler.ListLoans)
+		r.With(can(model.PermissionCreateLoan)).Post("/loans", loanHandler.CreateLoan)
 		r.Route("/loans/{id}", func(r chi.Router) {
-			r.Patch("/approve", loanHandler.ApproveLoan)
-			r.Post("/investments", loanHandler.AddInvestment)
-			r.Patch("/disburse", loanHandler.DisburseLoan)
+			r.Group(func(r chi.Router) {
+				r.Use(can(model.PermissionViewLoans))
+				r.Get("/", loanHandler.GetLoan)
+				r.Get("/transitions", loanHandler.GetTransitions)
+				r.Get("/schedule", loanHandler.GetSchedule)
+				r.Get("/payouts", loanHandler.GetLoanPayouts)
+				r.Get("/documents", loanHandler.GetDocuments)
+			})
+			r.With(can(model.PermissionManageDocuments)).Post("/documents/regenerate", loanHandler.RegenerateDocuments)
+			r.With(can(model.PermissionManageNotifications)).Get("/notifications", loanHandler.GetNotifications)
+			r.With(can(model.PermissionManageNotifications)).Post("/notifications/{notificationId}/resend", loanHandler.ResendNotification)
+			r.With(can(model.PermissionApproveLoan)).Patch("/approve", loanHandler.ApproveLoan)
+			r.With(can(model.PermissionRejectLoan)).Patch("/reject", loanHandler.RejectLoan)
+			r.With(can(model.PermissionCancelLoan)).Patch("/cancel", loanHandler.CancelLoan)
+			r.With(can(model.PermissionInvest)).Post("/investments", loanHandler.AddInvestment)
+			r.With(can(model.PermissionInvest)).Delete("/investments/{investmentId}", loanHandler.WithdrawInvestment)
+			r.With(can(model.PermissionDisburseLoan)).Patch("/disburse", loanHandler.DisburseLoan)
+			r.With(can(model.PermissionRecordRepayment)).Post("/repayments", loanHandler.RecordRepayment)
+			r.With(can(model.PermissionMarkDefault)).Patch("/default", loanHandler.MarkDefault)
+		})
+		r.With(can(model.PermissionViewLoans)).Get("/investors/{investorId}/payouts", loanHandler.GetInvestorPayouts)
+		r.With(can(model.PermissionViewLoans)).Get("/documents/{docId}", documentHandler.GetDocument)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(can(model.PermissionManageWebhooks))
+			r.Get("/", webhookHandler.ListSubscriptions)
+			r.Post("/", webhookHandler.CreateSubscription)
+			r.Route("/{id}", func(r chi.Router) {
+				r.Delete("/", webhookHandler.DeleteSubscription)
+				r.Get("/deliveries", webhookHandler.ListDeliveries)
+				r.Get("/deliveries/{deliveryId}", webhookHandler.GetDelivery)
+				r.Post("/deliveries/{deliveryId}/replay", webhookHandler.ReplayDelivery)
+			})
+		})
+
+		r.With(can(model.PermissionManageNotifications)).Get("/admin/notifications/preview", notificationHandler.PreviewNotification)
+
+		r.Route("/users", func(r chi.Router) {
+			r.Use(can(model.PermissionManageUsers))
+			r.Get("/", userHandler.ListUsers)
+			r.Post("/", userHandler.CreateUser)
+			r.Patch("/{id}", userHandler.UpdateUser)
 		})
 	})
 
@@ -82,6 +213,7 @@ func main() {
 
 	<-done
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	// Graceful shutdown with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -93,3 +225,51 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
+// newDocumentStore builds the document store selected by DOCUMENT_STORE.
+func newDocumentStore(cfg *config.Config) (storage.DocumentStore, error) {
+	switch cfg.DocumentStore {
+	case "local":
+		return storage.NewLocalStore(cfg.DocumentDir)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+			PresignTTL:      cfg.S3PresignTTL,
+		}, &http.Client{Timeout: 30 * time.Second})
+	default:
+		return nil, fmt.Errorf("unknown document store %q", cfg.DocumentStore)
+	}
+}
+
+func newNotificationChannel(cfg *config.Config) (notification.Channel, error) {
+	from := model.Recipient{Name: cfg.EmailSenderName, Email: cfg.EmailSenderAddress}
+	switch cfg.Notifier {
+	case "sendgrid":
+		return notification.NewSendGridChannel(cfg.SendgridAPIKey, from), nil
+	case "smtp":
+		return notification.NewSMTPChannel(notification.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     from,
+			Timeout:  cfg.SMTPTimeout,
+		}), nil
+	case "log":
+		if cfg.NotificationLogFile == "" {
+			return notification.NewLogChannel(os.Stdout), nil
+		}
+		f, err := os.OpenFile(cfg.NotificationLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return notification.NewLogChannel(f), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Notifier)
+	}
+}
@@ -2,9 +2,9 @@ package middleware
 
 import (
 	"context"
-	"crypto/subtle"
-	"encoding/base64"
-	"loan-engine/config"
+	"errors"
+	"loan-engine/model"
+	"log"
 	"net/http"
 	"strings"
 )
@@ -34,43 +34,63 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
-func BasicAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			w.Header().Set("WWW-Authenticate", `Basic realm="restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// Authenticator checks a username and password, returning
+// model.ErrInvalidCredentials when they do not match an active user.
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*model.User, error)
+}
 
-		const prefix = "Basic "
-		if !strings.HasPrefix(auth, prefix) {
-			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-			return
-		}
+// BasicAuth authenticates requests with the HTTP Basic credentials of a user
+// and puts the user into the request context.
+func BasicAuth(users Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="restricted"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		payload, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
-		if err != nil {
-			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-			return
-		}
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+				return
+			}
 
-		pair := strings.SplitN(string(payload), ":", 2)
-		if len(pair) != 2 {
-			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-			return
-		}
-		cfg := config.LoadConfig()
+			user, err := users.Authenticate(r.Context(), username, password)
+			if errors.Is(err, model.ErrInvalidCredentials) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to authenticate %q: %v", username, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
 
-		expectedUsername := cfg.AuthUsername
-		expectedPassword := cfg.AuthPassword
+			ctx := model.ContextWithUser(r.Context(), user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-		if subtle.ConstantTimeCompare([]byte(pair[0]), []byte(expectedUsername)) != 1 ||
-			subtle.ConstantTimeCompare([]byte(pair[1]), []byte(expectedPassword)) != 1 {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// RequirePermission only lets through authenticated users whose roles grant
+// the permission. It goes after BasicAuth.
+func RequirePermission(p model.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := model.UserFromContext(r.Context())
+			if user == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !user.Can(p) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,86 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"loan-engine/middleware"
+	"loan-engine/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticAuthenticator knows users by "username:password".
+type staticAuthenticator map[string]*model.User
+
+func (a staticAuthenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	if username == "broken" {
+		return nil, errors.New("connection refused")
+	}
+	user, ok := a[username+":"+password]
+	if !ok {
+		return nil, model.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func TestBasicAuthAndPermissions(t *testing.T) {
+	users := staticAuthenticator{
+		"validator:validator-password": {ID: "user-1", Roles: []model.Role{model.RoleFieldValidator}},
+		"investor:investor-password":   {ID: "user-2", Roles: []model.Role{model.RoleInvestor}},
+	}
+	var actor string
+	h := middleware.BasicAuth(users)(middleware.RequirePermission(model.PermissionApproveLoan)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor = model.ActorFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	testCases := []struct {
+		name       string
+		username   string
+		password   string
+		noAuth     bool
+		wantStatus int
+	}{
+		{name: "Role grants the permission", username: "validator", password: "validator-password", wantStatus: http.StatusOK},
+		{name: "Role lacks the permission", username: "investor", password: "investor-password", wantStatus: http.StatusForbidden},
+		{name: "Wrong password", username: "validator", password: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "No credentials", noAuth: true, wantStatus: http.StatusUnauthorized},
+		{name: "Authenticator failure", username: "broken", password: "x", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actor = ""
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/loans/loan-123/approve", nil)
+			if !tc.noAuth {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, "user-1", actor)
+			} else {
+				assert.Empty(t, actor)
+			}
+		})
+	}
+}
+
+func TestRequirePermissionWithoutUser(t *testing.T) {
+	h := middleware.RequirePermission(model.PermissionViewLoans)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/loans", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
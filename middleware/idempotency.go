@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"loan-engine/handler"
+	"loan-engine/model"
+	"loan-engine/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeyLength is the longest key idempotency_keys.key can hold.
+const MaxIdempotencyKeyLength = 255
+
+// Idempotency replays the recorded response when a mutating request is retried
+// with the same Idempotency-Key header, and rejects reuse of a key with a
+// different request with 409 Conflict. Keys are scoped per authenticated user,
+// so it must run after the authentication middleware.
+func Idempotency(store repository.IdempotencyRepositoryInterface, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > MaxIdempotencyKeyLength {
+				handler.JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, MaxIdempotencyKeyLength))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				handler.JSONErrorResponse(w, http.StatusBadRequest, "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record := &model.IdempotencyRecord{
+				Key:         key,
+				ActorID:     model.ActorFromContext(r.Context()),
+				RequestHash: requestHash(r, body),
+			}
+
+			claimed, err := store.Claim(r.Context(), record, ttl)
+			if err != nil {
+				log.Printf("Failed to claim idempotency key %s: %v", key, err)
+				handler.JSONErrorResponse(w, http.StatusInternalServerError, "failed to process idempotency key")
+				return
+			}
+
+			if !claimed {
+				replay(w, r, store, record)
+				return
+			}
+
+			// The claim must be settled even when the client has gone away
+			storeCtx := context.WithoutCancel(r.Context())
+			release := func() {
+				if err := store.Release(storeCtx, record.ActorID, key); err != nil {
+					log.Printf("Failed to release idempotency key %s: %v", key, err)
+				}
+			}
+
+			// A panicking handler must not leave the key in progress until it expires
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			recorder := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			// Responses asking the client to retry are not remembered, or
+			// the retry would only get them replayed
+			if isRetryable(recorder.status, recorder.body.Bytes()) {
+				release()
+				return
+			}
+
+			record.StatusCode = recorder.status
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.ResponseBody = recorder.body.Bytes()
+			if err := store.Complete(storeCtx, record); err != nil {
+				log.Printf("Failed to record response for idempotency key %s: %v", key, err)
+			}
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, store repository.IdempotencyRepositoryInterface, record *model.IdempotencyRecord) {
+	existing, err := store.Get(r.Context(), record.ActorID, record.Key)
+	if err != nil {
+		if errors.Is(err, repository.ErrIdempotencyKeyNotFound) {
+			handler.JSONErrorResponse(w, http.StatusConflict, "request with this idempotency key was just released, retry")
+			return
+		}
+		log.Printf("Failed to get idempotency key %s: %v", record.Key, err)
+		handler.JSONErrorResponse(w, http.StatusInternalServerError, "failed to process idempotency key")
+		return
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		handler.JSONErrorResponse(w, http.StatusConflict, "idempotency key was already used with a different request")
+		return
+	}
+
+	if !existing.IsCompleted() {
+		handler.JSONErrorResponse(w, http.StatusConflict, "request with this idempotency key is still in progress")
+		return
+	}
+
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.ResponseBody)
+}
+
+// isRetryable reports whether the response is a transient failure: a server
+// error, a timeout, rate limiting or a conflicting concurrent update.
+func isRetryable(status int, body []byte) bool {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return true
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	case status == http.StatusConflict:
+		var resp handler.ErrorResponse
+		return json.Unmarshal(body, &resp) == nil && resp.ErrorCode == handler.ErrorCodeConcurrentModification
+	default:
+		return false
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter passes the response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
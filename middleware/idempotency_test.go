@@ -0,0 +1,192 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"loan-engine/handler"
+	"loan-engine/middleware"
+	"loan-engine/model"
+	"loan-engine/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryIdempotencyStore is an in-memory IdempotencyRepositoryInterface for tests.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]model.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]model.IdempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) Claim(ctx context.Context, record *model.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[record.ActorID+"/"+record.Key]; ok {
+		return false, nil
+	}
+	s.records[record.ActorID+"/"+record.Key] = *record
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) Get(ctx context.Context, actorID, key string) (*model.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[actorID+"/"+key]
+	if !ok {
+		return nil, repository.ErrIdempotencyKeyNotFound
+	}
+	return &record, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, record *model.IdempotencyRecord) error {
+	// Like the database, refuse to write for a canceled request
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	record.CompletedAt = &now
+	s.records[record.ActorID+"/"+record.Key] = *record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, actorID, key string) error {
+	// Like the database, refuse to write for a canceled request
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, actorID+"/"+key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	status := http.StatusCreated
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"status":"success","data":"loan-123"}`)
+	})
+	h := middleware.Idempotency(newMemoryIdempotencyStore(), time.Hour)(next)
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/loans", strings.NewReader(body))
+		req = req.WithContext(model.ContextWithActor(req.Context(), "user"))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Replays the original response", func(t *testing.T) {
+		first := send("key-1", `{"borrower_id":"1"}`)
+		second := send("key-1", `{"borrower_id":"1"}`)
+
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Rejects reuse with a different body", func(t *testing.T) {
+		rec := send("key-1", `{"borrower_id":"2"}`)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Does not remember server errors", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		send("key-2", `{}`)
+		status = http.StatusCreated
+		rec := send("key-2", `{}`)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Does not remember concurrent modifications", func(t *testing.T) {
+		store := newMemoryIdempotencyStore()
+		conflict := true
+		h := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conflict {
+				handler.JSONErrorResponseWithCode(w, http.StatusConflict, handler.ErrorCodeConcurrentModification, "loan was modified concurrently")
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		send := func() int {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/loans/loan-123/invest", strings.NewReader(`{}`))
+			req = req.WithContext(model.ContextWithActor(req.Context(), "user"))
+			req.Header.Set(middleware.IdempotencyKeyHeader, "key-5")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusConflict, send())
+		conflict = false
+		assert.Equal(t, http.StatusCreated, send())
+	})
+
+	t.Run("Rejects keys longer than the column", func(t *testing.T) {
+		rec := send(strings.Repeat("k", middleware.MaxIdempotencyKeyLength+1), `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Requests without key pass through", func(t *testing.T) {
+		send("", `{}`)
+		send("", `{}`)
+
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("Records the response when the client goes away", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(model.ContextWithActor(context.Background(), "user"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/loans", strings.NewReader(`{"borrower_id":"3"}`)).WithContext(ctx)
+		req.Header.Set(middleware.IdempotencyKeyHeader, "key-3")
+		store := newMemoryIdempotencyStore()
+		h := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			w.WriteHeader(http.StatusCreated)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		record, err := store.Get(context.Background(), "user", "key-3")
+		assert.NoError(t, err)
+		assert.True(t, record.IsCompleted())
+	})
+
+	t.Run("Releases the key when the handler panics", func(t *testing.T) {
+		store := newMemoryIdempotencyStore()
+		h := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/loans", strings.NewReader(`{}`))
+		req = req.WithContext(model.ContextWithActor(req.Context(), "user"))
+		req.Header.Set(middleware.IdempotencyKeyHeader, "key-4")
+
+		assert.PanicsWithValue(t, "boom", func() { h.ServeHTTP(httptest.NewRecorder(), req) })
+		_, err := store.Get(context.Background(), "user", "key-4")
+		assert.ErrorIs(t, err, repository.ErrIdempotencyKeyNotFound)
+	})
+}
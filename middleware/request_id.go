@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"loan-engine/model"
+	"net/http"
+	"regexp"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern accepts the IDs callers commonly send, such as UUIDs, and
+// fits the request_id column of the transition audit.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,255}$`)
+
+// RequestID propagates the caller's X-Request-ID, or generates one, into the
+// request context. An ID that is too long or has other characters than
+// letters, digits, ".", "_", ":" and "-" is replaced by a generated one.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := model.ContextWithRequestID(r.Context(), requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
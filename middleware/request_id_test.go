@@ -0,0 +1,49 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"loan-engine/middleware"
+	"loan-engine/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "UUID is kept", header: "3f2b8c1e-7d4a-4e9b-a1c2-5f6e7d8c9b0a", keep: true},
+		{name: "Longest accepted ID is kept", header: strings.Repeat("a", 255), keep: true},
+		{name: "Missing ID is generated", header: ""},
+		{name: "Too long ID is replaced", header: strings.Repeat("a", 256)},
+		{name: "ID with spaces is replaced", header: "abc def"},
+		{name: "ID with control characters is replaced", header: "abc\x1b[31m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = model.RequestIDFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/loans", nil)
+			req.Header.Set(middleware.RequestIDHeader, tt.header)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, got, rec.Header().Get(middleware.RequestIDHeader))
+			if tt.keep {
+				assert.Equal(t, tt.header, got)
+			} else {
+				assert.Len(t, got, 32)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE loans ADD COLUMN product VARCHAR(50) NOT NULL DEFAULT 'standard';
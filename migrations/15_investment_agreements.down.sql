@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_documents_investment_id;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS investment_id;
@@ -0,0 +1,3 @@
+ALTER TABLE documents ADD COLUMN investment_id UUID REFERENCES loan_investments(id);
+
+CREATE INDEX idx_documents_investment_id ON documents(investment_id);
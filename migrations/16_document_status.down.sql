@@ -0,0 +1,3 @@
+ALTER TABLE loans
+    DROP COLUMN IF EXISTS document_status,
+    DROP COLUMN IF EXISTS document_error;
@@ -0,0 +1,5 @@
+ALTER TABLE loans
+    ADD COLUMN document_status VARCHAR(20),
+    ADD COLUMN document_error TEXT;
+
+UPDATE loans SET document_status = 'generated' WHERE agreement_letter_url IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE loans DROP COLUMN IF EXISTS borrower_email;
+ALTER TABLE loans DROP COLUMN IF EXISTS borrower_name;
@@ -0,0 +1,2 @@
+ALTER TABLE loans ADD COLUMN borrower_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE loans ADD COLUMN borrower_email VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE loan_investments DROP COLUMN IF EXISTS locale;
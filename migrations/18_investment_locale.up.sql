@@ -0,0 +1 @@
+ALTER TABLE loan_investments ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
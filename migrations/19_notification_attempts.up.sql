@@ -0,0 +1,18 @@
+CREATE TABLE notification_attempts (
+    id UUID PRIMARY KEY,
+    loan_id UUID NOT NULL REFERENCES loans(id),
+    investment_id UUID REFERENCES loan_investments(id),
+    type VARCHAR(50) NOT NULL,
+    recipient_email VARCHAR(255) NOT NULL,
+    locale VARCHAR(35) NOT NULL DEFAULT '',
+    -- The notification as sent, to resend it
+    payload JSONB NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    provider_message_id VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    error TEXT,
+    resent_from UUID REFERENCES notification_attempts(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notification_attempts_loan_id ON notification_attempts(loan_id, created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_loans_created_at_id;
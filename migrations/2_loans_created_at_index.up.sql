@@ -0,0 +1 @@
+CREATE INDEX idx_loans_created_at_id ON loans(created_at, id);
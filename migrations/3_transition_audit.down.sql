@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_loan_state_transitions_loan_id;
+
+ALTER TABLE loan_state_transitions
+    DROP COLUMN IF EXISTS payload,
+    DROP COLUMN IF EXISTS request_id,
+    DROP COLUMN IF EXISTS actor_id;
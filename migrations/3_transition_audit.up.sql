@@ -0,0 +1,6 @@
+ALTER TABLE loan_state_transitions
+    ADD COLUMN actor_id VARCHAR(255),
+    ADD COLUMN request_id VARCHAR(255),
+    ADD COLUMN payload JSONB;
+
+CREATE INDEX idx_loan_state_transitions_loan_id ON loan_state_transitions(loan_id);
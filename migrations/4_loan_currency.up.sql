@@ -0,0 +1 @@
+ALTER TABLE loans ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS loan_installments;
+
+ALTER TABLE loans
+    DROP COLUMN IF EXISTS interest_method,
+    DROP COLUMN IF EXISTS repayment_frequency,
+    DROP COLUMN IF EXISTS tenor;
@@ -0,0 +1,23 @@
+ALTER TABLE loans
+    ADD COLUMN tenor INT NOT NULL DEFAULT 12,
+    ADD COLUMN repayment_frequency VARCHAR(20) NOT NULL DEFAULT 'monthly',
+    ADD COLUMN interest_method VARCHAR(20) NOT NULL DEFAULT 'flat';
+
+CREATE TABLE loan_installments (
+    id UUID PRIMARY KEY,
+    loan_id UUID REFERENCES loans(id) NOT NULL,
+    number INT NOT NULL,
+    due_date TIMESTAMP NOT NULL,
+    principal DECIMAL(15,2) NOT NULL,
+    interest DECIMAL(15,2) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (loan_id, number)
+);
+
+CREATE TRIGGER trigger_set_updated_at_loan_installments
+BEFORE UPDATE ON loan_installments
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
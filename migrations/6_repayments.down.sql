@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS loan_repayment_allocations;
+DROP TABLE IF EXISTS loan_repayments;
+
+ALTER TABLE loan_installments
+    DROP COLUMN IF EXISTS paid_fee,
+    DROP COLUMN IF EXISTS paid_interest,
+    DROP COLUMN IF EXISTS paid_principal,
+    DROP COLUMN IF EXISTS fee;
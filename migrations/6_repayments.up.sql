@@ -0,0 +1,26 @@
+ALTER TABLE loan_installments
+    ADD COLUMN fee DECIMAL(15,2) NOT NULL DEFAULT 0,
+    ADD COLUMN paid_principal DECIMAL(15,2) NOT NULL DEFAULT 0,
+    ADD COLUMN paid_interest DECIMAL(15,2) NOT NULL DEFAULT 0,
+    ADD COLUMN paid_fee DECIMAL(15,2) NOT NULL DEFAULT 0;
+
+CREATE TABLE loan_repayments (
+    id UUID PRIMARY KEY,
+    loan_id UUID REFERENCES loans(id) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    paid_at TIMESTAMP NOT NULL,
+    reference VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE loan_repayment_allocations (
+    id SERIAL PRIMARY KEY,
+    repayment_id UUID REFERENCES loan_repayments(id) NOT NULL,
+    installment_id UUID REFERENCES loan_installments(id) NOT NULL,
+    fee DECIMAL(15,2) NOT NULL,
+    interest DECIMAL(15,2) NOT NULL,
+    principal DECIMAL(15,2) NOT NULL
+);
+
+CREATE INDEX idx_loan_repayments_loan_id ON loan_repayments(loan_id);
+CREATE INDEX idx_loan_repayment_allocations_repayment_id ON loan_repayment_allocations(repayment_id);
@@ -0,0 +1,14 @@
+CREATE TABLE loan_investor_payouts (
+    id UUID PRIMARY KEY,
+    loan_id UUID REFERENCES loans(id) NOT NULL,
+    repayment_id UUID REFERENCES loan_repayments(id) NOT NULL,
+    investment_id UUID REFERENCES loan_investments(id) NOT NULL,
+    investor_id VARCHAR(50) NOT NULL,
+    principal DECIMAL(15,2) NOT NULL,
+    roi DECIMAL(15,2) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_loan_investor_payouts_loan_id ON loan_investor_payouts(loan_id);
+CREATE INDEX idx_loan_investor_payouts_investor_id ON loan_investor_payouts(investor_id);
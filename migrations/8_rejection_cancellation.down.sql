@@ -0,0 +1,9 @@
+ALTER TABLE loan_investments
+    DROP COLUMN IF EXISTS status;
+
+ALTER TABLE loans
+    DROP COLUMN IF EXISTS cancellation_date,
+    DROP COLUMN IF EXISTS cancellation_reason,
+    DROP COLUMN IF EXISTS rejection_date,
+    DROP COLUMN IF EXISTS rejection_reason,
+    DROP COLUMN IF EXISTS rejection_validator_id;
@@ -0,0 +1,9 @@
+ALTER TABLE loans
+    ADD COLUMN rejection_validator_id VARCHAR(50),
+    ADD COLUMN rejection_reason TEXT,
+    ADD COLUMN rejection_date TIMESTAMP,
+    ADD COLUMN cancellation_reason TEXT,
+    ADD COLUMN cancellation_date TIMESTAMP;
+
+ALTER TABLE loan_investments
+    ADD COLUMN status VARCHAR(50) NOT NULL DEFAULT 'active';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_loans_state_funding_deadline;
+
+ALTER TABLE loans DROP COLUMN IF EXISTS funding_deadline;
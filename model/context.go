@@ -0,0 +1,46 @@
+package model
+
+import "context"
+
+type contextKey string
+
+const (
+	actorContextKey     contextKey = "actor_id"
+	userContextKey      contextKey = "user"
+	requestIDContextKey contextKey = "request_id"
+)
+
+// ContextWithActor returns a copy of ctx carrying the authenticated user ID.
+func ContextWithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actorID)
+}
+
+// ActorFromContext returns the authenticated user ID stored in ctx, if any.
+func ActorFromContext(ctx context.Context) string {
+	actorID, _ := ctx.Value(actorContextKey).(string)
+	return actorID
+}
+
+// ContextWithUser returns a copy of ctx carrying the authenticated user, whose
+// ID is also the actor.
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, user)
+	return ContextWithActor(ctx, user.ID)
+}
+
+// UserFromContext returns the authenticated user stored in ctx, if any.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey).(*User)
+	return user
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
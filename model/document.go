@@ -0,0 +1,100 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrDocumentLinkInvalid is returned for a download link with a wrong or expired signature.
+var ErrDocumentLinkInvalid = errors.New("document link is invalid or expired")
+
+type DocumentKind string
+
+const (
+	DocumentLoanAgreement DocumentKind = "loan_agreement"
+	// DocumentInvestmentAgreement is the agreement letter of a single investment.
+	DocumentInvestmentAgreement DocumentKind = "investment_agreement"
+)
+
+// DocumentStatus tracks the generation of the agreements of a fully funded
+// loan. It is empty until the loan is fully funded.
+type DocumentStatus string
+
+const (
+	DocumentsPending   DocumentStatus = "pending"
+	DocumentsGenerated DocumentStatus = "generated"
+	// DocumentsFailed means the last attempt failed; the job is retried by the outbox dispatcher.
+	DocumentsFailed DocumentStatus = "failed"
+)
+
+// AgreementRequest is the payload of EventTypeAgreementsRequested.
+type AgreementRequest struct {
+	// Reason is "invested" when the loan got fully funded or "regenerate".
+	Reason    string `json:"reason"`
+	ActorID   string `json:"actor_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Document is a generated file kept in the document store.
+type Document struct {
+	ID           string       `json:"id"`
+	LoanID       string       `json:"loan_id"`
+	InvestmentID string       `json:"investment_id,omitempty"` // set on investment agreements
+	Kind         DocumentKind `json:"kind"`
+	StorageKey   string       `json:"-"`
+	ContentType  string       `json:"content_type"`
+	Size         int64        `json:"size"`
+	SHA256       string       `json:"sha256"`
+	CreatedAt    time.Time    `json:"created_at"`
+	// DownloadURL is a time-limited link to the content, filled in when listing.
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// NewDocument describes body as a document of the loan. The storage key
+// embeds the content hash, so a regenerated document never overwrites an
+// earlier version.
+func NewDocument(loanID string, kind DocumentKind, contentType, extension string, body []byte) *Document {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	return &Document{
+		LoanID:      loanID,
+		Kind:        kind,
+		StorageKey:  fmt.Sprintf("loans/%s/%s-%s.%s", loanID, kind, hash[:12], extension),
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		SHA256:      hash,
+	}
+}
+
+// ETag returns the strong entity tag of the document content.
+func (d *Document) ETag() string {
+	return `"` + d.SHA256 + `"`
+}
+
+// SignDocumentLink returns the hex HMAC-SHA256 of "<document id>.<expires>" keyed with secret.
+func SignDocumentLink(secret, documentID string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(documentID))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDocumentLink checks a signature produced by SignDocumentLink in
+// constant time and rejects links whose expiry is before now.
+func VerifyDocumentLink(secret, documentID string, expires int64, signature string, now time.Time) error {
+	expected := SignDocumentLink(secret, documentID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrDocumentLinkInvalid
+	}
+	if now.Unix() > expires {
+		return ErrDocumentLinkInvalid
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package model_test
+
+import (
+	"loan-engine/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDocument(t *testing.T) {
+	doc := model.NewDocument("loan-123", model.DocumentLoanAgreement, "application/pdf", "pdf", []byte("agreement"))
+
+	assert.Equal(t, "loan-123", doc.LoanID)
+	assert.Equal(t, int64(9), doc.Size)
+	assert.Len(t, doc.SHA256, 64)
+	assert.True(t, strings.HasPrefix(doc.StorageKey, "loans/loan-123/loan_agreement-"+doc.SHA256[:12]))
+	assert.Equal(t, `"`+doc.SHA256+`"`, doc.ETag())
+
+	other := model.NewDocument("loan-123", model.DocumentLoanAgreement, "application/pdf", "pdf", []byte("amended agreement"))
+	assert.NotEqual(t, doc.StorageKey, other.StorageKey)
+}
+
+func TestVerifyDocumentLink(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour).Unix()
+	signature := model.SignDocumentLink("secret", "doc-1", expires)
+
+	testCases := []struct {
+		name        string
+		documentID  string
+		expires     int64
+		signature   string
+		now         time.Time
+		expectError bool
+	}{
+		{name: "Valid link", documentID: "doc-1", expires: expires, signature: signature, now: now},
+		{name: "Expired link", documentID: "doc-1", expires: expires, signature: signature, now: now.Add(2 * time.Hour), expectError: true},
+		{name: "Other document", documentID: "doc-2", expires: expires, signature: signature, now: now, expectError: true},
+		{name: "Extended expiry", documentID: "doc-1", expires: expires + 3600, signature: signature, now: now, expectError: true},
+		{name: "Tampered signature", documentID: "doc-1", expires: expires, signature: strings.Repeat("0", 64), now: now, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := model.VerifyDocumentLink("secret", tc.documentID, tc.expires, tc.signature, tc.now)
+			if tc.expectError {
+				assert.ErrorIs(t, err, model.ErrDocumentLinkInvalid)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidTransition is matched by errors for events that are not allowed in the loan's current state.
+	ErrInvalidTransition = errors.New("invalid transition")
+	// ErrValidationFailed is matched by errors for loan data rejected by an event rule.
+	ErrValidationFailed = errors.New("validation failed")
+	// ErrForbidden is matched by errors for actions the authenticated user may not perform.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// TransitionError reports an event that is not allowed in the current state.
+type TransitionError struct {
+	State LoanState
+	Event LoanEvent
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("event %s not allowed in state %s", e.Event, e.State)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// ValidationError reports an event rule rejecting the loan data.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("state decision failed: %v", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidationFailed
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// IdempotencyRecord remembers the response of a mutating request sent with an Idempotency-Key header.
+type IdempotencyRecord struct {
+	Key          string
+	ActorID      string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	CompletedAt  *time.Time
+}
+
+// IsCompleted reports whether the original request finished and its response was recorded.
+func (r *IdempotencyRecord) IsCompleted() bool {
+	return r.CompletedAt != nil
+}
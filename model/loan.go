@@ -2,21 +2,42 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type InvestmentStatus string
+
+const (
+	InvestmentActive     InvestmentStatus = "active"
+	InvestmentRefundable InvestmentStatus = "refundable"
+	InvestmentRefunded   InvestmentStatus = "refunded"
+	InvestmentWithdrawn  InvestmentStatus = "withdrawn"
+)
+
+// DefaultFundingPeriod is how long an approved loan stays open for investment when no deadline is given.
+const DefaultFundingPeriod = 30 * 24 * time.Hour
+
+// DefaultProduct is used when a loan is proposed without an explicit product.
+const DefaultProduct = "standard"
+
 type Investment struct {
-	InvestorID string    `json:"investor_id"`
-	Name       string    `json:"name"`
-	Email      string    `json:"email"`
-	Amount     float64   `json:"amount"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         string `json:"id"`
+	InvestorID string `json:"investor_id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	// Locale selects the language of the investor's notifications, DefaultLocale when empty
+	Locale    string           `json:"locale,omitempty"`
+	Amount    Money            `json:"amount"`
+	Status    InvestmentStatus `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
 }
 
 type Approval struct {
 	FieldValidatorID sql.NullString `json:"field_validator_id"`
 	ProofImageURL    sql.NullString `json:"proof_image_url"`
 	ApprovalDate     sql.NullTime   `json:"approval_date"`
+	FundingDeadline  sql.NullTime   `json:"funding_deadline"`
 }
 
 type Disbursement struct {
@@ -25,62 +46,197 @@ type Disbursement struct {
 	DisbursementDate         sql.NullTime   `json:"disbursement_date"`
 }
 
+// MarshalJSON renders the nullable approval columns as plain JSON values.
+func (a Approval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FieldValidatorID *string    `json:"field_validator_id"`
+		ProofImageURL    *string    `json:"proof_image_url"`
+		ApprovalDate     *time.Time `json:"approval_date"`
+		FundingDeadline  *time.Time `json:"funding_deadline"`
+	}{
+		FieldValidatorID: nullStringPtr(a.FieldValidatorID),
+		ProofImageURL:    nullStringPtr(a.ProofImageURL),
+		ApprovalDate:     nullTimePtr(a.ApprovalDate),
+		FundingDeadline:  nullTimePtr(a.FundingDeadline),
+	})
+}
+
+// MarshalJSON renders the nullable disbursement columns as plain JSON values.
+func (d Disbursement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FieldOfficerID           *string    `json:"field_officer_id"`
+		SignedAgreementLetterURL *string    `json:"signed_agreement_letter_url"`
+		DisbursementDate         *time.Time `json:"disbursement_date"`
+	}{
+		FieldOfficerID:           nullStringPtr(d.FieldOfficerID),
+		SignedAgreementLetterURL: nullStringPtr(d.SignedAgreementLetterURL),
+		DisbursementDate:         nullTimePtr(d.DisbursementDate),
+	})
+}
+
+type Rejection struct {
+	FieldValidatorID sql.NullString `json:"field_validator_id"`
+	Reason           sql.NullString `json:"reason"`
+	RejectionDate    sql.NullTime   `json:"rejection_date"`
+}
+
+// MarshalJSON renders the nullable rejection columns as plain JSON values.
+func (r Rejection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FieldValidatorID *string    `json:"field_validator_id"`
+		Reason           *string    `json:"reason"`
+		RejectionDate    *time.Time `json:"rejection_date"`
+	}{
+		FieldValidatorID: nullStringPtr(r.FieldValidatorID),
+		Reason:           nullStringPtr(r.Reason),
+		RejectionDate:    nullTimePtr(r.RejectionDate),
+	})
+}
+
+type Cancellation struct {
+	Reason           sql.NullString `json:"reason"`
+	CancellationDate sql.NullTime   `json:"cancellation_date"`
+}
+
+// MarshalJSON renders the nullable cancellation columns as plain JSON values.
+func (c Cancellation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Reason           *string    `json:"reason"`
+		CancellationDate *time.Time `json:"cancellation_date"`
+	}{
+		Reason:           nullStringPtr(c.Reason),
+		CancellationDate: nullTimePtr(c.CancellationDate),
+	})
+}
+
 type Transition struct {
-	LoanID        string    `json:"loan_id"`
-	PreviousState LoanState `json:"previous_state"`
-	Event         LoanEvent `json:"event"`
-	NextState     LoanState `json:"next_state"`
+	ID             int64           `json:"id"`
+	LoanID         string          `json:"loan_id"`
+	PreviousState  LoanState       `json:"previous_state"`
+	Event          LoanEvent       `json:"event"`
+	NextState      LoanState       `json:"next_state"`
+	ActorID        string          `json:"actor_id,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	TransitionTime time.Time       `json:"transition_time"`
 }
 
 type Loan struct {
-	ID                    string    `json:"id"`
-	BorrowerID            string    `json:"borrower_id"`
-	PrincipalAmount       float64   `json:"principal_amount"`
-	Rate                  float64   `json:"rate"`
-	ROI                   float64   `json:"roi"`
-	State                 LoanState `json:"state"`
-	TotalInvestmentAmount float64   `json:"total_investment_amount,omitempty"`
-	Version               int       `json:"version"`
+	ID                    string             `json:"id"`
+	BorrowerID            string             `json:"borrower_id"`
+	BorrowerName          string             `json:"borrower_name,omitempty"`
+	BorrowerEmail         string             `json:"borrower_email,omitempty"`
+	PrincipalAmount       Money              `json:"principal_amount"`
+	Currency              string             `json:"currency"`
+	Rate                  float64            `json:"rate"`
+	ROI                   Money              `json:"roi"`
+	Tenor                 int                `json:"tenor"`
+	RepaymentFrequency    RepaymentFrequency `json:"repayment_frequency"`
+	InterestMethod        InterestMethod     `json:"interest_method"`
+	Product               string             `json:"product"`
+	State                 LoanState          `json:"state"`
+	TotalInvestmentAmount Money              `json:"total_investment_amount"`
+	Version               int                `json:"version"`
+	CreatedAt             time.Time          `json:"created_at"`
+	UpdatedAt             time.Time          `json:"updated_at"`
 
 	AgreementLetterURL sql.NullString `json:"agreement_letter_url"`
+	DocumentStatus     DocumentStatus `json:"document_status,omitempty"`
+	DocumentError      string         `json:"document_error,omitempty"`
 	NewInvestment      Investment     `json:"new_investment,omitempty"`
+	WithdrawInvestment Investment     `json:"withdraw_investment,omitempty"`
 	Approval           Approval       `json:"approval,omitempty"`
 	Investments        []Investment   `json:"investments,omitempty"`
 	Disbursement       Disbursement   `json:"disbursement,omitempty"`
+	Rejection          Rejection      `json:"rejection"`
+	Cancellation       Cancellation   `json:"cancellation"`
+	Installments       []Installment  `json:"installments,omitempty"`
+	NewRepayment       Repayment      `json:"new_repayment,omitempty"`
+	// ExpiryCheckedAt is the time the funding deadline is checked against
+	// when expiring the loan; only used while processing
+	ExpiryCheckedAt time.Time `json:"-"`
+	// DefaultCheckedAt is the time installments are checked for being overdue
+	// when marking the loan defaulted; only used while processing
+	DefaultCheckedAt time.Time `json:"-"`
+}
+
+// MarshalJSON renders the agreement URL as a plain JSON value and leaves out
+// the pending investment changes and repayment, which are only used while processing a request.
+func (a Loan) MarshalJSON() ([]byte, error) {
+	type loanAlias Loan
+	return json.Marshal(struct {
+		loanAlias
+		AgreementLetterURL *string     `json:"agreement_letter_url"`
+		NewInvestment      *Investment `json:"new_investment,omitempty"`
+		WithdrawInvestment *Investment `json:"withdraw_investment,omitempty"`
+		NewRepayment       *Repayment  `json:"new_repayment,omitempty"`
+	}{
+		loanAlias:          loanAlias(a),
+		AgreementLetterURL: nullStringPtr(a.AgreementLetterURL),
+	})
+}
+
+// InvestmentDelta returns how much the pending investment changes move the total investment amount.
+func (a *Loan) InvestmentDelta() Money {
+	return a.NewInvestment.Amount.Sub(a.WithdrawInvestment.Amount)
 }
 
 func (a *Loan) SetAgreementURL(agreementURL string) {
 	a.AgreementLetterURL = sql.NullString{String: agreementURL, Valid: true}
 }
 
+// Borrower returns the borrower as the recipient of notifications.
+func (a *Loan) Borrower() Recipient {
+	return Recipient{Name: a.BorrowerName, Email: a.BorrowerEmail}
+}
+
 type CreateLoanRequest struct {
-	BorrowerID      string  `json:"borrower_id"`
-	PrincipalAmount float64 `json:"principal_amount"`
+	BorrowerID string `json:"borrower_id"`
+	// BorrowerName and BorrowerEmail address the borrower's notifications; optional
+	BorrowerName    string  `json:"borrower_name"`
+	BorrowerEmail   string  `json:"borrower_email"`
+	PrincipalAmount Money   `json:"principal_amount"`
+	Currency        string  `json:"currency"`
 	Rate            float64 `json:"rate"`
-	ROI             float64 `json:"roi"`
+	ROI             Money   `json:"roi"`
+	// Tenor is the number of installments at the given repayment frequency
+	Tenor              int                `json:"tenor"`
+	RepaymentFrequency RepaymentFrequency `json:"repayment_frequency"`
+	InterestMethod     InterestMethod     `json:"interest_method"`
+	// Product selects the agreement template, DefaultProduct when empty
+	Product string `json:"product"`
 }
 
 type ApproveLoanRequest struct {
-	ValidatorID   string    `json:"validator_id"`
-	ProofImageURL string    `json:"proof_image_url"`
-	ApprovalDate  time.Time `json:"approval_date"`
-	LoanID        string
+	ValidatorID     string    `json:"validator_id"`
+	ProofImageURL   string    `json:"proof_image_url"`
+	ApprovalDate    time.Time `json:"approval_date"`
+	FundingDeadline time.Time `json:"funding_deadline"`
+	LoanID          string
 }
 
 func (a *ApproveLoanRequest) ToApproval() Approval {
+	fundingDeadline := a.FundingDeadline
+	if fundingDeadline.IsZero() && !a.ApprovalDate.IsZero() {
+		fundingDeadline = a.ApprovalDate.Add(DefaultFundingPeriod)
+	}
+
 	return Approval{
 		FieldValidatorID: sql.NullString{String: a.ValidatorID, Valid: true},
 		ProofImageURL:    sql.NullString{String: a.ProofImageURL, Valid: true},
 		ApprovalDate:     sql.NullTime{Time: a.ApprovalDate, Valid: true},
+		FundingDeadline:  sql.NullTime{Time: fundingDeadline, Valid: true},
 	}
 }
 
 type AddInvestmentRequest struct {
-	InvestorID string  `json:"investor_id"`
-	Name       string  `json:"name"`
-	Email      string  `json:"email"`
-	Amount     float64 `json:"amount"`
-	LoanID     string
+	InvestorID string `json:"investor_id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	// Locale is the investor's language, e.g. "id" or "en-GB"; optional
+	Locale string `json:"locale"`
+	Amount Money  `json:"amount"`
+	LoanID string
 }
 
 func (a *AddInvestmentRequest) ToInvestment() Investment {
@@ -88,8 +244,29 @@ func (a *AddInvestmentRequest) ToInvestment() Investment {
 		InvestorID: a.InvestorID,
 		Email:      a.Email,
 		Name:       a.Name,
+		Locale:     a.Locale,
 		Amount:     a.Amount,
+		Status:     InvestmentActive,
+	}
+}
+
+type WithdrawInvestmentRequest struct {
+	LoanID       string
+	InvestmentID string
+	// InvestorID is the investor withdrawing, who must own the investment;
+	// empty for withdrawals made on nobody's behalf
+	InvestorID string
+}
+
+// FilterInvestments returns the investments with the given status.
+func FilterInvestments(investments []Investment, status InvestmentStatus) []Investment {
+	var filtered []Investment
+	for _, inv := range investments {
+		if inv.Status == status {
+			filtered = append(filtered, inv)
+		}
 	}
+	return filtered
 }
 
 type DisburseLoanRequest struct {
@@ -107,6 +284,32 @@ func (a *DisburseLoanRequest) ToDisbursement() Disbursement {
 	}
 }
 
+type RejectLoanRequest struct {
+	ValidatorID string `json:"validator_id"`
+	Reason      string `json:"reason"`
+	LoanID      string
+}
+
+func (a *RejectLoanRequest) ToRejection() Rejection {
+	return Rejection{
+		FieldValidatorID: sql.NullString{String: a.ValidatorID, Valid: true},
+		Reason:           sql.NullString{String: a.Reason, Valid: true},
+		RejectionDate:    sql.NullTime{Time: time.Now(), Valid: true},
+	}
+}
+
+type CancelLoanRequest struct {
+	Reason string `json:"reason"`
+	LoanID string
+}
+
+func (a *CancelLoanRequest) ToCancellation() Cancellation {
+	return Cancellation{
+		Reason:           sql.NullString{String: a.Reason, Valid: true},
+		CancellationDate: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+}
+
 func isStringNullOrEmpty(ns sql.NullString) bool {
 	if !ns.Valid || ns.String == "" {
 		return true // NULL or empty
@@ -117,3 +320,17 @@ func isStringNullOrEmpty(ns sql.NullString) bool {
 func isTimeNullOrEmpty(nt sql.NullTime) bool {
 	return !nt.Valid || nt.Time.IsZero()
 }
+
+func nullStringPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func nullTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used when a loan is proposed without an explicit currency.
+const DefaultCurrency = "IDR"
+
+// moneyScale is the number of minor units in one major unit, matching the DECIMAL(15,2) columns.
+const moneyScale = 100
+
+var (
+	moneyPattern    = regexp.MustCompile(`^(-)?(\d+)(?:\.(\d{1,2}))?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+	errInvalidMoney = errors.New("invalid money amount, expected a decimal with at most 2 fraction digits")
+)
+
+// Money is an exact fixed-point amount stored in minor units (cents). It does
+// not know its currency: an amount is implicitly in the currency of the loan
+// it belongs to (Loan.Currency), and arithmetic and comparisons do not check
+// currencies. Only combine amounts of the same currency, e.g. of one loan.
+type Money struct {
+	minor int64
+}
+
+// NewMoney returns an amount of whole major units.
+func NewMoney(major int64) Money {
+	return Money{minor: major * moneyScale}
+}
+
+// MoneyFromMinor returns an amount expressed in minor units.
+func MoneyFromMinor(minor int64) Money {
+	return Money{minor: minor}
+}
+
+// ParseMoney parses a decimal string such as "1000", "0.1" or "-12.50".
+func ParseMoney(s string) (Money, error) {
+	match := moneyPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return Money{}, errInvalidMoney
+	}
+
+	fraction := match[3]
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	minor, err := strconv.ParseInt(match[2]+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errInvalidMoney
+	}
+	if match[1] == "-" {
+		minor = -minor
+	}
+
+	return Money{minor: minor}, nil
+}
+
+// MustParseMoney is like ParseMoney but panics on invalid input. It is meant for constants and tests.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{minor: m.minor + o.minor}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{minor: m.minor - o.minor}
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or greater than o.
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.minor < o.minor:
+		return -1
+	case m.minor > o.minor:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+// String formats the amount with exactly two fraction digits.
+func (m Money) String() string {
+	sign := ""
+	minor := m.minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/moneyScale, minor%moneyScale)
+}
+
+// Grouped formats the amount with the integer digits grouped by thousands,
+// e.g. Grouped(",", ".") gives "1,250,000.00" and Grouped(".", ",") "1.250.000,00".
+func (m Money) Grouped(thousands, decimal string) string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String() + decimal + fraction
+}
+
+// MarshalJSON encodes the amount as a JSON number without going through float64.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts either a JSON number or a quoted decimal string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = NewMoney(v)
+		return nil
+	case float64:
+		return m.scanString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+func (m *Money) scanString(s string) error {
+	// Postgres may render DECIMAL values with trailing zeros beyond the scale
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", s, err)
+	}
+	*m = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, sending the amount as an exact decimal string.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// IsValidCurrency reports whether code looks like an ISO 4217 currency code.
+func IsValidCurrency(code string) bool {
+	return currencyPattern.MatchString(code)
+}
@@ -0,0 +1,76 @@
+package model_test
+
+import (
+	"encoding/json"
+	"loan-engine/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    int64
+		expectError bool
+	}{
+		{input: "1000", expected: 100000},
+		{input: "0.1", expected: 10},
+		{input: "12.34", expected: 1234},
+		{input: "-12.5", expected: -1250},
+		{input: "1.234", expectError: true},
+		{input: "1e3", expectError: true},
+		{input: "abc", expectError: true},
+		{input: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := model.ParseMoney(tt.input)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m.Minor())
+		})
+	}
+}
+
+func TestMoneyGrouped(t *testing.T) {
+	assert.Equal(t, "1,250,000.00", model.MustParseMoney("1250000").Grouped(",", "."))
+	assert.Equal(t, "1.250.000,50", model.MustParseMoney("1250000.5").Grouped(".", ","))
+	assert.Equal(t, "-999.99", model.MustParseMoney("-999.99").Grouped(",", "."))
+	assert.Equal(t, "0.00", model.Money{}.Grouped(",", "."))
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var req model.AddInvestmentRequest
+	err := json.Unmarshal([]byte(`{"amount": 0.1}`), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), req.Amount.Minor())
+
+	err = json.Unmarshal([]byte(`{"amount": "250.75"}`), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(25075), req.Amount.Minor())
+
+	err = json.Unmarshal([]byte(`{"amount": 0.001}`), &req)
+	assert.Error(t, err)
+
+	data, err := json.Marshal(model.Investment{Amount: model.MustParseMoney("0.3")})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"amount":0.30`)
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m model.Money
+
+	assert.NoError(t, m.Scan([]byte("1500.50")))
+	assert.Equal(t, "1500.50", m.String())
+
+	assert.NoError(t, m.Scan("0.10"))
+	assert.Equal(t, int64(10), m.Minor())
+
+	assert.Error(t, m.Scan([]byte("not a number")))
+}
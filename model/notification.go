@@ -0,0 +1,182 @@
+package model
+
+import (
+	"regexp"
+	"time"
+)
+
+// NotificationType names a message sent to a borrower or an investor.
+type NotificationType string
+
+const (
+	// NotificationLoanApproved tells the borrower their loan is approved and open for investment.
+	NotificationLoanApproved NotificationType = "loan_approved"
+	// NotificationInvestmentConfirmed confirms an investment to its investor.
+	NotificationInvestmentConfirmed NotificationType = "investment_confirmed"
+	// NotificationInvestmentAgreement links the investor to their agreement letter.
+	NotificationInvestmentAgreement NotificationType = "investment_agreement"
+	// NotificationLoanDisbursed tells the borrower and the investors the loan is disbursed.
+	NotificationLoanDisbursed NotificationType = "loan_disbursed"
+	// NotificationFundingExpired tells an investor the loan expired and their investment is refundable.
+	NotificationFundingExpired NotificationType = "funding_expired"
+)
+
+// NotificationTypes lists every notification type.
+var NotificationTypes = []NotificationType{
+	NotificationLoanApproved,
+	NotificationInvestmentConfirmed,
+	NotificationInvestmentAgreement,
+	NotificationLoanDisbursed,
+	NotificationFundingExpired,
+}
+
+// IsKnownNotificationType reports whether t is one of NotificationTypes.
+func IsKnownNotificationType(t NotificationType) bool {
+	for _, known := range NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultLocale is the language of notifications to recipients without a
+// locale, or whose locale has no templates.
+const DefaultLocale = "en"
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// IsValidLocale reports whether locale looks like a language tag such as "id" or "en-GB".
+func IsValidLocale(locale string) bool {
+	return len(locale) <= 35 && localePattern.MatchString(locale)
+}
+
+// Recipient is the person a notification is addressed to.
+type Recipient struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Locale selects the language of the message, DefaultLocale when empty
+	Locale string `json:"locale,omitempty"`
+}
+
+// Notification is a message about a loan to one recipient. Which fields are
+// set depends on the type; use the constructors below.
+type Notification struct {
+	Type   NotificationType `json:"type"`
+	LoanID string           `json:"loan_id"`
+	To     Recipient        `json:"to"`
+	// InvestmentID is set on notifications to an investor about their investment
+	InvestmentID string `json:"investment_id,omitempty"`
+	Currency     string `json:"currency"`
+	// Amount is the principal for the borrower and the invested amount for an investor
+	Amount Money `json:"amount"`
+	// Date is when the approval, disbursement or expiry happened
+	Date time.Time `json:"date"`
+	// URL links the agreement letter
+	URL string `json:"url,omitempty"`
+}
+
+// NewLoanApprovedNotification tells the borrower the loan was approved.
+func NewLoanApprovedNotification(l *Loan) Notification {
+	return Notification{
+		Type:     NotificationLoanApproved,
+		LoanID:   l.ID,
+		To:       l.Borrower(),
+		Currency: l.Currency,
+		Amount:   l.PrincipalAmount,
+		Date:     l.Approval.ApprovalDate.Time,
+	}
+}
+
+// NewInvestmentConfirmedNotification confirms the investment to its investor.
+func NewInvestmentConfirmedNotification(l *Loan, investment Investment) Notification {
+	return investorNotification(NotificationInvestmentConfirmed, l, investment, investment.CreatedAt)
+}
+
+// NewInvestmentAgreementNotification sends the investor the link to their agreement letter.
+func NewInvestmentAgreementNotification(l *Loan, investment Investment, agreementURL string) Notification {
+	n := investorNotification(NotificationInvestmentAgreement, l, investment, time.Time{})
+	n.URL = agreementURL
+	return n
+}
+
+// NewLoanDisbursedNotifications tells the borrower and every investor on
+// l.Investments that the loan was disbursed.
+func NewLoanDisbursedNotifications(l *Loan) []Notification {
+	date := l.Disbursement.DisbursementDate.Time
+	notifications := []Notification{{
+		Type:     NotificationLoanDisbursed,
+		LoanID:   l.ID,
+		To:       l.Borrower(),
+		Currency: l.Currency,
+		Amount:   l.PrincipalAmount,
+		Date:     date,
+	}}
+	for _, investment := range l.Investments {
+		notifications = append(notifications, investorNotification(NotificationLoanDisbursed, l, investment, date))
+	}
+	return notifications
+}
+
+// NewFundingExpiredNotifications tells every investor on l.Investments that
+// the loan expired before it was fully funded.
+func NewFundingExpiredNotifications(l *Loan, date time.Time) []Notification {
+	var notifications []Notification
+	for _, investment := range l.Investments {
+		notifications = append(notifications, investorNotification(NotificationFundingExpired, l, investment, date))
+	}
+	return notifications
+}
+
+func investorNotification(t NotificationType, l *Loan, investment Investment, date time.Time) Notification {
+	return Notification{
+		Type:         t,
+		LoanID:       l.ID,
+		To:           Recipient{Name: investment.Name, Email: investment.Email, Locale: investment.Locale},
+		InvestmentID: investment.ID,
+		Currency:     l.Currency,
+		Amount:       investment.Amount,
+		Date:         date,
+	}
+}
+
+type NotificationStatus string
+
+const (
+	NotificationSent   NotificationStatus = "sent"
+	NotificationFailed NotificationStatus = "failed"
+)
+
+// NotificationAttempt records one attempt to deliver a notification.
+type NotificationAttempt struct {
+	ID           string           `json:"id"`
+	LoanID       string           `json:"loan_id"`
+	InvestmentID string           `json:"investment_id,omitempty"`
+	Type         NotificationType `json:"type"`
+	Recipient    Recipient        `json:"recipient"`
+	// Locale is the locale of the templates the message was rendered from
+	Locale string `json:"locale,omitempty"`
+	// Provider is the channel the message was handed to, e.g. "sendgrid"
+	Provider          string             `json:"provider"`
+	ProviderMessageID string             `json:"provider_message_id,omitempty"`
+	Status            NotificationStatus `json:"status"`
+	Error             string             `json:"error,omitempty"`
+	// ResentFrom is the ID of the attempt this one resends
+	ResentFrom string    `json:"resent_from,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Notification is what was sent, kept to resend it
+	Notification Notification `json:"-"`
+}
+
+// NewNotificationAttempt starts the record of sending n through the provider.
+func NewNotificationAttempt(n Notification, provider string) NotificationAttempt {
+	return NotificationAttempt{
+		LoanID:       n.LoanID,
+		InvestmentID: n.InvestmentID,
+		Type:         n.Type,
+		Recipient:    n.To,
+		Provider:     provider,
+		Notification: n,
+	}
+}
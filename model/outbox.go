@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEventType names a domain event published through the outbox.
+type OutboxEventType string
+
+const (
+	EventTypeLoanSubmitted   OutboxEventType = "loan.submitted"
+	EventTypeLoanApproved    OutboxEventType = "loan.approved"
+	EventTypeInvestmentAdded OutboxEventType = "investment.added"
+	EventTypeLoanInvested    OutboxEventType = "loan.invested"
+	EventTypeLoanDisbursed   OutboxEventType = "loan.disbursed"
+	EventTypeLoanExpired     OutboxEventType = "loan.expired"
+	// EventTypeAgreementsRequested asks for the agreements of a fully funded loan to be generated.
+	EventTypeAgreementsRequested OutboxEventType = "loan.agreements_requested"
+	// EventTypeAgreementsGenerated is published once the agreements are stored.
+	EventTypeAgreementsGenerated OutboxEventType = "loan.agreements_generated"
+	// EventTypeLoanTransitioned is published for every state transition, whatever the event.
+	EventTypeLoanTransitioned OutboxEventType = "loan.transitioned"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxDelivered OutboxStatus = "delivered"
+	// OutboxDead marks an event that failed too many times and is no longer retried.
+	OutboxDead OutboxStatus = "dead"
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the state
+// change it describes, then delivered by the dispatcher.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	EventType   OutboxEventType `json:"event_type"`
+	LoanID      string          `json:"loan_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      OutboxStatus    `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	AvailableAt time.Time       `json:"available_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+// LoanCursor marks the position of the last loan returned in a page.
+type LoanCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// Encode returns the opaque cursor string handed out to clients.
+func (c LoanCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeLoanCursor parses a cursor string produced by LoanCursor.Encode.
+func DecodeLoanCursor(s string) (*LoanCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var c LoanCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &c, nil
+}
+
+type LoanFilter struct {
+	State        LoanState
+	BorrowerID   string
+	MinPrincipal *Money
+	MaxPrincipal *Money
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	Sort         SortOrder
+	Cursor       *LoanCursor
+	Limit        int
+}
+
+type LoanPage struct {
+	Loans      []Loan `json:"loans"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
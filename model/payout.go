@@ -0,0 +1,139 @@
+package model
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// InvestorPayout is an investor's share of a borrower repayment.
+type InvestorPayout struct {
+	ID           string `json:"id"`
+	LoanID       string `json:"loan_id"`
+	RepaymentID  string `json:"repayment_id"`
+	InvestmentID string `json:"investment_id"`
+	InvestorID   string `json:"investor_id"`
+	Principal    Money  `json:"principal"`
+	ROI          Money  `json:"roi"`
+	Amount       Money  `json:"amount"`
+	// Currency is the loan's; an investor's payouts may span loans in different currencies
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PrincipalRepaid returns the principal already repaid across the installments.
+func PrincipalRepaid(installments []Installment) Money {
+	var total Money
+	for _, in := range installments {
+		total = total.Add(in.PaidPrincipal)
+	}
+	return total
+}
+
+// CalculatePayouts splits the principal of a repayment and the matching
+// portion of the loan ROI across the investors in proportion to their
+// investment amounts. The ROI portion is derived from the cumulative
+// principal repaid so the payouts add up to exactly Loan.ROI once the loan is
+// paid off. Rounding residue goes to the largest remainders, ties to the
+// earliest investment. Only active investments take part.
+func CalculatePayouts(l *Loan, repayment *Repayment, principalRepaidBefore Money) []InvestorPayout {
+	investments := FilterInvestments(l.Investments, InvestmentActive)
+	if len(investments) == 0 || l.PrincipalAmount.IsZero() {
+		return nil
+	}
+
+	var principal Money
+	for _, a := range repayment.Allocations {
+		principal = principal.Add(a.Principal)
+	}
+
+	principalRepaidAfter := principalRepaidBefore.Add(principal)
+	roi := proRata(l.ROI, principalRepaidAfter, l.PrincipalAmount).Sub(proRata(l.ROI, principalRepaidBefore, l.PrincipalAmount))
+
+	weights := make([]Money, len(investments))
+	for i, inv := range investments {
+		weights[i] = inv.Amount
+	}
+	principalShares := splitProRata(principal, weights)
+	roiShares := splitProRata(roi, weights)
+
+	payouts := make([]InvestorPayout, len(investments))
+	for i, inv := range investments {
+		payouts[i] = InvestorPayout{
+			LoanID:       l.ID,
+			RepaymentID:  repayment.ID,
+			InvestmentID: inv.ID,
+			InvestorID:   inv.InvestorID,
+			Principal:    principalShares[i],
+			ROI:          roiShares[i],
+			Amount:       principalShares[i].Add(roiShares[i]),
+			Currency:     l.Currency,
+		}
+	}
+
+	return payouts
+}
+
+// ExpectedReturns splits Loan.ROI across the active investments in
+// proportion to their amounts, keyed by investment ID. The returns add up to
+// exactly Loan.ROI.
+func ExpectedReturns(l *Loan) map[string]Money {
+	investments := FilterInvestments(l.Investments, InvestmentActive)
+
+	weights := make([]Money, len(investments))
+	for i, inv := range investments {
+		weights[i] = inv.Amount
+	}
+	shares := splitProRata(l.ROI, weights)
+
+	returns := make(map[string]Money, len(investments))
+	for i, inv := range investments {
+		returns[inv.ID] = shares[i]
+	}
+	return returns
+}
+
+// proRata returns total * part / whole rounded down to the minor unit.
+func proRata(total, part, whole Money) Money {
+	n := new(big.Int).Mul(big.NewInt(total.Minor()), big.NewInt(part.Minor()))
+	n.Quo(n, big.NewInt(whole.Minor()))
+	return MoneyFromMinor(n.Int64())
+}
+
+// splitProRata divides total by weights using the largest remainder method.
+func splitProRata(total Money, weights []Money) []Money {
+	var sum int64
+	for _, w := range weights {
+		sum += w.Minor()
+	}
+
+	shares := make([]Money, len(weights))
+	if sum == 0 {
+		return shares
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	allocated := int64(0)
+	for i, w := range weights {
+		n := new(big.Int).Mul(big.NewInt(total.Minor()), big.NewInt(w.Minor()))
+		q, r := new(big.Int).QuoRem(n, big.NewInt(sum), new(big.Int))
+		shares[i] = MoneyFromMinor(q.Int64())
+		remainders[i] = r
+		allocated += q.Int64()
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+
+	for i := int64(0); i < total.Minor()-allocated; i++ {
+		idx := order[i]
+		shares[idx] = shares[idx].Add(MoneyFromMinor(1))
+	}
+
+	return shares
+}
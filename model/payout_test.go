@@ -0,0 +1,103 @@
+package model_test
+
+import (
+	"loan-engine/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createFundedLoan() *model.Loan {
+	loan := createValidLoan()
+	loan.PrincipalAmount = model.NewMoney(1000)
+	loan.ROI = model.NewMoney(100)
+	loan.Investments = []model.Investment{
+		{ID: "investment-1", InvestorID: "investor-1", Amount: model.NewMoney(500), Status: model.InvestmentActive},
+		{ID: "investment-2", InvestorID: "investor-2", Amount: model.NewMoney(250), Status: model.InvestmentActive},
+		{ID: "investment-3", InvestorID: "investor-3", Amount: model.NewMoney(250), Status: model.InvestmentActive},
+	}
+	return loan
+}
+
+func repaymentOfPrincipal(principal model.Money) *model.Repayment {
+	return &model.Repayment{
+		ID:          "repayment-1",
+		Allocations: []model.RepaymentAllocation{{InstallmentID: "inst-1", Principal: principal}},
+	}
+}
+
+func TestCalculatePayoutsProRata(t *testing.T) {
+	loan := createFundedLoan()
+
+	payouts := model.CalculatePayouts(loan, repaymentOfPrincipal(model.NewMoney(100)), model.Money{})
+
+	assert.Len(t, payouts, 3)
+	assert.Equal(t, "investor-1", payouts[0].InvestorID)
+	assert.Equal(t, model.NewMoney(50), payouts[0].Principal)
+	assert.Equal(t, model.NewMoney(5), payouts[0].ROI)
+	assert.Equal(t, model.NewMoney(55), payouts[0].Amount)
+	assert.Equal(t, model.DefaultCurrency, payouts[0].Currency)
+	assert.Equal(t, model.MustParseMoney("27.50"), payouts[1].Amount)
+	assert.Equal(t, "repayment-1", payouts[2].RepaymentID)
+}
+
+func TestCalculatePayoutsRoundingResidue(t *testing.T) {
+	loan := createFundedLoan()
+	loan.Investments = []model.Investment{
+		{ID: "investment-1", InvestorID: "investor-1", Amount: model.MustParseMoney("333.33"), Status: model.InvestmentActive},
+		{ID: "investment-2", InvestorID: "investor-2", Amount: model.MustParseMoney("333.33"), Status: model.InvestmentActive},
+		{ID: "investment-3", InvestorID: "investor-3", Amount: model.MustParseMoney("333.34"), Status: model.InvestmentActive},
+	}
+
+	payouts := model.CalculatePayouts(loan, repaymentOfPrincipal(model.MustParseMoney("0.10")), model.Money{})
+
+	var total model.Money
+	for _, p := range payouts {
+		total = total.Add(p.Principal)
+	}
+	assert.Equal(t, model.MustParseMoney("0.10"), total)
+	assert.Equal(t, model.MustParseMoney("0.03"), payouts[0].Principal)
+	assert.Equal(t, model.MustParseMoney("0.03"), payouts[1].Principal)
+	assert.Equal(t, model.MustParseMoney("0.04"), payouts[2].Principal)
+}
+
+func TestCalculatePayoutsROISumsToLoanROI(t *testing.T) {
+	loan := createFundedLoan()
+
+	var totalROI model.Money
+	repaid := model.Money{}
+	for _, principal := range []string{"333.33", "333.33", "333.34"} {
+		p := model.MustParseMoney(principal)
+		for _, payout := range model.CalculatePayouts(loan, repaymentOfPrincipal(p), repaid) {
+			totalROI = totalROI.Add(payout.ROI)
+		}
+		repaid = repaid.Add(p)
+	}
+
+	assert.Equal(t, loan.ROI, totalROI)
+}
+
+func TestCalculatePayoutsSkipsWithdrawnInvestments(t *testing.T) {
+	loan := createFundedLoan()
+	loan.Investments = append(loan.Investments, model.Investment{
+		ID: "investment-4", InvestorID: "investor-4", Amount: model.NewMoney(100), Status: model.InvestmentWithdrawn,
+	})
+
+	payouts := model.CalculatePayouts(loan, repaymentOfPrincipal(model.NewMoney(100)), model.Money{})
+
+	assert.Len(t, payouts, 3)
+	assert.Equal(t, model.NewMoney(50), payouts[0].Principal)
+}
+
+func TestExpectedReturns(t *testing.T) {
+	loan := createFundedLoan()
+	loan.ROI = model.MustParseMoney("100.01")
+	loan.Investments = append(loan.Investments, model.Investment{ID: "investment-4", Amount: model.NewMoney(100), Status: model.InvestmentWithdrawn})
+
+	returns := model.ExpectedReturns(loan)
+
+	assert.Len(t, returns, 3)
+	assert.Equal(t, model.MustParseMoney("50.01"), returns["investment-1"])
+	assert.Equal(t, model.MustParseMoney("25.00"), returns["investment-2"])
+	assert.Equal(t, model.MustParseMoney("25.00"), returns["investment-3"])
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type Repayment struct {
+	ID          string                `json:"id"`
+	LoanID      string                `json:"loan_id"`
+	Amount      Money                 `json:"amount"`
+	PaidAt      time.Time             `json:"paid_at"`
+	Reference   string                `json:"reference,omitempty"`
+	Allocations []RepaymentAllocation `json:"allocations"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// RepaymentAllocation is the part of a repayment applied to a single installment.
+type RepaymentAllocation struct {
+	InstallmentID     string `json:"installment_id"`
+	InstallmentNumber int    `json:"installment_number"`
+	Fee               Money  `json:"fee"`
+	Interest          Money  `json:"interest"`
+	Principal         Money  `json:"principal"`
+}
+
+type RecordRepaymentRequest struct {
+	Amount    Money     `json:"amount"`
+	PaidAt    time.Time `json:"paid_at"`
+	Reference string    `json:"reference"`
+	LoanID    string
+}
+
+func (a *RecordRepaymentRequest) ToRepayment() Repayment {
+	return Repayment{
+		LoanID:    a.LoanID,
+		Amount:    a.Amount,
+		PaidAt:    a.PaidAt,
+		Reference: a.Reference,
+	}
+}
+
+// OutstandingBalance returns the total amount still due across the installments.
+func OutstandingBalance(installments []Installment) Money {
+	var total Money
+	for _, in := range installments {
+		total = total.Add(in.Outstanding())
+	}
+	return total
+}
+
+// ChargeLateFees charges fee on every unpaid installment past its due date at
+// the given time that was not charged one yet. The installments are updated in
+// place; it returns the IDs of those it charged.
+func ChargeLateFees(installments []Installment, at time.Time, fee Money) []string {
+	if fee.IsZero() {
+		return nil
+	}
+
+	var charged []string
+	for i := range installments {
+		in := &installments[i]
+		if in.Fee.IsZero() && in.IsOverdue(at) {
+			in.Fee = fee
+			charged = append(charged, in.ID)
+		}
+	}
+	return charged
+}
+
+// AllocateRepayment applies amount to the installments, oldest first, paying
+// each installment's fee, then interest, then principal before moving on.
+// The installments are updated in place.
+func AllocateRepayment(installments []Installment, amount Money) ([]RepaymentAllocation, error) {
+	if amount.Cmp(OutstandingBalance(installments)) > 0 {
+		return nil, fmt.Errorf("%w: repayment exceeds outstanding balance", ErrValidationFailed)
+	}
+
+	var allocations []RepaymentAllocation
+	remaining := amount
+	for i := range installments {
+		if remaining.IsZero() {
+			break
+		}
+		in := &installments[i]
+		if in.Outstanding().IsZero() {
+			continue
+		}
+
+		allocation := RepaymentAllocation{InstallmentID: in.ID, InstallmentNumber: in.Number}
+		allocation.Fee, remaining = take(in.Fee.Sub(in.PaidFee), remaining)
+		allocation.Interest, remaining = take(in.Interest.Sub(in.PaidInterest), remaining)
+		allocation.Principal, remaining = take(in.Principal.Sub(in.PaidPrincipal), remaining)
+
+		in.PaidFee = in.PaidFee.Add(allocation.Fee)
+		in.PaidInterest = in.PaidInterest.Add(allocation.Interest)
+		in.PaidPrincipal = in.PaidPrincipal.Add(allocation.Principal)
+		in.Status = InstallmentPartiallyPaid
+		if in.Outstanding().IsZero() {
+			in.Status = InstallmentPaid
+		}
+
+		allocations = append(allocations, allocation)
+	}
+
+	return allocations, nil
+}
+
+// take returns the part of available used to cover due and what is left of available.
+func take(due, available Money) (Money, Money) {
+	if available.Cmp(due) < 0 {
+		return available, Money{}
+	}
+	return due, available.Sub(due)
+}
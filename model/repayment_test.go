@@ -0,0 +1,119 @@
+package model_test
+
+import (
+	"loan-engine/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createInstallments() []model.Installment {
+	return []model.Installment{
+		{ID: "inst-1", Number: 1, Principal: model.NewMoney(100), Interest: model.NewMoney(10), Fee: model.NewMoney(5), Amount: model.NewMoney(110), Status: model.InstallmentPending},
+		{ID: "inst-2", Number: 2, Principal: model.NewMoney(100), Interest: model.NewMoney(10), Amount: model.NewMoney(110), Status: model.InstallmentPending},
+	}
+}
+
+func TestAllocateRepaymentOrder(t *testing.T) {
+	installments := createInstallments()
+
+	allocations, err := model.AllocateRepayment(installments, model.NewMoney(135))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RepaymentAllocation{
+		{InstallmentID: "inst-1", InstallmentNumber: 1, Fee: model.NewMoney(5), Interest: model.NewMoney(10), Principal: model.NewMoney(100)},
+		{InstallmentID: "inst-2", InstallmentNumber: 2, Interest: model.NewMoney(10), Principal: model.NewMoney(10)},
+	}, allocations)
+	assert.Equal(t, model.InstallmentPaid, installments[0].Status)
+	assert.Equal(t, model.InstallmentPartiallyPaid, installments[1].Status)
+	assert.Equal(t, model.NewMoney(90), model.OutstandingBalance(installments))
+}
+
+func TestAllocateRepaymentExceedsOutstanding(t *testing.T) {
+	installments := createInstallments()
+
+	_, err := model.AllocateRepayment(installments, model.NewMoney(226))
+
+	assert.ErrorIs(t, err, model.ErrValidationFailed)
+	assert.Contains(t, err.Error(), "repayment exceeds outstanding balance")
+	assert.Equal(t, model.InstallmentPending, installments[0].Status)
+}
+
+func TestChargeLateFees(t *testing.T) {
+	now := time.Now()
+	installments := createInstallments()
+	installments[0].DueDate = now.AddDate(0, -1, 0) // already charged
+	installments[1].DueDate = now.AddDate(0, -1, 0)
+	future := model.Installment{ID: "inst-3", Number: 3, DueDate: now.AddDate(0, 1, 0), Principal: model.NewMoney(100)}
+	installments = append(installments, future)
+
+	charged := model.ChargeLateFees(installments, now, model.NewMoney(20))
+
+	assert.Equal(t, []string{"inst-2"}, charged)
+	assert.Equal(t, model.NewMoney(5), installments[0].Fee)
+	assert.Equal(t, model.NewMoney(20), installments[1].Fee)
+	assert.True(t, installments[2].Fee.IsZero())
+	assert.Empty(t, model.ChargeLateFees(installments, now, model.NewMoney(20)))
+}
+
+func TestRecordRepaymentTransitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         model.LoanState
+		amount        model.Money
+		expectedState model.LoanState
+		expectError   bool
+	}{
+		{name: "Partial repayment from disbursed", state: model.StateDisbursed, amount: model.NewMoney(50), expectedState: model.StateRepaying},
+		{name: "Full repayment from repaying", state: model.StateRepaying, amount: model.NewMoney(225), expectedState: model.StatePaidOff},
+		{name: "Recovery from defaulted", state: model.StateDefaulted, amount: model.NewMoney(115), expectedState: model.StateRepaying},
+		{name: "Defaulted while still past due", state: model.StateDefaulted, amount: model.NewMoney(50), expectedState: model.StateDefaulted},
+		{name: "Overpayment rejected", state: model.StateRepaying, amount: model.NewMoney(300), expectedState: model.StateRepaying, expectError: true},
+		{name: "Repayment before disbursement rejected", state: model.StateInvested, amount: model.NewMoney(50), expectedState: model.StateInvested, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := createValidLoan()
+			loan.State = tt.state
+			loan.Installments = createInstallments()
+			// The first installment is past due
+			loan.Installments[0].DueDate = time.Now().AddDate(0, -1, 0)
+			loan.Installments[1].DueDate = time.Now().AddDate(0, 1, 0)
+			loan.NewRepayment = model.Repayment{Amount: tt.amount, PaidAt: time.Now()}
+
+			sm := model.NewStateMachine(loan.State)
+			err := sm.Transition(loan, model.EventRecordRepayment)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedState, loan.State)
+		})
+	}
+}
+
+func TestMarkDefaultRequiresOverdueInstallment(t *testing.T) {
+	loan := createValidLoan()
+	loan.State = model.StateRepaying
+	loan.Installments = createInstallments()
+	loan.Installments[0].DueDate = time.Now().AddDate(0, 1, 0)
+	loan.Installments[1].DueDate = time.Now().AddDate(0, 2, 0)
+
+	err := model.NewStateMachine(loan.State).Transition(loan, model.EventMarkDefault)
+	assert.Error(t, err, "the check time is required")
+
+	loan.DefaultCheckedAt = time.Now()
+	err = model.NewStateMachine(loan.State).Transition(loan, model.EventMarkDefault)
+	assert.Error(t, err)
+	assert.Equal(t, model.StateRepaying, loan.State)
+
+	// Checked once the first installment has fallen due
+	loan.DefaultCheckedAt = loan.Installments[0].DueDate.AddDate(0, 0, 1)
+	err = model.NewStateMachine(loan.State).Transition(loan, model.EventMarkDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateDefaulted, loan.State)
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type RepaymentFrequency string
+
+const (
+	FrequencyWeekly  RepaymentFrequency = "weekly"
+	FrequencyMonthly RepaymentFrequency = "monthly"
+)
+
+// periodsPerYear returns how many repayment periods fit in a year, or 0 for an unknown frequency.
+func (f RepaymentFrequency) periodsPerYear() int {
+	switch f {
+	case FrequencyWeekly:
+		return 52
+	case FrequencyMonthly:
+		return 12
+	default:
+		return 0
+	}
+}
+
+// dueDate returns the due date of the n-th installment counted from start.
+func (f RepaymentFrequency) dueDate(start time.Time, n int) time.Time {
+	if f == FrequencyWeekly {
+		return start.AddDate(0, 0, 7*n)
+	}
+	return start.AddDate(0, n, 0)
+}
+
+type InterestMethod string
+
+const (
+	// InterestFlat charges interest on the original principal for every period.
+	InterestFlat InterestMethod = "flat"
+	// InterestAnnuity charges interest on the outstanding balance with equal total installments.
+	InterestAnnuity InterestMethod = "annuity"
+)
+
+type InstallmentStatus string
+
+const (
+	InstallmentPending       InstallmentStatus = "pending"
+	InstallmentPartiallyPaid InstallmentStatus = "partially_paid"
+	InstallmentPaid          InstallmentStatus = "paid"
+)
+
+type Installment struct {
+	ID            string            `json:"id"`
+	LoanID        string            `json:"loan_id"`
+	Number        int               `json:"number"`
+	DueDate       time.Time         `json:"due_date"`
+	Principal     Money             `json:"principal"`
+	Interest      Money             `json:"interest"`
+	Fee           Money             `json:"fee"`
+	Amount        Money             `json:"amount"`
+	PaidPrincipal Money             `json:"paid_principal"`
+	PaidInterest  Money             `json:"paid_interest"`
+	PaidFee       Money             `json:"paid_fee"`
+	Status        InstallmentStatus `json:"status"`
+}
+
+// Outstanding returns the fee, interest and principal still due on the installment.
+func (in Installment) Outstanding() Money {
+	due := in.Fee.Add(in.Interest).Add(in.Principal)
+	paid := in.PaidFee.Add(in.PaidInterest).Add(in.PaidPrincipal)
+	return due.Sub(paid)
+}
+
+// IsOverdue reports whether the installment is past its due date and not fully paid.
+func (in Installment) IsOverdue(now time.Time) bool {
+	return now.After(in.DueDate) && !in.Outstanding().IsZero()
+}
+
+// GenerateSchedule builds the amortization schedule of the loan starting at
+// the given date. Rate is the annual interest rate in percent; rounding
+// residue is absorbed by the last installment so principals sum up exactly.
+func GenerateSchedule(l *Loan, start time.Time) ([]Installment, error) {
+	if l.Tenor <= 0 {
+		return nil, fmt.Errorf("%w: invalid tenor %d", ErrValidationFailed, l.Tenor)
+	}
+
+	periods := l.RepaymentFrequency.periodsPerYear()
+	if periods == 0 {
+		return nil, fmt.Errorf("%w: invalid repayment frequency %q", ErrValidationFailed, l.RepaymentFrequency)
+	}
+	periodRate := l.Rate / 100 / float64(periods)
+
+	principal := l.PrincipalAmount.Minor()
+	n := int64(l.Tenor)
+
+	var payment int64
+	switch l.InterestMethod {
+	case InterestFlat:
+	case InterestAnnuity:
+		if periodRate == 0 {
+			payment = roundDiv(principal, n)
+		} else {
+			payment = int64(math.Round(float64(principal) * periodRate / (1 - math.Pow(1+periodRate, -float64(n)))))
+		}
+	default:
+		return nil, fmt.Errorf("%w: invalid interest method %q", ErrValidationFailed, l.InterestMethod)
+	}
+
+	installments := make([]Installment, 0, l.Tenor)
+	balance := principal
+	for i := int64(1); i <= n; i++ {
+		var interestPart, principalPart int64
+		if l.InterestMethod == InterestFlat {
+			interestPart = int64(math.Round(float64(principal) * periodRate))
+			principalPart = roundDiv(principal, n)
+		} else {
+			interestPart = int64(math.Round(float64(balance) * periodRate))
+			principalPart = payment - interestPart
+		}
+		if i == n || principalPart > balance {
+			principalPart = balance
+		}
+		balance -= principalPart
+
+		installments = append(installments, Installment{
+			LoanID:    l.ID,
+			Number:    int(i),
+			DueDate:   l.RepaymentFrequency.dueDate(start, int(i)),
+			Principal: MoneyFromMinor(principalPart),
+			Interest:  MoneyFromMinor(interestPart),
+			Amount:    MoneyFromMinor(principalPart + interestPart),
+			Status:    InstallmentPending,
+		})
+	}
+
+	return installments, nil
+}
+
+// roundDiv divides a by b rounding half away from zero.
+func roundDiv(a, b int64) int64 {
+	return int64(math.Round(float64(a) / float64(b)))
+}
@@ -0,0 +1,118 @@
+package model_test
+
+import (
+	"loan-engine/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSchedule(t *testing.T) {
+	start := time.Date(2024, 12, 5, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		setupFn           func(*model.Loan)
+		expectedFirst     model.Installment
+		expectedLastDue   time.Time
+		expectedTotalDue  model.Money
+		expectedInstCount int
+	}{
+		{
+			name: "Flat monthly",
+			setupFn: func(l *model.Loan) {
+				l.PrincipalAmount = model.NewMoney(1000)
+				l.Rate = 12
+				l.Tenor = 3
+				l.RepaymentFrequency = model.FrequencyMonthly
+				l.InterestMethod = model.InterestFlat
+			},
+			expectedFirst: model.Installment{
+				Number:    1,
+				Principal: model.MustParseMoney("333.33"),
+				Interest:  model.MustParseMoney("10.00"),
+				Amount:    model.MustParseMoney("343.33"),
+			},
+			expectedLastDue:   time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC),
+			expectedTotalDue:  model.MustParseMoney("1030.00"),
+			expectedInstCount: 3,
+		},
+		{
+			name: "Annuity monthly",
+			setupFn: func(l *model.Loan) {
+				l.PrincipalAmount = model.NewMoney(1000)
+				l.Rate = 12
+				l.Tenor = 3
+				l.RepaymentFrequency = model.FrequencyMonthly
+				l.InterestMethod = model.InterestAnnuity
+			},
+			expectedFirst: model.Installment{
+				Number:    1,
+				Principal: model.MustParseMoney("330.02"),
+				Interest:  model.MustParseMoney("10.00"),
+				Amount:    model.MustParseMoney("340.02"),
+			},
+			expectedLastDue:   time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC),
+			expectedTotalDue:  model.MustParseMoney("1020.07"),
+			expectedInstCount: 3,
+		},
+		{
+			name: "Flat weekly",
+			setupFn: func(l *model.Loan) {
+				l.PrincipalAmount = model.NewMoney(520)
+				l.Rate = 10
+				l.Tenor = 4
+				l.RepaymentFrequency = model.FrequencyWeekly
+				l.InterestMethod = model.InterestFlat
+			},
+			expectedFirst: model.Installment{
+				Number:    1,
+				Principal: model.NewMoney(130),
+				Interest:  model.NewMoney(1),
+				Amount:    model.NewMoney(131),
+			},
+			expectedLastDue:   time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedTotalDue:  model.NewMoney(524),
+			expectedInstCount: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := createValidLoan()
+			tt.setupFn(loan)
+
+			installments, err := model.GenerateSchedule(loan, start)
+
+			assert.NoError(t, err)
+			assert.Len(t, installments, tt.expectedInstCount)
+
+			first := installments[0]
+			assert.Equal(t, tt.expectedFirst.Number, first.Number)
+			assert.Equal(t, tt.expectedFirst.Principal, first.Principal)
+			assert.Equal(t, tt.expectedFirst.Interest, first.Interest)
+			assert.Equal(t, tt.expectedFirst.Amount, first.Amount)
+			assert.Equal(t, model.InstallmentPending, first.Status)
+
+			var totalPrincipal, totalDue model.Money
+			for _, in := range installments {
+				totalPrincipal = totalPrincipal.Add(in.Principal)
+				totalDue = totalDue.Add(in.Amount)
+			}
+			assert.Equal(t, loan.PrincipalAmount, totalPrincipal)
+			assert.Equal(t, tt.expectedTotalDue, totalDue)
+			assert.Equal(t, tt.expectedLastDue, installments[len(installments)-1].DueDate)
+		})
+	}
+}
+
+func TestGenerateScheduleInvalidTerms(t *testing.T) {
+	loan := createValidLoan()
+	loan.InterestMethod = "balloon"
+
+	_, err := model.GenerateSchedule(loan, time.Now())
+
+	assert.ErrorIs(t, err, model.ErrValidationFailed)
+	assert.Contains(t, err.Error(), "invalid interest method")
+}
@@ -13,17 +13,40 @@ const (
 	StateApproved  LoanState = "approved"
 	StateInvested  LoanState = "invested"
 	StateDisbursed LoanState = "disbursed"
+	StateRepaying  LoanState = "repaying"
+	StatePaidOff   LoanState = "paid_off"
+	StateDefaulted LoanState = "defaulted"
+	StateRejected  LoanState = "rejected"
+	StateCancelled LoanState = "cancelled"
+	StateExpired   LoanState = "expired"
 )
 
 type LoanEvent string
 
 const (
-	EventSubmission    LoanEvent = "submission"
-	EventApprove       LoanEvent = "approve"
-	EventAddInvestment LoanEvent = "add_investment"
-	EventDisburseFunds LoanEvent = "disburse_funds"
+	EventSubmission         LoanEvent = "submission"
+	EventApprove            LoanEvent = "approve"
+	EventAddInvestment      LoanEvent = "add_investment"
+	EventDisburseFunds      LoanEvent = "disburse_funds"
+	EventRecordRepayment    LoanEvent = "record_repayment"
+	EventMarkDefault        LoanEvent = "mark_default"
+	EventReject             LoanEvent = "reject"
+	EventCancel             LoanEvent = "cancel"
+	EventExpire             LoanEvent = "expire"
+	EventWithdrawInvestment LoanEvent = "withdraw_investment"
 )
 
+// IsKnownEvent reports whether e is one of the loan events above.
+func IsKnownEvent(e LoanEvent) bool {
+	switch e {
+	case EventSubmission, EventApprove, EventAddInvestment, EventDisburseFunds, EventRecordRepayment,
+		EventMarkDefault, EventReject, EventCancel, EventExpire, EventWithdrawInvestment:
+		return true
+	default:
+		return false
+	}
+}
+
 // Rule defines a function type for eligibility checks.
 type EventRule func(l *Loan) (LoanState, error)
 
@@ -33,18 +56,46 @@ func SubmissionRule(l *Loan) (LoanState, error) {
 		return l.State, errors.New("loan borrower ID data is empty")
 	}
 
-	if l.PrincipalAmount == 0 {
+	if l.PrincipalAmount.IsZero() {
 		return l.State, errors.New("loan principal amount data is empty")
 	}
 
+	if l.PrincipalAmount.IsNegative() {
+		return l.State, errors.New("loan principal amount must be positive")
+	}
+
+	if !IsValidCurrency(l.Currency) {
+		return l.State, errors.New("loan currency is invalid")
+	}
+
 	if l.Rate == 0 {
 		return l.State, errors.New("loan rate data is empty")
 	}
 
-	if l.ROI == 0 {
+	if l.Rate < 0 {
+		return l.State, errors.New("loan rate must be positive")
+	}
+
+	if l.ROI.IsZero() {
 		return l.State, errors.New("loan roi data is empty")
 	}
 
+	if l.ROI.IsNegative() {
+		return l.State, errors.New("loan roi must be positive")
+	}
+
+	if l.Tenor <= 0 {
+		return l.State, errors.New("loan tenor must be positive")
+	}
+
+	if l.RepaymentFrequency != FrequencyWeekly && l.RepaymentFrequency != FrequencyMonthly {
+		return l.State, errors.New("loan repayment frequency is invalid")
+	}
+
+	if l.InterestMethod != InterestFlat && l.InterestMethod != InterestAnnuity {
+		return l.State, errors.New("loan interest method is invalid")
+	}
+
 	return StateProposed, nil
 }
 
@@ -62,6 +113,14 @@ func ApproveRule(l *Loan) (LoanState, error) {
 		return l.State, errors.New("approval date is empty")
 	}
 
+	if isTimeNullOrEmpty(l.Approval.FundingDeadline) {
+		return l.State, errors.New("approval funding deadline is empty")
+	}
+
+	if !l.Approval.FundingDeadline.Time.After(l.Approval.ApprovalDate.Time) {
+		return l.State, errors.New("approval funding deadline must be after approval date")
+	}
+
 	return StateApproved, nil
 }
 
@@ -80,23 +139,48 @@ func AddInvestmentRule(l *Loan) (LoanState, error) {
 		return l.State, errors.New("investor email for investment is empty")
 	}
 
-	if l.NewInvestment.Amount == 0 {
+	if l.NewInvestment.Locale != "" && !IsValidLocale(l.NewInvestment.Locale) {
+		return l.State, errors.New("investor locale for investment is invalid")
+	}
+
+	if l.NewInvestment.Amount.IsZero() {
 		return l.State, errors.New("investor amount for investment is empty")
 	}
 
-	// validate investment amount
-	currentTotal := l.TotalInvestmentAmount + l.NewInvestment.Amount
-	if currentTotal > l.PrincipalAmount {
+	if l.NewInvestment.Amount.IsNegative() {
+		return l.State, errors.New("investor amount for investment must be positive")
+	}
+
+	// validate investment amount, exact fixed-point comparison
+	currentTotal := l.TotalInvestmentAmount.Add(l.NewInvestment.Amount)
+	if currentTotal.Cmp(l.PrincipalAmount) > 0 {
 		return l.State, errors.New("investment would exceed loan principal amount")
 	}
 
-	if currentTotal == l.PrincipalAmount {
+	if currentTotal.Cmp(l.PrincipalAmount) == 0 {
 		return StateInvested, nil
 	}
 
 	return StateApproved, nil
 }
 
+// Rule for withdraw investment event
+func WithdrawInvestmentRule(l *Loan) (LoanState, error) {
+	if l.WithdrawInvestment.ID == "" {
+		return l.State, errors.New("investment to withdraw is empty")
+	}
+
+	if l.WithdrawInvestment.Status != InvestmentActive {
+		return l.State, fmt.Errorf("investment is already %s", l.WithdrawInvestment.Status)
+	}
+
+	if l.WithdrawInvestment.Amount.Cmp(l.TotalInvestmentAmount) > 0 {
+		return l.State, errors.New("withdrawal would exceed loan total investment amount")
+	}
+
+	return StateApproved, nil
+}
+
 // Rule for disburse funds event
 func DisburseFundsRule(l *Loan) (LoanState, error) {
 	if isStringNullOrEmpty(l.Disbursement.SignedAgreementLetterURL) {
@@ -114,6 +198,109 @@ func DisburseFundsRule(l *Loan) (LoanState, error) {
 	return StateDisbursed, nil
 }
 
+// Rule for reject event
+func RejectRule(l *Loan) (LoanState, error) {
+	if isStringNullOrEmpty(l.Rejection.Reason) {
+		return l.State, errors.New("rejection reason is empty")
+	}
+
+	if isStringNullOrEmpty(l.Rejection.FieldValidatorID) {
+		return l.State, errors.New("rejection field validator is empty")
+	}
+
+	if isTimeNullOrEmpty(l.Rejection.RejectionDate) {
+		return l.State, errors.New("rejection date is empty")
+	}
+
+	return StateRejected, nil
+}
+
+// Rule for cancel event
+func CancelRule(l *Loan) (LoanState, error) {
+	if isStringNullOrEmpty(l.Cancellation.Reason) {
+		return l.State, errors.New("cancellation reason is empty")
+	}
+
+	if isTimeNullOrEmpty(l.Cancellation.CancellationDate) {
+		return l.State, errors.New("cancellation date is empty")
+	}
+
+	return StateCancelled, nil
+}
+
+// Rule for expire event
+func ExpireRule(l *Loan) (LoanState, error) {
+	if l.ExpiryCheckedAt.IsZero() {
+		return l.State, errors.New("expiry check time is empty")
+	}
+
+	if isTimeNullOrEmpty(l.Approval.FundingDeadline) || l.ExpiryCheckedAt.Before(l.Approval.FundingDeadline.Time) {
+		return l.State, errors.New("loan funding deadline has not passed")
+	}
+
+	if l.TotalInvestmentAmount.Cmp(l.PrincipalAmount) >= 0 {
+		return l.State, errors.New("loan is fully funded")
+	}
+
+	return StateExpired, nil
+}
+
+// Rule for record repayment event
+func RecordRepaymentRule(l *Loan) (LoanState, error) {
+	if l.NewRepayment.Amount.IsZero() {
+		return l.State, errors.New("repayment amount is empty")
+	}
+
+	if l.NewRepayment.Amount.IsNegative() {
+		return l.State, errors.New("repayment amount must be positive")
+	}
+
+	if l.NewRepayment.PaidAt.IsZero() {
+		return l.State, errors.New("repayment date is empty")
+	}
+
+	outstanding := OutstandingBalance(l.Installments)
+	if l.NewRepayment.Amount.Cmp(outstanding) > 0 {
+		return l.State, errors.New("repayment exceeds outstanding balance")
+	}
+
+	if l.NewRepayment.Amount.Cmp(outstanding) == 0 {
+		return StatePaidOff, nil
+	}
+
+	// A defaulted loan only resumes repaying once it has caught up on every
+	// installment past due
+	if l.State == StateDefaulted {
+		installments := append([]Installment(nil), l.Installments...)
+		_, err := AllocateRepayment(installments, l.NewRepayment.Amount)
+		if err != nil {
+			return l.State, err
+		}
+		for _, in := range installments {
+			if in.IsOverdue(l.NewRepayment.PaidAt) {
+				return StateDefaulted, nil
+			}
+		}
+	}
+
+	return StateRepaying, nil
+}
+
+// Rule for mark default event
+func MarkDefaultRule(l *Loan) (LoanState, error) {
+	if l.DefaultCheckedAt.IsZero() {
+		return l.State, errors.New("default check time is empty")
+	}
+
+	for _, in := range l.Installments {
+		if in.IsOverdue(l.DefaultCheckedAt) {
+			return StateDefaulted, nil
+		}
+	}
+
+	return l.State, errors.New("loan has no overdue installment")
+}
+
 // StateMachine represents a state machine.
 type StateMachine struct {
 	currentState LoanState
@@ -130,33 +317,45 @@ func NewStateMachine(initialState LoanState) *StateMachine {
 			},
 			StateProposed: {
 				EventApprove: ApproveRule,
+				EventReject:  RejectRule,
+				EventCancel:  CancelRule,
 			},
 			StateApproved: {
-				EventAddInvestment: AddInvestmentRule,
+				EventAddInvestment:      AddInvestmentRule,
+				EventCancel:             CancelRule,
+				EventExpire:             ExpireRule,
+				EventWithdrawInvestment: WithdrawInvestmentRule,
 			},
 			StateInvested: {
 				EventDisburseFunds: DisburseFundsRule,
 			},
+			StateDisbursed: {
+				EventRecordRepayment: RecordRepaymentRule,
+				EventMarkDefault:     MarkDefaultRule,
+			},
+			StateRepaying: {
+				EventRecordRepayment: RecordRepaymentRule,
+				EventMarkDefault:     MarkDefaultRule,
+			},
+			StateDefaulted: {
+				EventRecordRepayment: RecordRepaymentRule,
+			},
 		},
 	}
 }
 
 // Transition attempts to move the state machine to the next state.
 func (sm *StateMachine) Transition(loan *Loan, event LoanEvent) error {
-	allowedTransitions, ok := sm.transitions[sm.currentState]
-	if !ok {
-		return fmt.Errorf("invalid current state: %s", sm.currentState)
-	}
-
-	eventRule, ok := allowedTransitions[event]
+	// Terminal states have no allowed transitions
+	eventRule, ok := sm.transitions[sm.currentState][event]
 	if !ok {
-		return fmt.Errorf("event %s not allowed in state %s", event, sm.currentState)
+		return &TransitionError{State: sm.currentState, Event: event}
 	}
 
 	// Determine the next state using the decision rule
 	nextState, err := eventRule(loan)
 	if err != nil {
-		return fmt.Errorf("state decision failed: %v", err)
+		return &ValidationError{Err: err}
 	}
 
 	sm.currentState = nextState
@@ -2,6 +2,7 @@ package model_test
 
 import (
 	"database/sql"
+	"encoding/json"
 	"loan-engine/model"
 	"testing"
 	"time"
@@ -11,13 +12,17 @@ import (
 
 func createValidLoan() *model.Loan {
 	return &model.Loan{
-		ID:              "loan-123",
-		BorrowerID:      "borrower-123",
-		PrincipalAmount: 1000.0,
-		Rate:            5.0,
-		ROI:             10.0,
-		State:           model.StateInitial,
-		Version:         1,
+		ID:                 "loan-123",
+		BorrowerID:         "borrower-123",
+		PrincipalAmount:    model.NewMoney(1000),
+		Currency:           model.DefaultCurrency,
+		Rate:               5.0,
+		ROI:                model.NewMoney(10),
+		Tenor:              12,
+		RepaymentFrequency: model.FrequencyMonthly,
+		InterestMethod:     model.InterestFlat,
+		State:              model.StateInitial,
+		Version:            1,
 	}
 }
 
@@ -52,6 +57,28 @@ func TestStateMachineTransitions(t *testing.T) {
 			expectError:   true,
 			errorMessage:  "state decision failed: loan borrower ID data is empty",
 		},
+		{
+			name:  "Invalid Initial to Proposed - Negative Rate",
+			loan:  createValidLoan(),
+			event: model.EventSubmission,
+			setupFn: func(l *model.Loan) {
+				l.Rate = -5
+			},
+			expectedState: model.StateInitial,
+			expectError:   true,
+			errorMessage:  "state decision failed: loan rate must be positive",
+		},
+		{
+			name:  "Invalid Initial to Proposed - Negative Tenor",
+			loan:  createValidLoan(),
+			event: model.EventSubmission,
+			setupFn: func(l *model.Loan) {
+				l.Tenor = -12
+			},
+			expectedState: model.StateInitial,
+			expectError:   true,
+			errorMessage:  "state decision failed: loan tenor must be positive",
+		},
 		{
 			name:  "Valid Proposed to Approved Transition",
 			loan:  createValidLoan(),
@@ -62,6 +89,7 @@ func TestStateMachineTransitions(t *testing.T) {
 					FieldValidatorID: sql.NullString{String: "validator-123", Valid: true},
 					ProofImageURL:    sql.NullString{String: "http://example.com/proof.jpg", Valid: true},
 					ApprovalDate:     sql.NullTime{Time: time.Now(), Valid: true},
+					FundingDeadline:  sql.NullTime{Time: time.Now().Add(model.DefaultFundingPeriod), Valid: true},
 				}
 			},
 			expectedState: model.StateApproved,
@@ -77,7 +105,7 @@ func TestStateMachineTransitions(t *testing.T) {
 					InvestorID: "investor-123",
 					Name:       "John Doe",
 					Email:      "john@example.com",
-					Amount:     1000.0,
+					Amount:     model.NewMoney(1000),
 				}
 			},
 			expectedState: model.StateInvested,
@@ -133,7 +161,7 @@ func TestAddInvestmentRulePartialInvestment(t *testing.T) {
 		InvestorID: "investor-123",
 		Name:       "John Doe",
 		Email:      "john@example.com",
-		Amount:     500.0, // Half of principal amount
+		Amount:     model.NewMoney(500), // Half of principal amount
 	}
 
 	sm := model.NewStateMachine(loan.State)
@@ -150,7 +178,7 @@ func TestAddInvestmentRuleExceedPrincipal(t *testing.T) {
 		InvestorID: "investor-123",
 		Name:       "John Doe",
 		Email:      "john@example.com",
-		Amount:     1500.0, // More than principal amount
+		Amount:     model.NewMoney(1500), // More than principal amount
 	}
 
 	sm := model.NewStateMachine(loan.State)
@@ -161,6 +189,31 @@ func TestAddInvestmentRuleExceedPrincipal(t *testing.T) {
 	assert.Equal(t, model.StateApproved, loan.State)
 }
 
+func TestAddInvestmentRuleLocale(t *testing.T) {
+	for locale, valid := range map[string]bool{"": true, "id": true, "en-GB": true, "pt_BR": true, "english": false, "e": false, "en-": false} {
+		t.Run(locale, func(t *testing.T) {
+			loan := createValidLoan()
+			loan.State = model.StateApproved
+			loan.NewInvestment = model.Investment{
+				InvestorID: "investor-123",
+				Name:       "John Doe",
+				Email:      "john@example.com",
+				Locale:     locale,
+				Amount:     model.NewMoney(500),
+			}
+
+			sm := model.NewStateMachine(loan.State)
+			err := sm.Transition(loan, model.EventAddInvestment)
+
+			if valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "investor locale for investment is invalid")
+			}
+		})
+	}
+}
+
 func TestInvalidStateTransition(t *testing.T) {
 	loan := createValidLoan()
 	loan.State = model.StateInitial
@@ -171,3 +224,198 @@ func TestInvalidStateTransition(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "event disburse_funds not allowed in state initial")
 }
+
+func TestLoanJSONRendersNullableFields(t *testing.T) {
+	loan := createValidLoan()
+	loan.State = model.StateApproved
+	loan.Approval = model.Approval{
+		FieldValidatorID: sql.NullString{String: "validator-123", Valid: true},
+		ProofImageURL:    sql.NullString{String: "http://example.com/proof.jpg", Valid: true},
+		ApprovalDate:     sql.NullTime{Time: time.Date(2024, 12, 5, 15, 30, 0, 0, time.UTC), Valid: true},
+	}
+
+	data, err := json.Marshal(loan)
+	assert.NoError(t, err)
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &got))
+
+	assert.Nil(t, got["agreement_letter_url"])
+	assert.NotContains(t, got, "new_investment")
+	assert.Equal(t, map[string]interface{}{
+		"field_validator_id": "validator-123",
+		"proof_image_url":    "http://example.com/proof.jpg",
+		"approval_date":      "2024-12-05T15:30:00Z",
+		"funding_deadline":   nil,
+	}, got["approval"])
+	assert.Equal(t, map[string]interface{}{
+		"field_officer_id":            nil,
+		"signed_agreement_letter_url": nil,
+		"disbursement_date":           nil,
+	}, got["disbursement"])
+}
+
+func TestAddInvestmentRuleExactDecimalSplits(t *testing.T) {
+	loan := createValidLoan()
+	loan.State = model.StateApproved
+	loan.PrincipalAmount = model.MustParseMoney("0.3")
+	loan.TotalInvestmentAmount = model.MustParseMoney("0.1")
+	loan.NewInvestment = model.Investment{
+		InvestorID: "investor-123",
+		Name:       "John Doe",
+		Email:      "john@example.com",
+		Amount:     model.MustParseMoney("0.2"),
+	}
+
+	sm := model.NewStateMachine(loan.State)
+	err := sm.Transition(loan, model.EventAddInvestment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateInvested, loan.State)
+}
+
+func TestRejectAndCancelTransitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         model.LoanState
+		event         model.LoanEvent
+		setupFn       func(*model.Loan)
+		expectedState model.LoanState
+		errorMessage  string
+	}{
+		{
+			name:  "Valid Proposed to Rejected Transition",
+			state: model.StateProposed,
+			event: model.EventReject,
+			setupFn: func(l *model.Loan) {
+				req := model.RejectLoanRequest{ValidatorID: "validator-123", Reason: "invalid documents"}
+				l.Rejection = req.ToRejection()
+			},
+			expectedState: model.StateRejected,
+		},
+		{
+			name:  "Invalid Rejection - Empty Reason",
+			state: model.StateProposed,
+			event: model.EventReject,
+			setupFn: func(l *model.Loan) {
+				req := model.RejectLoanRequest{ValidatorID: "validator-123"}
+				l.Rejection = req.ToRejection()
+			},
+			expectedState: model.StateProposed,
+			errorMessage:  "state decision failed: rejection reason is empty",
+		},
+		{
+			name:  "Invalid Rejection - Approved Loan",
+			state: model.StateApproved,
+			event: model.EventReject,
+			setupFn: func(l *model.Loan) {
+				req := model.RejectLoanRequest{ValidatorID: "validator-123", Reason: "invalid documents"}
+				l.Rejection = req.ToRejection()
+			},
+			expectedState: model.StateApproved,
+			errorMessage:  "event reject not allowed in state approved",
+		},
+		{
+			name:  "Valid Approved to Cancelled Transition",
+			state: model.StateApproved,
+			event: model.EventCancel,
+			setupFn: func(l *model.Loan) {
+				req := model.CancelLoanRequest{Reason: "borrower withdrew"}
+				l.Cancellation = req.ToCancellation()
+			},
+			expectedState: model.StateCancelled,
+		},
+		{
+			name:  "Invalid Cancellation - Invested Loan",
+			state: model.StateInvested,
+			event: model.EventCancel,
+			setupFn: func(l *model.Loan) {
+				req := model.CancelLoanRequest{Reason: "borrower withdrew"}
+				l.Cancellation = req.ToCancellation()
+			},
+			expectedState: model.StateInvested,
+			errorMessage:  "event cancel not allowed in state invested",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := createValidLoan()
+			loan.State = tt.state
+			tt.setupFn(loan)
+
+			err := model.NewStateMachine(loan.State).Transition(loan, tt.event)
+
+			if tt.errorMessage != "" {
+				assert.EqualError(t, err, tt.errorMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedState, loan.State)
+		})
+	}
+}
+
+func TestExpireRule(t *testing.T) {
+	now := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		deadline      time.Time
+		checkedAt     time.Time
+		invested      model.Money
+		expectedState model.LoanState
+		expectError   bool
+	}{
+		{name: "Under-funded loan past deadline expires", deadline: now.Add(-time.Hour), checkedAt: now, invested: model.NewMoney(400), expectedState: model.StateExpired},
+		{name: "Loan before deadline stays approved", deadline: now.Add(time.Hour), checkedAt: now, invested: model.NewMoney(400), expectedState: model.StateApproved, expectError: true},
+		{name: "Fully funded loan stays approved", deadline: now.Add(-time.Hour), checkedAt: now, invested: model.NewMoney(1000), expectedState: model.StateApproved, expectError: true},
+		{name: "Missing check time", deadline: now.Add(-time.Hour), invested: model.NewMoney(400), expectedState: model.StateApproved, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := createValidLoan()
+			loan.State = model.StateApproved
+			loan.TotalInvestmentAmount = tt.invested
+			loan.Approval.FundingDeadline = sql.NullTime{Time: tt.deadline, Valid: true}
+			loan.ExpiryCheckedAt = tt.checkedAt
+
+			err := model.NewStateMachine(loan.State).Transition(loan, model.EventExpire)
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedState, loan.State)
+		})
+	}
+}
+
+func TestApproveLoanRequestDefaultFundingDeadline(t *testing.T) {
+	approvalDate := time.Date(2024, 12, 5, 15, 30, 0, 0, time.UTC)
+	req := model.ApproveLoanRequest{ValidatorID: "validator-123", ProofImageURL: "image", ApprovalDate: approvalDate}
+
+	approval := req.ToApproval()
+
+	assert.Equal(t, approvalDate.Add(model.DefaultFundingPeriod), approval.FundingDeadline.Time)
+}
+
+func TestTransitionErrorsAreTyped(t *testing.T) {
+	loan := createValidLoan()
+	loan.State = model.StateInitial
+
+	err := model.NewStateMachine(model.StateInitial).Transition(loan, model.EventApprove)
+	assert.ErrorIs(t, err, model.ErrInvalidTransition)
+	assert.NotErrorIs(t, err, model.ErrValidationFailed)
+
+	err = model.NewStateMachine(model.StateRejected).Transition(loan, model.EventCancel)
+	assert.ErrorIs(t, err, model.ErrInvalidTransition)
+	assert.EqualError(t, err, "event cancel not allowed in state rejected")
+
+	loan.BorrowerID = ""
+	err = model.NewStateMachine(model.StateInitial).Transition(loan, model.EventSubmission)
+	assert.ErrorIs(t, err, model.ErrValidationFailed)
+	assert.NotErrorIs(t, err, model.ErrInvalidTransition)
+	assert.Contains(t, err.Error(), "state decision failed")
+}
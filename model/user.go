@@ -0,0 +1,159 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ErrInvalidCredentials is returned for an unknown username, a wrong password or an inactive user.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Role groups the permissions of a kind of user.
+type Role string
+
+const (
+	// RoleAdmin manages users and webhook subscriptions
+	RoleAdmin Role = "admin"
+	// RoleStaff runs the loan book: proposing loans on behalf of borrowers,
+	// recording repayments and following up on documents and notifications
+	RoleStaff          Role = "staff"
+	RoleBorrower       Role = "borrower"
+	RoleInvestor       Role = "investor"
+	RoleFieldValidator Role = "field_validator"
+	RoleFieldOfficer   Role = "field_officer"
+)
+
+// Permission is an action guarded by the API.
+type Permission string
+
+const (
+	PermissionViewLoans           Permission = "loans:view"
+	PermissionCreateLoan          Permission = "loans:create"
+	PermissionApproveLoan         Permission = "loans:approve"
+	PermissionRejectLoan          Permission = "loans:reject"
+	PermissionCancelLoan          Permission = "loans:cancel"
+	PermissionInvest              Permission = "loans:invest"
+	PermissionDisburseLoan        Permission = "loans:disburse"
+	PermissionRecordRepayment     Permission = "loans:repay"
+	PermissionMarkDefault         Permission = "loans:default"
+	PermissionManageDocuments     Permission = "documents:manage"
+	PermissionManageNotifications Permission = "notifications:manage"
+	PermissionManageWebhooks      Permission = "webhooks:manage"
+	PermissionManageUsers         Permission = "users:manage"
+)
+
+// rolePermissions lists what each role may do. Approving, disbursing and
+// investing are deliberately left to their own roles, not to admins.
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionViewLoans, PermissionManageWebhooks, PermissionManageUsers,
+	},
+	RoleStaff: {
+		PermissionViewLoans, PermissionCreateLoan, PermissionRejectLoan, PermissionCancelLoan,
+		PermissionRecordRepayment, PermissionMarkDefault, PermissionManageDocuments, PermissionManageNotifications,
+	},
+	RoleBorrower:       {PermissionViewLoans, PermissionCreateLoan, PermissionCancelLoan},
+	RoleInvestor:       {PermissionViewLoans, PermissionInvest},
+	RoleFieldValidator: {PermissionViewLoans, PermissionApproveLoan, PermissionRejectLoan},
+	RoleFieldOfficer:   {PermissionViewLoans, PermissionDisburseLoan},
+}
+
+// IsValid reports whether the role is one of the known roles.
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// User is someone allowed to call the API.
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Roles        []Role    `json:"roles"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Can reports whether any of the user's roles grants the permission.
+func (u *User) Can(p Permission) bool {
+	for _, r := range u.Roles {
+		if r.Can(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the user holds the role.
+func (u *User) HasRole(role Role) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MinPasswordLength is the shortest password accepted for a user.
+const MinPasswordLength = 12
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{3,100}$`)
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Roles    []Role `json:"roles"`
+}
+
+// Validate checks the username, the password length and the roles.
+func (r *CreateUserRequest) Validate() error {
+	if !usernamePattern.MatchString(r.Username) {
+		return fmt.Errorf("%w: username must be 3 to 100 letters, digits or . _ @ -", ErrValidationFailed)
+	}
+	if len(r.Password) < MinPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrValidationFailed, MinPasswordLength)
+	}
+	return validateRoles(r.Roles)
+}
+
+// UpdateUserRequest changes the fields that are set.
+type UpdateUserRequest struct {
+	Password *string `json:"password"`
+	Roles    *[]Role `json:"roles"`
+	Active   *bool   `json:"active"`
+}
+
+func (r *UpdateUserRequest) Validate() error {
+	if r.Password != nil && len(*r.Password) < MinPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrValidationFailed, MinPasswordLength)
+	}
+	if r.Roles != nil {
+		return validateRoles(*r.Roles)
+	}
+	return nil
+}
+
+func validateRoles(roles []Role) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("%w: at least one role is required", ErrValidationFailed)
+	}
+	for _, r := range roles {
+		if !r.IsValid() {
+			return fmt.Errorf("%w: unknown role %q", ErrValidationFailed, r)
+		}
+	}
+	return nil
+}
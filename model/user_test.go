@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"testing"
+
+	"loan-engine/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserCan(t *testing.T) {
+	testCases := []struct {
+		name       string
+		roles      []model.Role
+		permission model.Permission
+		want       bool
+	}{
+		{name: "Validator approves", roles: []model.Role{model.RoleFieldValidator}, permission: model.PermissionApproveLoan, want: true},
+		{name: "Officer disburses", roles: []model.Role{model.RoleFieldOfficer}, permission: model.PermissionDisburseLoan, want: true},
+		{name: "Investor invests", roles: []model.Role{model.RoleInvestor}, permission: model.PermissionInvest, want: true},
+		{name: "Borrower creates loans", roles: []model.Role{model.RoleBorrower}, permission: model.PermissionCreateLoan, want: true},
+		{name: "Staff creates loans", roles: []model.Role{model.RoleStaff}, permission: model.PermissionCreateLoan, want: true},
+		{name: "Officer cannot approve", roles: []model.Role{model.RoleFieldOfficer}, permission: model.PermissionApproveLoan},
+		{name: "Validator cannot disburse", roles: []model.Role{model.RoleFieldValidator}, permission: model.PermissionDisburseLoan},
+		{name: "Borrower cannot invest", roles: []model.Role{model.RoleBorrower}, permission: model.PermissionInvest},
+		{name: "Admin cannot approve", roles: []model.Role{model.RoleAdmin}, permission: model.PermissionApproveLoan},
+		{name: "Any role grants", roles: []model.Role{model.RoleInvestor, model.RoleFieldOfficer}, permission: model.PermissionDisburseLoan, want: true},
+		{name: "Unknown role grants nothing", roles: []model.Role{"superuser"}, permission: model.PermissionViewLoans},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := model.User{Roles: tc.roles}
+			assert.Equal(t, tc.want, user.Can(tc.permission))
+		})
+	}
+}
+
+func TestCreateUserRequestValidate(t *testing.T) {
+	valid := model.CreateUserRequest{Username: "siti.rahayu", Password: "long-enough-pass", Roles: []model.Role{model.RoleInvestor}}
+	assert.NoError(t, valid.Validate())
+
+	for name, r := range map[string]model.CreateUserRequest{
+		"Short username": {Username: "si", Password: valid.Password, Roles: valid.Roles},
+		"Short password": {Username: valid.Username, Password: "short", Roles: valid.Roles},
+		"No roles":       {Username: valid.Username, Password: valid.Password},
+		"Unknown role":   {Username: valid.Username, Password: valid.Password, Roles: []model.Role{"superuser"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, r.Validate(), model.ErrValidationFailed)
+		})
+	}
+}
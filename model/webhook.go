@@ -0,0 +1,142 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// WebhookSubscription is a partner endpoint receiving loan transitions.
+type WebhookSubscription struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+	// Events limits deliveries to these transition events; empty means every event.
+	Events    []LoanEvent `json:"events"`
+	Active    bool        `json:"active"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants transitions of the event.
+func (s *WebhookSubscription) Matches(event LoanEvent) bool {
+	if !s.Active {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	URL    string      `json:"url"`
+	Secret string      `json:"secret"`
+	Events []LoanEvent `json:"events"`
+}
+
+// Validate checks the endpoint URL, the signing secret and the event filter.
+func (r *CreateWebhookSubscriptionRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrValidationFailed)
+	}
+	if len(r.Secret) < 16 {
+		return fmt.Errorf("%w: secret must be at least 16 characters", ErrValidationFailed)
+	}
+	for _, e := range r.Events {
+		if !IsKnownEvent(e) {
+			return fmt.Errorf("%w: unknown event %q", ErrValidationFailed, e)
+		}
+	}
+	return nil
+}
+
+func (r *CreateWebhookSubscriptionRequest) ToSubscription() WebhookSubscription {
+	return WebhookSubscription{
+		URL:    r.URL,
+		Secret: r.Secret,
+		Events: r.Events,
+		Active: true,
+	}
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryFailed marks a delivery that ran out of attempts; it can still be replayed.
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one transition to be sent to one subscription.
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	SubscriptionID string                `json:"subscription_id"`
+	OutboxEventID  int64                 `json:"-"`
+	LoanID         string                `json:"loan_id"`
+	Event          LoanEvent             `json:"event"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	CreatedAt      time.Time             `json:"created_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+
+	// Secret and URL are loaded with the subscription when the delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+
+	Log []WebhookDeliveryAttempt `json:"log,omitempty"`
+}
+
+// WebhookDeliveryAttempt logs a single HTTP call of a delivery.
+type WebhookDeliveryAttempt struct {
+	ID          int64     `json:"id"`
+	DeliveryID  string    `json:"delivery_id"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// WebhookPayload is the JSON body posted to subscribers.
+type WebhookPayload struct {
+	DeliveryID string     `json:"delivery_id"`
+	Event      LoanEvent  `json:"event"`
+	LoanID     string     `json:"loan_id"`
+	Transition Transition `json:"transition"`
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the subscription secret. Including the timestamp lets receivers
+// reject replayed requests.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a signature produced by SignWebhookPayload in constant time.
+func VerifyWebhookSignature(secret string, timestamp int64, body []byte, signature string) error {
+	expected := SignWebhookPayload(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("webhook signature mismatch")
+	}
+	return nil
+}
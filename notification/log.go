@@ -0,0 +1,36 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"loan-engine/model"
+)
+
+// LogChannel writes messages to w instead of sending them, for development.
+// Pass os.Stdout or an opened file.
+type LogChannel struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogChannel(w io.Writer) *LogChannel {
+	return &LogChannel{w: w}
+}
+
+func (l *LogChannel) Provider() string {
+	return "log"
+}
+
+// Send returns no message ID as nothing is delivered.
+func (l *LogChannel) Send(ctx context.Context, to model.Recipient, m Message) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "--- %s\nTo: %s <%s>\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC3339), to.Name, to.Email, m.Subject, m.Text)
+	return "", err
+}
@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"loan-engine/model"
+)
+
+// Message is a rendered email with a plain text and an HTML body.
+type Message struct {
+	// Locale is the locale of the templates the message was rendered from
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Channel delivers rendered messages, e.g. through SendGrid or SMTP.
+type Channel interface {
+	// Provider names the channel in notification attempts, e.g. "sendgrid".
+	Provider() string
+	// Send delivers the message and returns the ID the provider gave it, if any.
+	Send(ctx context.Context, to model.Recipient, m Message) (string, error)
+}
+
+// Notifier renders notifications from templates and delivers them over a channel.
+type Notifier struct {
+	channel   Channel
+	templates *Templates
+}
+
+func NewNotifier(channel Channel, templates *Templates) *Notifier {
+	return &Notifier{channel: channel, templates: templates}
+}
+
+// Notify renders the notification in the recipient's locale and sends it to
+// them. It returns the record of the attempt whether it was sent or not.
+func (n *Notifier) Notify(ctx context.Context, notification model.Notification) (model.NotificationAttempt, error) {
+	attempt := model.NewNotificationAttempt(notification, n.channel.Provider())
+	fail := func(err error) (model.NotificationAttempt, error) {
+		attempt.Status = model.NotificationFailed
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+
+	if notification.To.Email == "" {
+		return fail(errors.New("notification recipient has no email address"))
+	}
+
+	m, err := n.templates.Render(notification)
+	if err != nil {
+		return fail(err)
+	}
+	attempt.Locale = m.Locale
+
+	messageID, err := n.channel.Send(ctx, notification.To, m)
+	if err != nil {
+		return fail(fmt.Errorf("failed to send %s notification for loan %s: %w", notification.Type, notification.LoanID, err))
+	}
+
+	attempt.Status = model.NotificationSent
+	attempt.ProviderMessageID = messageID
+	return attempt, nil
+}
@@ -0,0 +1,39 @@
+package notification_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"loan-engine/model"
+	"loan-engine/notification"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierWithLogChannel(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := notification.NewNotifier(notification.NewLogChannel(&buf), notification.DefaultTemplates())
+	loan := &model.Loan{ID: "loan-123", Currency: "IDR", PrincipalAmount: model.NewMoney(1000), BorrowerName: "Budi", BorrowerEmail: "budi@example.com"}
+
+	attempt, err := notifier.Notify(context.Background(), model.NewLoanApprovedNotification(loan))
+	require.NoError(t, err)
+	assert.Equal(t, model.NotificationSent, attempt.Status)
+	assert.Equal(t, "log", attempt.Provider)
+	assert.Equal(t, "en", attempt.Locale)
+	assert.Equal(t, "loan-123", attempt.LoanID)
+	assert.Equal(t, "budi@example.com", attempt.Recipient.Email)
+	assert.Contains(t, buf.String(), "To: Budi <budi@example.com>\nSubject: Loan Approved\n")
+	assert.Contains(t, buf.String(), "Your loan loan-123 of IDR 1,000.00 has been approved")
+
+	t.Run("Recipient without address", func(t *testing.T) {
+		buf.Reset()
+		loan.BorrowerEmail = ""
+		attempt, err := notifier.Notify(context.Background(), model.NewLoanApprovedNotification(loan))
+		assert.Error(t, err)
+		assert.Equal(t, model.NotificationFailed, attempt.Status)
+		assert.Equal(t, err.Error(), attempt.Error)
+		assert.Empty(t, buf.String())
+	})
+}
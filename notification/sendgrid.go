@@ -0,0 +1,52 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"loan-engine/model"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGridChannel sends messages through the SendGrid API.
+type SendGridChannel struct {
+	client *sendgrid.Client
+	from   model.Recipient
+}
+
+func NewSendGridChannel(apiKey string, from model.Recipient) *SendGridChannel {
+	return &SendGridChannel{
+		client: sendgrid.NewSendClient(apiKey),
+		from:   from,
+	}
+}
+
+func (s *SendGridChannel) Provider() string {
+	return "sendgrid"
+}
+
+// Send returns the X-Message-Id SendGrid assigned to the message.
+func (s *SendGridChannel) Send(ctx context.Context, to model.Recipient, m Message) (string, error) {
+	from := mail.NewEmail(s.from.Name, s.from.Email)
+	message := mail.NewSingleEmail(from, m.Subject, mail.NewEmail(to.Name, to.Email), m.Text, m.HTML)
+
+	// Send the email using SendGrid's client
+	response, err := s.client.SendWithContext(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode >= 300 {
+		return "", fmt.Errorf("sendgrid responded with status %d: %s", response.StatusCode, response.Body)
+	}
+
+	var messageID string
+	if ids := response.Headers["X-Message-Id"]; len(ids) > 0 {
+		messageID = ids[0]
+	}
+
+	log.Printf("Email %q sent with status code: %d", m.Subject, response.StatusCode)
+	return messageID, nil
+}
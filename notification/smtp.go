@@ -0,0 +1,188 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"loan-engine/model"
+)
+
+// DefaultSMTPTimeout bounds a send when neither the context nor the config
+// sets a limit.
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig addresses an SMTP server. Username and Password are optional;
+// STARTTLS is used whenever the server offers it.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     model.Recipient
+	// Timeout bounds connecting and talking to the server when the context
+	// has no deadline; zero means DefaultSMTPTimeout.
+	Timeout time.Duration
+}
+
+// SMTPChannel sends messages as multipart/alternative emails over SMTP.
+type SMTPChannel struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPChannel(cfg SMTPConfig) *SMTPChannel {
+	return &SMTPChannel{cfg: cfg}
+}
+
+func (s *SMTPChannel) Provider() string {
+	return "smtp"
+}
+
+// Send returns the Message-ID header it gave the email, without the angle
+// brackets.
+func (s *SMTPChannel) Send(ctx context.Context, to model.Recipient, m Message) (string, error) {
+	messageID, err := s.newMessageID()
+	if err != nil {
+		return "", err
+	}
+	body, err := s.buildMessage(messageID, to, m)
+	if err != nil {
+		return "", err
+	}
+
+	// A server that accepts the connection but never answers must not
+	// hold up the caller forever
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		timeout := s.cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultSMTPTimeout
+		}
+		deadline = time.Now().Add(timeout)
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return "", err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: s.cfg.Host})
+		if err != nil {
+			return "", err
+		}
+	}
+	if s.cfg.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = c.Mail(s.cfg.From.Email)
+	if err != nil {
+		return "", err
+	}
+	err = c.Rcpt(to.Email)
+	if err != nil {
+		return "", err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return "", err
+	}
+	_, err = w.Write(body)
+	if err != nil {
+		return "", err
+	}
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+	err = c.Quit()
+	if err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// newMessageID returns a unique ID in the domain of the sender's address.
+func (s *SMTPChannel) newMessageID() (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	domain := s.cfg.Host
+	if i := strings.LastIndex(s.cfg.From.Email, "@"); i >= 0 {
+		domain = s.cfg.From.Email[i+1:]
+	}
+	return fmt.Sprintf("%s.%d@%s", hex.EncodeToString(b), time.Now().UnixNano(), domain), nil
+}
+
+// buildMessage renders the headers and the text and HTML parts of the email.
+func (s *SMTPChannel) buildMessage(messageID string, to model.Recipient, m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	from := mail.Address{Name: s.cfg.From.Name, Address: s.cfg.From.Email}
+	recipient := mail.Address{Name: to.Name, Address: to.Email}
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s>\r\n", messageID)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := parts.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,189 @@
+package notification_test
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"loan-engine/model"
+	"loan-engine/notification"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSession is what the fake server received in one session.
+type smtpSession struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// startFakeSMTP accepts a single SMTP session without TLS or authentication
+// and sends what it received on the returned channel.
+func startFakeSMTP(t *testing.T) (string, int, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		_ = tp.PrintfLine("220 localhost fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO", "HELO":
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 8BITMIME")
+			case "MAIL":
+				s.from = line
+				_ = tp.PrintfLine("250 OK")
+			case "RCPT":
+				s.to = append(s.to, line)
+				_ = tp.PrintfLine("250 OK")
+			case "DATA":
+				_ = tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				s.data, err = tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 Bye")
+				sessions <- s
+				return
+			default:
+				_ = tp.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	n, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return host, n, sessions
+}
+
+func TestSMTPChannel(t *testing.T) {
+	host, port, sessions := startFakeSMTP(t)
+	channel := notification.NewSMTPChannel(notification.SMTPConfig{
+		Host: host,
+		Port: port,
+		From: model.Recipient{Name: "Loan Service", Email: "loans@example.com"},
+	})
+
+	m := notification.Message{
+		Subject: "Pinjaman Disetujui – Loan Approved",
+		Text:    "Dear José,\n\nYour loan is approved.\n",
+		HTML:    "<p>Dear José,</p>\n<p>Your loan is approved.</p>\n",
+	}
+	messageID, err := channel.Send(context.Background(), model.Recipient{Name: "José Álvarez", Email: "jose@example.com"}, m)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(messageID, "@example.com"), messageID)
+
+	var s smtpSession
+	select {
+	case s = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fake SMTP server received no session")
+	}
+	assert.Equal(t, "MAIL FROM:<loans@example.com> BODY=8BITMIME", s.from)
+	assert.Equal(t, []string{"RCPT TO:<jose@example.com>"}, s.to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(s.data)))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, m.Subject, subject)
+	to, err := msg.Header.AddressList("To")
+	require.NoError(t, err)
+	assert.Equal(t, "José Álvarez", to[0].Name)
+	assert.Equal(t, "<"+messageID+">", msg.Header.Get("Message-ID"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	// The parts are decoded from quoted-printable by the reader
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		bodies = append(bodies, part.Header.Get("Content-Type")+"\n"+string(body))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8\n" + m.Text,
+		"text/html; charset=utf-8\n" + m.HTML,
+	}, bodies)
+}
+
+func TestSMTPChannelUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	channel := notification.NewSMTPChannel(notification.SMTPConfig{Host: "127.0.0.1", Port: addr.Port, From: model.Recipient{Email: "loans@example.com"}})
+	_, err = channel.Send(context.Background(), model.Recipient{Email: "jose@example.com"}, notification.Message{Subject: "Hello"})
+	assert.Error(t, err)
+}
+
+func TestSMTPChannelTimeout(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+
+	channel := notification.NewSMTPChannel(notification.SMTPConfig{
+		Host:    "127.0.0.1",
+		Port:    addr.Port,
+		From:    model.Recipient{Email: "loans@example.com"},
+		Timeout: 100 * time.Millisecond,
+	})
+	start := time.Now()
+	_, err = channel.Send(context.Background(), model.Recipient{Email: "jose@example.com"}, notification.Message{Subject: "Hello"})
+
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
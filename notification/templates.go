@@ -0,0 +1,208 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"loan-engine/model"
+)
+
+//go:embed templates/*.txt templates/*.html
+var defaultTemplates embed.FS
+
+// Templates holds the notification templates keyed by type and locale.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// NewTemplates parses every "<type>.<locale>.txt" and "<type>.<locale>.html"
+// file at the root of fsys. The text/template renders the plain text body and
+// defines the "subject" template; the html/template next to it renders the
+// HTML body. Both are required for every type in model.DefaultLocale, which
+// is used for recipients whose locale has no templates.
+func NewTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	textNames, err := fs.Glob(fsys, "*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range textNames {
+		key, locale, err := templateKey(name, ".txt")
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(localeFuncs(locale))).Option("missingkey=error").ParseFS(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse notification template %s: %w", name, err)
+		}
+		if tmpl.Lookup("subject") == nil {
+			return nil, fmt.Errorf("notification template %s does not define the subject", name)
+		}
+		t.text[key] = tmpl
+	}
+
+	htmlNames, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range htmlNames {
+		key, locale, err := templateKey(name, ".html")
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(localeFuncs(locale))).Option("missingkey=error").ParseFS(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse notification template %s: %w", name, err)
+		}
+		if _, ok := t.text[key]; !ok {
+			return nil, fmt.Errorf("notification template %s has no %s.txt", name, key)
+		}
+		t.html[key] = tmpl
+	}
+
+	for key := range t.text {
+		if _, ok := t.html[key]; !ok {
+			return nil, fmt.Errorf("notification template %s.txt has no %s.html", key, key)
+		}
+	}
+	for _, typ := range model.NotificationTypes {
+		key := string(typ) + "." + model.DefaultLocale
+		if _, ok := t.text[key]; !ok {
+			return nil, fmt.Errorf("notification templates %s.txt and %s.html are missing", key, key)
+		}
+	}
+	return t, nil
+}
+
+// DefaultTemplates returns the templates built into the binary.
+func DefaultTemplates() *Templates {
+	fsys, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	t, err := NewTemplates(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// templateKey returns the "<type>.<locale>" key and the locale of a template file.
+func templateKey(name, ext string) (string, string, error) {
+	typ, locale, ok := strings.Cut(strings.TrimSuffix(name, ext), ".")
+	if !ok || !model.IsValidLocale(locale) {
+		return "", "", fmt.Errorf("notification template %s is not named <type>.<locale>%s", name, ext)
+	}
+	if !model.IsKnownNotificationType(model.NotificationType(typ)) {
+		return "", "", fmt.Errorf("notification template %s is for unknown type %q", name, typ)
+	}
+	locale = normalizeLocale(locale)
+	return typ + "." + locale, locale, nil
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// Render executes the templates of the notification's type in the most
+// specific locale available for the recipient: "pt-br" falls back to "pt",
+// then to model.DefaultLocale.
+func (t *Templates) Render(n model.Notification) (Message, error) {
+	if !model.IsKnownNotificationType(n.Type) {
+		return Message{}, fmt.Errorf("%w: unknown notification type %q", model.ErrValidationFailed, n.Type)
+	}
+
+	locale := normalizeLocale(n.To.Locale)
+	for {
+		if _, ok := t.text[string(n.Type)+"."+locale]; ok {
+			break
+		}
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			locale = model.DefaultLocale
+			break
+		}
+		locale = locale[:i]
+	}
+	key := string(n.Type) + "." + locale
+
+	var subject, text, body bytes.Buffer
+	err := t.text[key].ExecuteTemplate(&subject, "subject", n)
+	if err == nil {
+		err = t.text[key].Execute(&text, n)
+	}
+	if err == nil {
+		err = t.html[key].Execute(&body, n)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to execute notification template %s: %w", key, err)
+	}
+
+	return Message{
+		Locale:  locale,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    body.String(),
+	}, nil
+}
+
+// Preview renders the templates of the type in the locale with sample data.
+func (t *Templates) Preview(typ model.NotificationType, locale string) (Message, error) {
+	return t.Render(SampleNotification(typ, locale))
+}
+
+// SampleNotification returns a notification of the type with made-up data,
+// addressed to an investor in the locale unless only borrowers get the type.
+func SampleNotification(typ model.NotificationType, locale string) model.Notification {
+	n := model.Notification{
+		Type:         typ,
+		LoanID:       "3f2b8c1e-5d4a-4e6b-9c7d-0a1b2c3d4e5f",
+		To:           model.Recipient{Name: "Siti Rahayu", Email: "siti@example.com", Locale: locale},
+		InvestmentID: "8a7b6c5d-4e3f-4a1b-8c9d-0e1f2a3b4c5d",
+		Currency:     model.DefaultCurrency,
+		Amount:       model.NewMoney(2500000),
+		Date:         time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	}
+	switch typ {
+	case model.NotificationLoanApproved:
+		n.InvestmentID = ""
+		n.Amount = model.NewMoney(12000000)
+	case model.NotificationInvestmentAgreement:
+		n.URL = "https://loans.example.com/documents/sample?expires=1709283600&signature=sample"
+	}
+	return n
+}
+
+var (
+	englishMonths    = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	indonesianMonths = []string{"Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli", "Agustus", "September", "Oktober", "November", "Desember"}
+)
+
+// localeFuncs returns the template functions formatting amounts and dates
+// the way the locale's language writes them.
+func localeFuncs(locale string) map[string]interface{} {
+	thousands, decimal, months := ",", ".", englishMonths
+	if language, _, _ := strings.Cut(locale, "-"); language == "id" {
+		thousands, decimal, months = ".", ",", indonesianMonths
+	}
+
+	return map[string]interface{}{
+		"money": func(currency string, m model.Money) string {
+			return currency + " " + m.Grouped(thousands, decimal)
+		},
+		"date": func(t time.Time) string {
+			return fmt.Sprintf("%d %s %d", t.Day(), months[t.Month()-1], t.Year())
+		},
+	}
+}
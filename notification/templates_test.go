@@ -0,0 +1,167 @@
+package notification_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"loan-engine/model"
+	"loan-engine/notification"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderDefaultTemplates(t *testing.T) {
+	templates := notification.DefaultTemplates()
+	loan := &model.Loan{ID: "loan-123", Currency: "IDR", PrincipalAmount: model.NewMoney(1250000), BorrowerName: "Budi", BorrowerEmail: "budi@example.com"}
+	loan.Approval.ApprovalDate.Time = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	investment := model.Investment{ID: "investment-1", Name: "Jane <Doe>", Email: "jane@example.com", Amount: model.NewMoney(400000)}
+	loan.Investments = []model.Investment{investment}
+	expiredAt := time.Date(2024, 8, 17, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		notification model.Notification
+		subject      string
+		text         string
+	}{
+		{"Loan approved", model.NewLoanApprovedNotification(loan), "Loan Approved", "Your loan loan-123 of IDR 1,250,000.00 has been approved on 1 March 2024"},
+		{"Investment confirmed", model.NewInvestmentConfirmedNotification(loan, investment), "Investment Confirmed", "We received your investment of IDR 400,000.00 in loan loan-123."},
+		{"Investment agreement", model.NewInvestmentAgreementNotification(loan, investment, "https://example.com/documents/1?a=1&b=2"), "Loan Investment Agreement", "\nhttps://example.com/documents/1?a=1&b=2\n"},
+		{"Loan disbursed to borrower", model.NewLoanDisbursedNotifications(loan)[0], "Loan Disbursed", "Your loan loan-123 of IDR 1,250,000.00 has been disbursed"},
+		{"Loan disbursed to investor", model.NewLoanDisbursedNotifications(loan)[1], "Loan Disbursed", "Your investment of IDR 400,000.00 now earns its return."},
+		{"Funding expired", model.NewFundingExpiredNotifications(loan, expiredAt)[0], "Loan Funding Expired", "Your investment of IDR 400,000.00 is now refundable."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := templates.Render(tc.notification)
+			require.NoError(t, err)
+			assert.Equal(t, model.DefaultLocale, m.Locale)
+			assert.Equal(t, tc.subject, m.Subject)
+			assert.Contains(t, m.Text, tc.text)
+			assert.True(t, strings.HasPrefix(m.Text, "Dear "+tc.notification.To.Name+",\n"))
+			assert.NotContains(t, m.HTML, "<Doe>", "names are escaped in the HTML body")
+		})
+	}
+
+	t.Run("Agreement link", func(t *testing.T) {
+		m, err := templates.Render(model.NewInvestmentAgreementNotification(loan, investment, "https://example.com/documents/1?a=1&b=2"))
+		require.NoError(t, err)
+		assert.Contains(t, m.HTML, `<a href="https://example.com/documents/1?a=1&amp;b=2">`)
+	})
+
+	t.Run("Unknown type", func(t *testing.T) {
+		_, err := templates.Render(model.Notification{Type: "unknown"})
+		assert.ErrorIs(t, err, model.ErrValidationFailed)
+	})
+}
+
+func TestRenderLocale(t *testing.T) {
+	templates := notification.DefaultTemplates()
+	loan := &model.Loan{ID: "loan-123", Currency: "IDR"}
+	expiredAt := time.Date(2024, 8, 17, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		locale       string
+		expectLocale string
+		expectText   string
+	}{
+		{locale: "id", expectLocale: "id", expectText: "Investasi Anda sebesar IDR 1.250.000,50 kini dapat dikembalikan."},
+		{locale: "id-ID", expectLocale: "id", expectText: "Investasi Anda sebesar IDR 1.250.000,50"},
+		{locale: "ID_id", expectLocale: "id", expectText: "Yth. Siti,"},
+		{locale: "en-GB", expectLocale: "en", expectText: "Your investment of IDR 1,250,000.50 is now refundable."},
+		{locale: "fr", expectLocale: "en", expectText: "Dear Siti,"},
+		{locale: "", expectLocale: "en", expectText: "Dear Siti,"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.locale, func(t *testing.T) {
+			loan.Investments = []model.Investment{{ID: "investment-1", Name: "Siti", Email: "siti@example.com", Locale: tc.locale, Amount: model.MustParseMoney("1250000.50")}}
+
+			m, err := templates.Render(model.NewFundingExpiredNotifications(loan, expiredAt)[0])
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectLocale, m.Locale)
+			assert.Contains(t, m.Text, tc.expectText)
+		})
+	}
+
+	t.Run("Localized date", func(t *testing.T) {
+		n := notification.SampleNotification(model.NotificationLoanApproved, "id")
+		m, err := templates.Render(n)
+		require.NoError(t, err)
+		assert.Equal(t, "Pinjaman Disetujui", m.Subject)
+		assert.Contains(t, m.Text, "pada 1 Maret 2024")
+	})
+}
+
+func TestPreviewEveryTemplate(t *testing.T) {
+	templates := notification.DefaultTemplates()
+	for _, typ := range model.NotificationTypes {
+		for _, locale := range []string{"en", "id"} {
+			m, err := templates.Preview(typ, locale)
+			require.NoError(t, err, "%s.%s", typ, locale)
+			assert.Equal(t, locale, m.Locale)
+			assert.NotEmpty(t, m.Subject)
+			assert.NotContains(t, m.Text, "<no value>")
+			assert.Contains(t, m.HTML, "Siti Rahayu")
+		}
+	}
+}
+
+func TestNewTemplatesErrors(t *testing.T) {
+	// Complete default templates to start each case from
+	valid := func() fstest.MapFS {
+		fsys := fstest.MapFS{}
+		for _, typ := range model.NotificationTypes {
+			fsys[string(typ)+".en.txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Subject{{end}}Text`)}
+			fsys[string(typ)+".en.html"] = &fstest.MapFile{Data: []byte(`<p>HTML</p>`)}
+		}
+		return fsys
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		_, err := notification.NewTemplates(valid())
+		assert.NoError(t, err)
+	})
+
+	testCases := []struct {
+		name   string
+		change func(fstest.MapFS)
+		expect string
+	}{
+		{"Missing default locale", func(fsys fstest.MapFS) {
+			delete(fsys, "loan_approved.en.txt")
+			delete(fsys, "loan_approved.en.html")
+		}, "loan_approved.en.txt and loan_approved.en.html are missing"},
+		{"Missing HTML alternative", func(fsys fstest.MapFS) {
+			fsys["loan_approved.id.txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Subjek{{end}}Teks`)}
+		}, "has no loan_approved.id.html"},
+		{"Missing text template", func(fsys fstest.MapFS) {
+			fsys["loan_approved.id.html"] = &fstest.MapFile{Data: []byte(`<p>HTML</p>`)}
+		}, "has no loan_approved.id.txt"},
+		{"Missing subject", func(fsys fstest.MapFS) {
+			fsys["loan_approved.en.txt"] = &fstest.MapFile{Data: []byte(`Text`)}
+		}, "does not define the subject"},
+		{"Unknown type", func(fsys fstest.MapFS) {
+			fsys["loan_rejected.en.txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Subject{{end}}Text`)}
+		}, "unknown type"},
+		{"Name without locale", func(fsys fstest.MapFS) {
+			fsys["loan_approved.txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Subject{{end}}Text`)}
+		}, "is not named <type>.<locale>.txt"},
+		{"Invalid template", func(fsys fstest.MapFS) {
+			fsys["loan_approved.en.html"] = &fstest.MapFile{Data: []byte(`{{.To`)}
+		}, "failed to parse notification template loan_approved.en.html"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := valid()
+			tc.change(fsys)
+			_, err := notification.NewTemplates(fsys)
+			assert.ErrorContains(t, err, tc.expect)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"loan-engine/model"
+	"time"
+)
+
+// ErrIdempotencyKeyNotFound is returned when no record exists for the key.
+var ErrIdempotencyKeyNotFound = fmt.Errorf("idempotency key %w", ErrNotFound)
+
+type IdempotencyRepositoryInterface interface {
+	Claim(ctx context.Context, record *model.IdempotencyRecord, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, actorID, key string) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *model.IdempotencyRecord) error
+	Release(ctx context.Context, actorID, key string) error
+}
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepositoryInterface {
+	return &IdempotencyRepository{db: db}
+}
+
+// Claim reserves the key for a new request. It returns false when the key is
+// already taken by a record younger than ttl.
+func (r *IdempotencyRepository) Claim(ctx context.Context, record *model.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	_, err := r.db.ExecContext(ctx, `
+        DELETE FROM idempotency_keys
+        WHERE actor_id = $1 AND key = $2 AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $3)
+    `, record.ActorID, record.Key, ttl.Seconds())
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO idempotency_keys (actor_id, key, request_hash)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (actor_id, key) DO NOTHING
+    `, record.ActorID, record.Key, record.RequestHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *IdempotencyRepository) Get(ctx context.Context, actorID, key string) (*model.IdempotencyRecord, error) {
+	query := `
+        SELECT actor_id, key, request_hash, status_code, content_type, response_body, created_at, completed_at
+        FROM idempotency_keys
+        WHERE actor_id = $1 AND key = $2
+    `
+
+	var (
+		record      model.IdempotencyRecord
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+		completedAt sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, query, actorID, key).Scan(
+		&record.ActorID, &record.Key, &record.RequestHash, &statusCode, &contentType,
+		&record.ResponseBody, &record.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		return nil, err
+	}
+
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+
+	return &record, nil
+}
+
+// Complete stores the response of the request that claimed the key.
+func (r *IdempotencyRepository) Complete(ctx context.Context, record *model.IdempotencyRecord) error {
+	query := `
+        UPDATE idempotency_keys SET
+            status_code = $1,
+            content_type = $2,
+            response_body = $3,
+            completed_at = CURRENT_TIMESTAMP
+        WHERE actor_id = $4 AND key = $5
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		record.StatusCode, record.ContentType, record.ResponseBody, record.ActorID, record.Key,
+	)
+
+	return err
+}
+
+// Release frees the key so the client can retry, e.g. after a server error.
+func (r *IdempotencyRepository) Release(ctx context.Context, actorID, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE actor_id = $1 AND key = $2`, actorID, key)
+
+	return err
+}
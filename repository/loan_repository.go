@@ -3,20 +3,61 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"loan-engine/model"
 	"log"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrNotFound is matched by every "not found" error of the repositories.
+	ErrNotFound = errors.New("not found")
+	// ErrConcurrentModification is returned when an optimistic lock version check fails.
+	ErrConcurrentModification = errors.New("loan not updated: concurrent modification")
+
+	// ErrLoanNotFound is returned when the requested loan does not exist.
+	ErrLoanNotFound = fmt.Errorf("loan %w", ErrNotFound)
+	// ErrInvestmentNotFound is returned when the requested investment does not exist on the loan.
+	ErrInvestmentNotFound = fmt.Errorf("investment %w", ErrNotFound)
+	// ErrDocumentNotFound is returned when the requested document does not exist.
+	ErrDocumentNotFound = fmt.Errorf("document %w", ErrNotFound)
+	// ErrNotificationAttemptNotFound is returned when the requested notification attempt does not exist on the loan.
+	ErrNotificationAttemptNotFound = fmt.Errorf("notification %w", ErrNotFound)
+)
+
 type LoanRepositoryInterface interface {
 	Create(ctx context.Context, loan *model.Loan) (string, error)
 	CreateInvestment(ctx context.Context, loan *model.Loan) error
 	CreateTransition(ctx context.Context, t *model.Transition) error
+	GetTransitions(ctx context.Context, loanID string) ([]model.Transition, error)
+	CreateOutboxEvent(ctx context.Context, e *model.OutboxEvent) error
+	CreateDocument(ctx context.Context, d *model.Document) error
+	GetDocuments(ctx context.Context, loanID string) ([]model.Document, error)
+	GetDocument(ctx context.Context, id string) (*model.Document, error)
+	CreateNotificationAttempt(ctx context.Context, a *model.NotificationAttempt) error
+	GetNotificationAttempts(ctx context.Context, loanID string) ([]model.NotificationAttempt, error)
+	GetNotificationAttempt(ctx context.Context, loanID, id string) (*model.NotificationAttempt, error)
 	Update(ctx context.Context, loan *model.Loan) error
+	UpdateDocumentStatus(ctx context.Context, loan *model.Loan) error
 	GetLoan(ctx context.Context, id string) (*model.Loan, error)
+	GetLoanForUpdate(ctx context.Context, id string) (*model.Loan, error)
+	List(ctx context.Context, filter model.LoanFilter) ([]model.Loan, error)
+	GetExpiredLoanIDs(ctx context.Context, now time.Time, limit int) ([]string, error)
+	LockExpiredLoan(ctx context.Context, id string, now time.Time) (*model.Loan, error)
 	GetInvestments(ctx context.Context, loanID string) ([]model.Investment, error)
+	GetInvestment(ctx context.Context, loanID, investmentID string) (*model.Investment, error)
+	UpdateInvestmentStatus(ctx context.Context, investmentID string, status model.InvestmentStatus) error
+	SetInvestmentsStatus(ctx context.Context, loanID string, status model.InvestmentStatus) (int64, error)
+	CreateInstallments(ctx context.Context, installments []model.Installment) error
+	GetInstallments(ctx context.Context, loanID string) ([]model.Installment, error)
+	UpdateInstallment(ctx context.Context, installment *model.Installment) error
+	CreateRepayment(ctx context.Context, repayment *model.Repayment) (string, error)
+	CreatePayouts(ctx context.Context, payouts []model.InvestorPayout) error
+	GetPayoutsByLoan(ctx context.Context, loanID string) ([]model.InvestorPayout, error)
+	GetPayoutsByInvestor(ctx context.Context, investorID string) ([]model.InvestorPayout, error)
 	WithTransaction(ctx context.Context, fn func(rTx LoanRepositoryInterface) error) error
 }
 
@@ -47,14 +88,15 @@ func (r *LoanRepository) getDB() dbExecutor {
 func (r *LoanRepository) Create(ctx context.Context, loan *model.Loan) (string, error) {
 	query := `
         INSERT INTO loans (
-            id, borrower_id, principal_amount, rate, roi, state
-        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5) RETURNING id
+            id, borrower_id, borrower_name, borrower_email, principal_amount, currency, rate, roi,
+            tenor, repayment_frequency, interest_method, product, state
+        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id
     `
 
 	var newID string
 	row := r.getDB().QueryRowContext(ctx, query,
-		loan.BorrowerID, loan.PrincipalAmount,
-		loan.Rate, loan.ROI, loan.State,
+		loan.BorrowerID, loan.BorrowerName, loan.BorrowerEmail, loan.PrincipalAmount, loan.Currency,
+		loan.Rate, loan.ROI, loan.Tenor, loan.RepaymentFrequency, loan.InterestMethod, loan.Product, loan.State,
 	)
 
 	// Scan the row to retrieve the ID
@@ -66,52 +108,277 @@ func (r *LoanRepository) Create(ctx context.Context, loan *model.Loan) (string,
 	return newID, nil
 }
 
+// CreateInvestment inserts loan.NewInvestment and sets its ID and creation time.
 func (r *LoanRepository) CreateInvestment(ctx context.Context, loan *model.Loan) error {
 	query := `
         INSERT INTO loan_investments (
-            id, loan_id, investor_id, investor_name, email, amount
-        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5)
+            id, loan_id, investor_id, investor_name, email, locale, amount, status
+        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, created_at
     `
-	_, err := r.getDB().ExecContext(ctx, query,
-		loan.ID, loan.NewInvestment.InvestorID, loan.NewInvestment.Name, loan.NewInvestment.Email, loan.NewInvestment.Amount,
-	)
-
-	return err
+	return r.getDB().QueryRowContext(ctx, query,
+		loan.ID, loan.NewInvestment.InvestorID, loan.NewInvestment.Name, loan.NewInvestment.Email, loan.NewInvestment.Locale, loan.NewInvestment.Amount,
+		loan.NewInvestment.Status,
+	).Scan(&loan.NewInvestment.ID, &loan.NewInvestment.CreatedAt)
 }
 
 func (r *LoanRepository) CreateTransition(ctx context.Context, t *model.Transition) error {
 	query := `
         INSERT INTO loan_state_transitions (
-            loan_id, previous_state, event, next_state
-        ) VALUES ($1, $2, $3, $4)
+            loan_id, previous_state, event, next_state, actor_id, request_id, payload
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, transition_time
     `
-	_, err := r.getDB().ExecContext(ctx, query,
+	return r.getDB().QueryRowContext(ctx, query,
 		t.LoanID, t.PreviousState, t.Event, t.NextState,
-	)
+		nullString(t.ActorID), nullString(t.RequestID), nullJSON(t.Payload),
+	).Scan(&t.ID, &t.TransitionTime)
+}
 
-	return err
+// CreateOutboxEvent stores a domain event for the dispatcher. Call it on the
+// transaction of the state change so the event is committed together with it.
+func (r *LoanRepository) CreateOutboxEvent(ctx context.Context, e *model.OutboxEvent) error {
+	query := `
+        INSERT INTO outbox_events (event_type, loan_id, payload)
+        VALUES ($1, $2, $3)
+        RETURNING id, status, available_at, created_at
+    `
+	return r.getDB().QueryRowContext(ctx, query, e.EventType, e.LoanID, e.Payload).
+		Scan(&e.ID, &e.Status, &e.AvailableAt, &e.CreatedAt)
+}
+
+func (r *LoanRepository) CreateDocument(ctx context.Context, d *model.Document) error {
+	query := `
+        INSERT INTO documents (id, loan_id, investment_id, kind, storage_key, content_type, size_bytes, sha256)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, created_at
+    `
+	return r.getDB().QueryRowContext(ctx, query, d.LoanID, nullString(d.InvestmentID), d.Kind, d.StorageKey, d.ContentType, d.Size, d.SHA256).
+		Scan(&d.ID, &d.CreatedAt)
+}
+
+// documentColumns lists the documents columns in the order expected by scanDocument.
+const documentColumns = `id, loan_id, investment_id, kind, storage_key, content_type, size_bytes, sha256, created_at`
+
+func scanDocument(row rowScanner) (*model.Document, error) {
+	var d model.Document
+	var investmentID sql.NullString
+	err := row.Scan(&d.ID, &d.LoanID, &investmentID, &d.Kind, &d.StorageKey, &d.ContentType, &d.Size, &d.SHA256, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.InvestmentID = investmentID.String
+
+	return &d, nil
+}
+
+// GetDocuments returns the documents of the loan, newest first.
+func (r *LoanRepository) GetDocuments(ctx context.Context, loanID string) ([]model.Document, error) {
+	query := `
+        SELECT ` + documentColumns + `
+        FROM documents
+        WHERE loan_id = $1
+        ORDER BY created_at DESC, id
+    `
+
+	rows, err := r.getDB().QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []model.Document
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning document row: %w", err)
+		}
+		documents = append(documents, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating document rows: %w", err)
+	}
+
+	return documents, nil
 }
 
+func (r *LoanRepository) GetDocument(ctx context.Context, id string) (*model.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id = $1`
+
+	d, err := scanDocument(r.getDB().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (r *LoanRepository) CreateNotificationAttempt(ctx context.Context, a *model.NotificationAttempt) error {
+	payload, err := json.Marshal(a.Notification)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+
+	query := `
+        INSERT INTO notification_attempts (id, loan_id, investment_id, type, recipient_email, locale, payload,
+            provider, provider_message_id, status, error, resent_from)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING id, created_at
+    `
+	return r.getDB().QueryRowContext(ctx, query, a.LoanID, nullString(a.InvestmentID), a.Type, a.Recipient.Email, a.Locale, string(payload),
+		a.Provider, nullString(a.ProviderMessageID), a.Status, nullString(a.Error), nullString(a.ResentFrom)).
+		Scan(&a.ID, &a.CreatedAt)
+}
+
+// notificationAttemptColumns lists the notification_attempts columns in the order expected by scanNotificationAttempt.
+const notificationAttemptColumns = `id, loan_id, investment_id, type, locale, payload, provider, provider_message_id, status, error, resent_from, created_at`
+
+func scanNotificationAttempt(row rowScanner) (*model.NotificationAttempt, error) {
+	var a model.NotificationAttempt
+	var investmentID, providerMessageID, errMsg, resentFrom sql.NullString
+	var payload []byte
+	err := row.Scan(&a.ID, &a.LoanID, &investmentID, &a.Type, &a.Locale, &payload, &a.Provider, &providerMessageID,
+		&a.Status, &errMsg, &resentFrom, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(payload, &a.Notification)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding notification %s: %w", a.ID, err)
+	}
+	a.InvestmentID = investmentID.String
+	a.Recipient = a.Notification.To
+	a.ProviderMessageID = providerMessageID.String
+	a.Error = errMsg.String
+	a.ResentFrom = resentFrom.String
+
+	return &a, nil
+}
+
+// GetNotificationAttempts returns the notification attempts of the loan, newest first.
+func (r *LoanRepository) GetNotificationAttempts(ctx context.Context, loanID string) ([]model.NotificationAttempt, error) {
+	query := `
+        SELECT ` + notificationAttemptColumns + `
+        FROM notification_attempts
+        WHERE loan_id = $1
+        ORDER BY created_at DESC, id
+    `
+
+	rows, err := r.getDB().QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notification attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []model.NotificationAttempt
+	for rows.Next() {
+		a, err := scanNotificationAttempt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning notification attempt row: %w", err)
+		}
+		attempts = append(attempts, *a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification attempt rows: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (r *LoanRepository) GetNotificationAttempt(ctx context.Context, loanID, id string) (*model.NotificationAttempt, error) {
+	query := `SELECT ` + notificationAttemptColumns + ` FROM notification_attempts WHERE loan_id = $1 AND id = $2`
+
+	a, err := scanNotificationAttempt(r.getDB().QueryRowContext(ctx, query, loanID, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotificationAttemptNotFound
+		}
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (r *LoanRepository) GetTransitions(ctx context.Context, loanID string) ([]model.Transition, error) {
+	query := `
+        SELECT id, loan_id, previous_state, event, next_state, actor_id, request_id, payload, transition_time
+        FROM loan_state_transitions
+        WHERE loan_id = $1
+        ORDER BY transition_time, id
+    `
+
+	rows, err := r.getDB().QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transitions: %w", err)
+	}
+	defer rows.Close()
+
+	transitions := []model.Transition{}
+	for rows.Next() {
+		var (
+			t                  model.Transition
+			actorID, requestID sql.NullString
+			payload            []byte
+		)
+		err := rows.Scan(
+			&t.ID,
+			&t.LoanID,
+			&t.PreviousState,
+			&t.Event,
+			&t.NextState,
+			&actorID,
+			&requestID,
+			&payload,
+			&t.TransitionTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning transition row: %w", err)
+		}
+		t.ActorID = actorID.String
+		t.RequestID = requestID.String
+		t.Payload = payload
+		transitions = append(transitions, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transition rows: %w", err)
+	}
+
+	return transitions, nil
+}
+
+// Update writes the state and the request fields of the loan, guarded by its
+// version. The agreement columns are written by UpdateDocumentStatus only.
 func (r *LoanRepository) Update(ctx context.Context, loan *model.Loan) error {
 	query := `
         UPDATE loans SET
-            total_investment_amount = total_investment_amount + $1, 
+            total_investment_amount = total_investment_amount + $1,
 			state = $2, 
 			field_validator_id = $3,
 			proof_image_url = $4,
 			approval_date = $5,
-			agreement_letter_url = $6,
-			field_officer_id = $7,
-			signed_agreement_letter_url = $8,
-			disbursement_date = $9,
+			field_officer_id = $6,
+			signed_agreement_letter_url = $7,
+			disbursement_date = $8,
+			rejection_validator_id = $9,
+			rejection_reason = $10,
+			rejection_date = $11,
+			cancellation_reason = $12,
+			cancellation_date = $13,
+			funding_deadline = $14,
 			version = version + 1
-        WHERE id = $10 AND version = $11
+        WHERE id = $15 AND version = $16
     `
 
 	res, err := r.getDB().ExecContext(ctx, query,
-		loan.NewInvestment.Amount, loan.State,
-		loan.Approval.FieldValidatorID, loan.Approval.ProofImageURL, loan.Approval.ApprovalDate, loan.AgreementLetterURL,
+		loan.InvestmentDelta(), loan.State,
+		loan.Approval.FieldValidatorID, loan.Approval.ProofImageURL, loan.Approval.ApprovalDate,
 		loan.Disbursement.FieldOfficerID, loan.Disbursement.SignedAgreementLetterURL, loan.Disbursement.DisbursementDate,
+		loan.Rejection.FieldValidatorID, loan.Rejection.Reason, loan.Rejection.RejectionDate,
+		loan.Cancellation.Reason, loan.Cancellation.CancellationDate, loan.Approval.FundingDeadline,
 		loan.ID, loan.Version,
 	)
 	if err != nil {
@@ -125,30 +392,147 @@ func (r *LoanRepository) Update(ctx context.Context, loan *model.Loan) error {
 		return nil
 	}
 
-	return errors.New("loan not updated")
+	return ErrConcurrentModification
 }
 
-func (r *LoanRepository) GetLoan(ctx context.Context, id string) (*model.Loan, error) {
+// UpdateDocumentStatus writes the document status, document error and
+// agreement URL of the loan. It leaves the version alone, so the background
+// agreement generation never conflicts with state transitions.
+func (r *LoanRepository) UpdateDocumentStatus(ctx context.Context, loan *model.Loan) error {
 	query := `
-        SELECT 
-            id, borrower_id, principal_amount, total_investment_amount, rate, roi, state,
-			field_validator_id, proof_image_url, approval_date, agreement_letter_url, field_officer_id,
-            signed_agreement_letter_url, disbursement_date, version
-        FROM loans WHERE id = $1
+        UPDATE loans SET
+            document_status = $1,
+            document_error = $2,
+            agreement_letter_url = $3
+        WHERE id = $4
     `
+	res, err := r.getDB().ExecContext(ctx, query,
+		nullString(string(loan.DocumentStatus)), nullString(loan.DocumentError), loan.AgreementLetterURL, loan.ID,
+	)
+	if err != nil {
+		return err
+	}
 
-	loan := &model.Loan{}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrLoanNotFound
+	}
+	return nil
+}
+
+// loanColumns lists the loans columns in the order expected by scanLoan.
+const loanColumns = `
+            id, borrower_id, borrower_name, borrower_email, principal_amount, currency, total_investment_amount, rate, roi,
+            tenor, repayment_frequency, interest_method, product, state,
+			field_validator_id, proof_image_url, approval_date, funding_deadline, agreement_letter_url, field_officer_id,
+            signed_agreement_letter_url, disbursement_date, rejection_validator_id, rejection_reason,
+            rejection_date, cancellation_reason, cancellation_date, document_status, document_error,
+            version, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	err := r.getDB().QueryRowContext(ctx, query, id).Scan(
-		&loan.ID, &loan.BorrowerID, &loan.PrincipalAmount, &loan.TotalInvestmentAmount,
-		&loan.Rate, &loan.ROI, &loan.State, &loan.Approval.FieldValidatorID, &loan.Approval.ProofImageURL,
-		&loan.Approval.ApprovalDate, &loan.AgreementLetterURL, &loan.Disbursement.FieldOfficerID, &loan.Disbursement.SignedAgreementLetterURL,
-		&loan.Disbursement.DisbursementDate, &loan.Version,
+func scanLoan(row rowScanner) (*model.Loan, error) {
+	loan := &model.Loan{}
+	var documentStatus, documentError sql.NullString
+
+	err := row.Scan(
+		&loan.ID, &loan.BorrowerID, &loan.BorrowerName, &loan.BorrowerEmail, &loan.PrincipalAmount, &loan.Currency, &loan.TotalInvestmentAmount,
+		&loan.Rate, &loan.ROI, &loan.Tenor, &loan.RepaymentFrequency, &loan.InterestMethod, &loan.Product, &loan.State, &loan.Approval.FieldValidatorID, &loan.Approval.ProofImageURL,
+		&loan.Approval.ApprovalDate, &loan.Approval.FundingDeadline, &loan.AgreementLetterURL, &loan.Disbursement.FieldOfficerID, &loan.Disbursement.SignedAgreementLetterURL,
+		&loan.Disbursement.DisbursementDate, &loan.Rejection.FieldValidatorID, &loan.Rejection.Reason,
+		&loan.Rejection.RejectionDate, &loan.Cancellation.Reason, &loan.Cancellation.CancellationDate,
+		&documentStatus, &documentError,
+		&loan.Version, &loan.CreatedAt, &loan.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	loan.DocumentStatus = model.DocumentStatus(documentStatus.String)
+	loan.DocumentError = documentError.String
+
+	return loan, nil
+}
+
+func (r *LoanRepository) GetLoan(ctx context.Context, id string) (*model.Loan, error) {
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE id = $1`
+
+	loan, err := scanLoan(r.getDB().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+
+	return loan, nil
+}
+
+// GetLoanForUpdate reads the loan with SELECT ... FOR UPDATE, blocking other
+// writers until the transaction ends, so it must run inside WithTransaction.
+func (r *LoanRepository) GetLoanForUpdate(ctx context.Context, id string) (*model.Loan, error) {
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE id = $1 FOR UPDATE`
+
+	loan, err := scanLoan(r.getDB().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+
+	return loan, nil
+}
+
+// expiredLoanCondition matches under-funded approved loans whose funding
+// deadline has passed before $2.
+const expiredLoanCondition = `state = $1 AND funding_deadline < $2 AND total_investment_amount < principal_amount`
+
+// GetExpiredLoanIDs returns the IDs of up to limit under-funded approved loans
+// whose funding deadline has passed, earliest deadline first.
+func (r *LoanRepository) GetExpiredLoanIDs(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	query := `SELECT id FROM loans
+        WHERE ` + expiredLoanCondition + `
+        ORDER BY funding_deadline
+        LIMIT $3`
+
+	rows, err := r.getDB().QueryContext(ctx, query, model.StateApproved, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying expired loans: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning loan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating loan ids: %w", err)
+	}
+
+	return ids, nil
+}
 
+// LockExpiredLoan locks the loan if it is still under-funded, approved and
+// past its funding deadline. A loan that no longer is, or that another
+// instance has locked, is reported as ErrLoanNotFound. It must run inside
+// WithTransaction.
+func (r *LoanRepository) LockExpiredLoan(ctx context.Context, id string, now time.Time) (*model.Loan, error) {
+	query := `SELECT ` + loanColumns + ` FROM loans
+        WHERE ` + expiredLoanCondition + ` AND id = $3
+        FOR UPDATE SKIP LOCKED`
+
+	loan, err := scanLoan(r.getDB().QueryRowContext(ctx, query, model.StateApproved, now, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("loan not found")
+			return nil, ErrLoanNotFound
 		}
 		return nil, err
 	}
@@ -156,9 +540,80 @@ func (r *LoanRepository) GetLoan(ctx context.Context, id string) (*model.Loan, e
 	return loan, nil
 }
 
+// List returns the loans matching the filter using keyset pagination on (created_at, id).
+func (r *LoanRepository) List(ctx context.Context, f model.LoanFilter) ([]model.Loan, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	addCondition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if f.State != "" {
+		addCondition("state = $%d", f.State)
+	}
+	if f.BorrowerID != "" {
+		addCondition("borrower_id = $%d", f.BorrowerID)
+	}
+	if f.MinPrincipal != nil {
+		addCondition("principal_amount >= $%d", *f.MinPrincipal)
+	}
+	if f.MaxPrincipal != nil {
+		addCondition("principal_amount <= $%d", *f.MaxPrincipal)
+	}
+	if f.CreatedFrom != nil {
+		addCondition("created_at >= $%d", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		addCondition("created_at < $%d", *f.CreatedTo)
+	}
+
+	comparator, order := "<", "DESC"
+	if f.Sort == model.SortAsc {
+		comparator, order = ">", "ASC"
+	}
+	if f.Cursor != nil {
+		addCondition("(created_at, id) "+comparator+" ($%d, $%d)", f.Cursor.CreatedAt, f.Cursor.ID)
+	}
+
+	query := `SELECT ` + loanColumns + ` FROM loans`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(` ORDER BY created_at %s, id %s LIMIT $%d`, order, order, len(args))
+
+	rows, err := r.getDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying loans: %w", err)
+	}
+	defer rows.Close()
+
+	loans := []model.Loan{}
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning loan row: %w", err)
+		}
+		loans = append(loans, *loan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating loan rows: %w", err)
+	}
+
+	return loans, nil
+}
+
 func (r *LoanRepository) GetInvestments(ctx context.Context, loanID string) ([]model.Investment, error) {
 	query := `
-        SELECT investor_id, investor_name, email, amount 
+        SELECT id, investor_id, investor_name, email, locale, amount, status, created_at
         FROM loan_investments 
         WHERE loan_id = $1
         ORDER BY created_at
@@ -174,10 +629,14 @@ func (r *LoanRepository) GetInvestments(ctx context.Context, loanID string) ([]m
 	for rows.Next() {
 		var inv model.Investment
 		err := rows.Scan(
+			&inv.ID,
 			&inv.InvestorID,
 			&inv.Name,
 			&inv.Email,
+			&inv.Locale,
 			&inv.Amount,
+			&inv.Status,
+			&inv.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning investment row: %w", err)
@@ -192,7 +651,239 @@ func (r *LoanRepository) GetInvestments(ctx context.Context, loanID string) ([]m
 	return investments, nil
 }
 
-func (r *LoanRepository) WithTransaction(ctx context.Context, fn func(rTx LoanRepositoryInterface) error) error {
+func (r *LoanRepository) GetInvestment(ctx context.Context, loanID, investmentID string) (*model.Investment, error) {
+	query := `
+        SELECT id, investor_id, investor_name, email, locale, amount, status, created_at
+        FROM loan_investments
+        WHERE loan_id = $1 AND id = $2
+    `
+
+	var inv model.Investment
+	err := r.getDB().QueryRowContext(ctx, query, loanID, investmentID).Scan(
+		&inv.ID,
+		&inv.InvestorID,
+		&inv.Name,
+		&inv.Email,
+		&inv.Locale,
+		&inv.Amount,
+		&inv.Status,
+		&inv.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvestmentNotFound
+		}
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+func (r *LoanRepository) UpdateInvestmentStatus(ctx context.Context, investmentID string, status model.InvestmentStatus) error {
+	query := `UPDATE loan_investments SET status = $1 WHERE id = $2`
+	_, err := r.getDB().ExecContext(ctx, query, status, investmentID)
+
+	return err
+}
+
+// SetInvestmentsStatus moves every active investment of the loan to status and returns how many were changed.
+func (r *LoanRepository) SetInvestmentsStatus(ctx context.Context, loanID string, status model.InvestmentStatus) (int64, error) {
+	query := `
+        UPDATE loan_investments SET status = $1
+        WHERE loan_id = $2 AND status = $3
+    `
+	res, err := r.getDB().ExecContext(ctx, query, status, loanID, model.InvestmentActive)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *LoanRepository) CreateInstallments(ctx context.Context, installments []model.Installment) error {
+	query := `
+        INSERT INTO loan_installments (
+            id, loan_id, number, due_date, principal, interest, fee, amount, status
+        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	for _, in := range installments {
+		_, err := r.getDB().ExecContext(ctx, query,
+			in.LoanID, in.Number, in.DueDate, in.Principal, in.Interest, in.Fee, in.Amount, in.Status,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting installment %d: %w", in.Number, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *LoanRepository) GetInstallments(ctx context.Context, loanID string) ([]model.Installment, error) {
+	query := `
+        SELECT
+            id, loan_id, number, due_date, principal, interest, fee, amount,
+            paid_principal, paid_interest, paid_fee, status
+        FROM loan_installments
+        WHERE loan_id = $1
+        ORDER BY number
+    `
+
+	rows, err := r.getDB().QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying installments: %w", err)
+	}
+	defer rows.Close()
+
+	installments := []model.Installment{}
+	for rows.Next() {
+		var in model.Installment
+		err := rows.Scan(
+			&in.ID,
+			&in.LoanID,
+			&in.Number,
+			&in.DueDate,
+			&in.Principal,
+			&in.Interest,
+			&in.Fee,
+			&in.Amount,
+			&in.PaidPrincipal,
+			&in.PaidInterest,
+			&in.PaidFee,
+			&in.Status,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning installment row: %w", err)
+		}
+		installments = append(installments, in)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating installment rows: %w", err)
+	}
+
+	return installments, nil
+}
+
+func (r *LoanRepository) UpdateInstallment(ctx context.Context, in *model.Installment) error {
+	query := `
+        UPDATE loan_installments SET
+            fee = $1,
+            paid_principal = $2,
+            paid_interest = $3,
+            paid_fee = $4,
+            status = $5
+        WHERE id = $6
+    `
+	_, err := r.getDB().ExecContext(ctx, query,
+		in.Fee, in.PaidPrincipal, in.PaidInterest, in.PaidFee, in.Status, in.ID,
+	)
+
+	return err
+}
+
+func (r *LoanRepository) CreateRepayment(ctx context.Context, repayment *model.Repayment) (string, error) {
+	query := `
+        INSERT INTO loan_repayments (
+            id, loan_id, amount, paid_at, reference
+        ) VALUES (gen_random_uuid(), $1, $2, $3, $4) RETURNING id
+    `
+
+	var newID string
+	err := r.getDB().QueryRowContext(ctx, query,
+		repayment.LoanID, repayment.Amount, repayment.PaidAt, nullString(repayment.Reference),
+	).Scan(&newID)
+	if err != nil {
+		return "", err
+	}
+
+	allocationQuery := `
+        INSERT INTO loan_repayment_allocations (
+            repayment_id, installment_id, fee, interest, principal
+        ) VALUES ($1, $2, $3, $4, $5)
+    `
+	for _, a := range repayment.Allocations {
+		_, err := r.getDB().ExecContext(ctx, allocationQuery,
+			newID, a.InstallmentID, a.Fee, a.Interest, a.Principal,
+		)
+		if err != nil {
+			return "", fmt.Errorf("error inserting allocation for installment %d: %w", a.InstallmentNumber, err)
+		}
+	}
+
+	return newID, nil
+}
+
+func (r *LoanRepository) CreatePayouts(ctx context.Context, payouts []model.InvestorPayout) error {
+	query := `
+        INSERT INTO loan_investor_payouts (
+            id, loan_id, repayment_id, investment_id, investor_id, principal, roi, amount
+        ) VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7)
+    `
+
+	for _, p := range payouts {
+		_, err := r.getDB().ExecContext(ctx, query,
+			p.LoanID, p.RepaymentID, p.InvestmentID, p.InvestorID, p.Principal, p.ROI, p.Amount,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting payout for investment %s: %w", p.InvestmentID, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *LoanRepository) GetPayoutsByLoan(ctx context.Context, loanID string) ([]model.InvestorPayout, error) {
+	return r.queryPayouts(ctx, `WHERE p.loan_id = $1`, loanID)
+}
+
+func (r *LoanRepository) GetPayoutsByInvestor(ctx context.Context, investorID string) ([]model.InvestorPayout, error) {
+	return r.queryPayouts(ctx, `WHERE p.investor_id = $1`, investorID)
+}
+
+func (r *LoanRepository) queryPayouts(ctx context.Context, where string, args ...interface{}) ([]model.InvestorPayout, error) {
+	query := `
+        SELECT p.id, p.loan_id, p.repayment_id, p.investment_id, p.investor_id, p.principal, p.roi, p.amount, l.currency, p.created_at
+        FROM loan_investor_payouts p
+        JOIN loans l ON l.id = p.loan_id ` + where + `
+        ORDER BY p.created_at, p.id
+    `
+
+	rows, err := r.getDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying payouts: %w", err)
+	}
+	defer rows.Close()
+
+	payouts := []model.InvestorPayout{}
+	for rows.Next() {
+		var p model.InvestorPayout
+		err := rows.Scan(
+			&p.ID,
+			&p.LoanID,
+			&p.RepaymentID,
+			&p.InvestmentID,
+			&p.InvestorID,
+			&p.Principal,
+			&p.ROI,
+			&p.Amount,
+			&p.Currency,
+			&p.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payout row: %w", err)
+		}
+		payouts = append(payouts, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating payout rows: %w", err)
+	}
+
+	return payouts, nil
+}
+
+func (r *LoanRepository) WithTransaction(ctx context.Context, fn func(rTx LoanRepositoryInterface) error) (err error) {
 	startTime := time.Now()
 
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -213,6 +904,10 @@ func (r *LoanRepository) WithTransaction(ctx context.Context, fn func(rTx LoanRe
 			log.Println("Transaction rolled back due to error:", err)
 		} else {
 			err = tx.Commit()
+			if err != nil {
+				log.Println("Transaction commit failed:", err)
+				return
+			}
 			log.Println("Transaction committed successfully")
 		}
 
@@ -221,3 +916,16 @@ func (r *LoanRepository) WithTransaction(ctx context.Context, fn func(rTx LoanRe
 	err = fn(&LoanRepository{db: r.db, tx: tx})
 	return err
 }
+
+// nullString maps an empty string to SQL NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullJSON maps an empty JSON document to SQL NULL; otherwise it is sent as text so Postgres can cast it to JSONB.
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"loan-engine/model"
+	"sort"
+	"time"
+)
+
+type OutboxRepositoryInterface interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration, dead bool) error
+}
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) OutboxRepositoryInterface {
+	return &OutboxRepository{db: db}
+}
+
+// Claim leases up to limit pending events that are due, oldest first, and
+// counts the attempt. A leased event becomes due again once the lease runs
+// out, so an event whose dispatcher crashed is delivered again. Rows leased
+// by another instance at the same time are skipped.
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	query := `
+        UPDATE outbox_events
+        SET attempts = attempts + 1,
+            available_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+        WHERE id IN (
+            SELECT id FROM outbox_events
+            WHERE status = $3 AND available_at <= CURRENT_TIMESTAMP
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, event_type, loan_id, payload, status, attempts, last_error, available_at, created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds(), model.OutboxPending)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.OutboxEvent
+	for rows.Next() {
+		var (
+			e         model.OutboxEvent
+			lastError sql.NullString
+		)
+		err := rows.Scan(&e.ID, &e.EventType, &e.LoanID, &e.Payload, &e.Status, &e.Attempts, &lastError, &e.AvailableAt, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning outbox event row: %w", err)
+		}
+		e.LastError = lastError.String
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox event rows: %w", err)
+	}
+
+	// UPDATE ... RETURNING does not keep the subquery order
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, id int64) error {
+	query := `
+        UPDATE outbox_events
+        SET status = $2, delivered_at = CURRENT_TIMESTAMP, last_error = NULL
+        WHERE id = $1
+    `
+	_, err := r.db.ExecContext(ctx, query, id, model.OutboxDelivered)
+	return err
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt after
+// retryIn, or moves the event to the dead letters when dead is set.
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration, dead bool) error {
+	status := model.OutboxPending
+	if dead {
+		status = model.OutboxDead
+	}
+
+	query := `
+        UPDATE outbox_events
+        SET status = $2, last_error = $3, available_at = CURRENT_TIMESTAMP + make_interval(secs => $4)
+        WHERE id = $1
+    `
+	_, err := r.db.ExecContext(ctx, query, id, status, lastError, retryIn.Seconds())
+	return err
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"loan-engine/model"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrUserNotFound is returned when the requested user does not exist.
+	ErrUserNotFound = fmt.Errorf("user %w", ErrNotFound)
+	// ErrUsernameTaken is returned when another user already has the username.
+	ErrUsernameTaken = fmt.Errorf("%w: username is already taken", model.ErrValidationFailed)
+)
+
+type UserRepositoryInterface interface {
+	CreateUser(ctx context.Context, u *model.User) error
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	ListUsers(ctx context.Context) ([]model.User, error)
+	UpdateUser(ctx context.Context, u *model.User) error
+}
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepositoryInterface {
+	return &UserRepository{db: db}
+}
+
+const userColumns = `id, username, password_hash, roles, active, created_at, updated_at`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var (
+		u     model.User
+		roles []string
+	)
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, pq.Array(&roles), &u.Active, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		u.Roles = append(u.Roles, model.Role(r))
+	}
+	return &u, nil
+}
+
+func rolesArray(roles []model.Role) interface{} {
+	values := make([]string, len(roles))
+	for i, r := range roles {
+		values[i] = string(r)
+	}
+	return pq.Array(values)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, u *model.User) error {
+	query := `
+        INSERT INTO users (id, username, password_hash, roles, active)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4)
+        RETURNING id, created_at, updated_at
+    `
+	err := r.db.QueryRowContext(ctx, query, u.Username, u.PasswordHash, rolesArray(u.Roles), u.Active).
+		Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+func (r *UserRepository) GetUser(ctx context.Context, id string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	u, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r *UserRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	u, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r *UserRepository) ListUsers(ctx context.Context) ([]model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user row: %w", err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpdateUser saves the password hash, roles and active flag of the user.
+func (r *UserRepository) UpdateUser(ctx context.Context, u *model.User) error {
+	query := `
+        UPDATE users
+        SET password_hash = $1, roles = $2, active = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $4
+        RETURNING updated_at
+    `
+	err := r.db.QueryRowContext(ctx, query, u.PasswordHash, rolesArray(u.Roles), u.Active, u.ID).Scan(&u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"loan-engine/model"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrWebhookSubscriptionNotFound is returned when the subscription does not exist.
+	ErrWebhookSubscriptionNotFound = fmt.Errorf("webhook subscription %w", ErrNotFound)
+	// ErrWebhookDeliveryNotFound is returned when the delivery does not exist for the subscription.
+	ErrWebhookDeliveryNotFound = fmt.Errorf("webhook delivery %w", ErrNotFound)
+)
+
+type WebhookRepositoryInterface interface {
+	CreateSubscription(ctx context.Context, s *model.WebhookSubscription) error
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error)
+	DeactivateSubscription(ctx context.Context, id string) error
+	CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, d *model.WebhookDelivery, a *model.WebhookDeliveryAttempt, retryIn time.Duration) error
+	ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]model.WebhookDelivery, error)
+	GetDelivery(ctx context.Context, subscriptionID, id string) (*model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, subscriptionID, id string) error
+}
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepositoryInterface {
+	return &WebhookRepository{db: db}
+}
+
+const webhookDeliveryColumns = `d.id, d.subscription_id, d.outbox_event_id, d.loan_id, d.event, d.payload, d.status,
+        d.attempts, d.last_status_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at`
+
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (*model.WebhookDelivery, error) {
+	var (
+		d              model.WebhookDelivery
+		lastStatusCode sql.NullInt64
+		lastError      sql.NullString
+		deliveredAt    sql.NullTime
+	)
+	dest := []interface{}{
+		&d.ID, &d.SubscriptionID, &d.OutboxEventID, &d.LoanID, &d.Event, &d.Payload, &d.Status,
+		&d.Attempts, &lastStatusCode, &lastError, &d.NextAttemptAt, &d.CreatedAt, &deliveredAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.LastStatusCode = int(lastStatusCode.Int64)
+	d.LastError = lastError.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return &d, nil
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, s *model.WebhookSubscription) error {
+	query := `
+        INSERT INTO webhook_subscriptions (id, url, secret, events, active)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4)
+        RETURNING id, created_at
+    `
+	return r.db.QueryRowContext(ctx, query, s.URL, s.Secret, pq.Array(s.Events), s.Active).Scan(&s.ID, &s.CreatedAt)
+}
+
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	query := `
+        SELECT id, url, secret, events, active, created_at
+        FROM webhook_subscriptions
+        ORDER BY created_at, id
+    `
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []model.WebhookSubscription
+	for rows.Next() {
+		s, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook subscription row: %w", err)
+		}
+		subscriptions = append(subscriptions, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook subscription rows: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	query := `
+        SELECT id, url, secret, events, active, created_at
+        FROM webhook_subscriptions
+        WHERE id = $1
+    `
+
+	s, err := scanWebhookSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookSubscriptionNotFound
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func scanWebhookSubscription(row rowScanner) (*model.WebhookSubscription, error) {
+	var (
+		s      model.WebhookSubscription
+		events []string
+	)
+	err := row.Scan(&s.ID, &s.URL, &s.Secret, pq.Array(&events), &s.Active, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		s.Events = append(s.Events, model.LoanEvent(e))
+	}
+	return &s, nil
+}
+
+// DeactivateSubscription stops new deliveries to the subscription. Its
+// delivery log is kept.
+func (r *WebhookRepository) DeactivateSubscription(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE webhook_subscriptions SET active = FALSE WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// CreateDeliveries queues the deliveries. A delivery of the same outbox event
+// to the same subscription is only queued once.
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	query := `
+        INSERT INTO webhook_deliveries (id, subscription_id, outbox_event_id, loan_id, event, payload)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4, $5)
+        ON CONFLICT (subscription_id, outbox_event_id) DO NOTHING
+    `
+
+	for _, d := range deliveries {
+		_, err := r.db.ExecContext(ctx, query, d.SubscriptionID, d.OutboxEventID, d.LoanID, d.Event, d.Payload)
+		if err != nil {
+			return fmt.Errorf("error creating webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ClaimDeliveries leases up to limit due deliveries of active subscriptions
+// and counts the attempt, like OutboxRepository.Claim. The subscription URL
+// and secret are loaded with each delivery.
+func (r *WebhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	query := `
+        WITH claimed AS (
+            UPDATE webhook_deliveries
+            SET attempts = attempts + 1,
+                next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+            WHERE id IN (
+                SELECT wd.id FROM webhook_deliveries wd
+                JOIN webhook_subscriptions ws ON ws.id = wd.subscription_id
+                WHERE wd.status = $3 AND wd.next_attempt_at <= CURRENT_TIMESTAMP AND ws.active
+                ORDER BY wd.next_attempt_at
+                LIMIT $1
+                FOR UPDATE OF wd SKIP LOCKED
+            )
+            RETURNING *
+        )
+        SELECT ` + webhookDeliveryColumns + `, s.url, s.secret
+        FROM claimed d
+        JOIN webhook_subscriptions s ON s.id = d.subscription_id
+        ORDER BY d.created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds(), model.WebhookDeliveryPending)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery row: %w", err)
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt logs the attempt and stores the delivery outcome. A pending
+// delivery is tried again after retryIn.
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, d *model.WebhookDelivery, a *model.WebhookDeliveryAttempt, retryIn time.Duration) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Failed to roll back webhook attempt: %v", rbErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, attempted_at
+    `, d.ID, nullInt(a.StatusCode), nullString(a.Error), a.DurationMS).Scan(&a.ID, &a.AttemptedAt)
+	if err != nil {
+		return fmt.Errorf("error logging webhook attempt: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $2,
+            last_status_code = $3,
+            last_error = $4,
+            next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $5),
+            delivered_at = CASE WHEN $2 = 'delivered' THEN CURRENT_TIMESTAMP ELSE delivered_at END
+        WHERE id = $1
+    `, d.ID, d.Status, nullInt(a.StatusCode), nullString(a.Error), retryIn.Seconds())
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of the subscription, newest first.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]model.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + `
+        FROM webhook_deliveries d
+        WHERE d.subscription_id = $1
+        ORDER BY d.created_at DESC, d.id
+        LIMIT $2
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// GetDelivery returns the delivery together with its attempt log, oldest attempt first.
+func (r *WebhookRepository) GetDelivery(ctx context.Context, subscriptionID, id string) (*model.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + `
+        FROM webhook_deliveries d
+        WHERE d.subscription_id = $1 AND d.id = $2
+    `
+
+	d, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, subscriptionID, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, delivery_id, status_code, error, duration_ms, attempted_at
+        FROM webhook_delivery_attempts
+        WHERE delivery_id = $1
+        ORDER BY attempted_at, id
+    `, d.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook attempts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			a          model.WebhookDeliveryAttempt
+			statusCode sql.NullInt64
+			errMsg     sql.NullString
+		)
+		err := rows.Scan(&a.ID, &a.DeliveryID, &statusCode, &errMsg, &a.DurationMS, &a.AttemptedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook attempt row: %w", err)
+		}
+		a.StatusCode = int(statusCode.Int64)
+		a.Error = errMsg.String
+		d.Log = append(d.Log, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook attempt rows: %w", err)
+	}
+
+	return d, nil
+}
+
+// ReplayDelivery queues the delivery again with a fresh attempt budget,
+// whatever its current status. Earlier attempts stay in the log.
+func (r *WebhookRepository) ReplayDelivery(ctx context.Context, subscriptionID, id string) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $3, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+        WHERE subscription_id = $1 AND id = $2
+    `, subscriptionID, id, model.WebhookDeliveryPending)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
+
+// nullInt maps zero to SQL NULL.
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+)
+
+// requestAgreements marks the agreements of the loan as pending and publishes
+// the event that generates them. Call it on the transaction that commits the
+// reason, so the job cannot be lost.
+func (s *LoanService) requestAgreements(ctx context.Context, rTx repo.LoanRepositoryInterface, loan *model.Loan, reason string) error {
+	loan.DocumentStatus = model.DocumentsPending
+	loan.DocumentError = ""
+	err := rTx.UpdateDocumentStatus(ctx, loan)
+	if err != nil {
+		return err
+	}
+
+	return publishEvent(ctx, rTx, model.EventTypeAgreementsRequested, loan.ID, model.AgreementRequest{
+		Reason:    reason,
+		ActorID:   model.ActorFromContext(ctx),
+		RequestID: model.RequestIDFromContext(ctx),
+	})
+}
+
+// RegenerateAgreements queues a new generation of the agreements of a fully
+// funded loan, e.g. after a failed generation or a template change.
+func (s *LoanService) RegenerateAgreements(ctx context.Context, loanID string) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, loanID)
+		if err != nil {
+			return err
+		}
+
+		if loan.DocumentStatus == "" {
+			return fmt.Errorf("%w: loan %s is not fully funded, it has no agreements", model.ErrValidationFailed, loan.ID)
+		}
+
+		return s.requestAgreements(ctx, rTx, loan, "regenerate")
+	})
+}
+
+// HandleAgreementsRequested generates the loan agreement and the letter of
+// every active investment, then records them and marks the loan's documents
+// generated. Rendering and uploading happen outside any transaction. The
+// agreements are dated at the event time, so a redelivered event renders the
+// same documents again instead of new versions. On failure the loan is marked
+// failed and the error returned, so the dispatcher retries the event. It is
+// registered for model.EventTypeAgreementsRequested.
+func (s *LoanService) HandleAgreementsRequested(ctx context.Context, e model.OutboxEvent) error {
+	err := s.generateAgreements(ctx, e.LoanID, e.CreatedAt)
+	if err != nil {
+		s.markAgreementsFailed(ctx, e.LoanID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *LoanService) generateAgreements(ctx context.Context, loanID string, date time.Time) error {
+	loan, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return err
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get investments for loan %s: %w", loan.ID, err)
+	}
+	loan.Investments = model.FilterInvestments(investments, model.InvestmentActive)
+
+	agreementDoc, err := s.GenerateAndUploadLoanAgreement(ctx, loan, date)
+	if err != nil {
+		return err
+	}
+	letters, err := s.GenerateAndUploadInvestmentAgreements(ctx, loan, date)
+	if err != nil {
+		return err
+	}
+	documents := append([]*model.Document{agreementDoc}, letters...)
+
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		// A redelivered event finds its documents already recorded
+		existing, err := rTx.GetDocuments(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		recorded := make(map[string]string, len(existing))
+		for _, d := range existing {
+			recorded[d.StorageKey] = d.ID
+		}
+
+		for _, doc := range documents {
+			if id, ok := recorded[doc.StorageKey]; ok {
+				doc.ID = id
+				continue
+			}
+			err = rTx.CreateDocument(ctx, doc)
+			if err != nil {
+				return err
+			}
+		}
+
+		agreementURL, err := s.DocumentURL(ctx, agreementDoc)
+		if err != nil {
+			return err
+		}
+		// set link agreement url
+		loan.SetAgreementURL(agreementURL)
+		loan.DocumentStatus = model.DocumentsGenerated
+		loan.DocumentError = ""
+		err = rTx.UpdateDocumentStatus(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		return publishEvent(ctx, rTx, model.EventTypeAgreementsGenerated, loan.ID, documents)
+	})
+}
+
+// markAgreementsFailed records the error of a failed generation on the loan.
+func (s *LoanService) markAgreementsFailed(ctx context.Context, loanID string, cause error) {
+	loan, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		log.Printf("Failed to mark agreements of loan %s failed: %v", loanID, err)
+		return
+	}
+
+	loan.DocumentStatus = model.DocumentsFailed
+	loan.DocumentError = cause.Error()
+	err = s.repo.UpdateDocumentStatus(ctx, loan)
+	if err != nil {
+		log.Printf("Failed to mark agreements of loan %s failed: %v", loanID, err)
+	}
+}
+
+// HandleAgreementsGenerated sends every active investor of the loan a link
+// to their own agreement letter. When the event is retried, investors whose
+// letter was already sent for it are skipped. It is registered for
+// model.EventTypeAgreementsGenerated.
+func (s *LoanService) HandleAgreementsGenerated(ctx context.Context, e model.OutboxEvent) error {
+	loan, err := s.repo.GetLoan(ctx, e.LoanID)
+	if err != nil {
+		return err
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get investments for loan %s: %w", loan.ID, err)
+	}
+	loan.Investments = model.FilterInvestments(investments, model.InvestmentActive)
+
+	documents, err := s.repo.GetDocuments(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get documents for loan %s: %w", loan.ID, err)
+	}
+	// Documents come newest first, so the latest letter of each investment wins
+	letters := make(map[string]*model.Document)
+	for i := range documents {
+		doc := &documents[i]
+		if doc.Kind == model.DocumentInvestmentAgreement && letters[doc.InvestmentID] == nil {
+			letters[doc.InvestmentID] = doc
+		}
+	}
+
+	// Letters sent since the event was published went out on an earlier
+	// delivery of it that failed for another investor
+	attempts, err := s.repo.GetNotificationAttempts(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get notifications for loan %s: %w", loan.ID, err)
+	}
+	sent := make(map[string]bool)
+	for _, a := range attempts {
+		if a.Type == model.NotificationInvestmentAgreement && a.Status == model.NotificationSent && !a.CreatedAt.Before(e.CreatedAt) {
+			sent[a.InvestmentID] = true
+		}
+	}
+
+	// Each investor only gets the link to their own letter
+	var errs []error
+	for _, investment := range loan.Investments {
+		if sent[investment.ID] {
+			continue
+		}
+
+		letter, ok := letters[investment.ID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("no agreement letter for investment %s", investment.ID))
+			continue
+		}
+
+		link, err := s.DocumentURL(ctx, letter)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = s.notify(ctx, model.NewInvestmentAgreementNotification(loan, investment, link))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,254 @@
+package service_test
+
+import (
+	"context"
+	"loan-engine/model"
+	"loan-engine/service"
+	"loan-engine/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleAgreementsRequested(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithDocumentStore(store)
+
+	loan := createTestLoan()
+	loan.State = model.StateInvested
+	loan.DocumentStatus = model.DocumentsPending
+	event := model.OutboxEvent{EventType: model.EventTypeAgreementsRequested, LoanID: "loan-123", CreatedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+
+	var created []model.Document
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", InvestorID: "investor-1", Name: "Jane Doe", Amount: model.NewMoney(500), Status: model.InvestmentWithdrawn},
+		{ID: "investment-2", InvestorID: "investor-123", Name: "John Doe", Amount: model.NewMoney(1000), Status: model.InvestmentActive},
+	}, nil)
+	mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+	mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{}, nil).Once()
+	mockRepo.On("CreateDocument", mock.Anything, mock.AnythingOfType("*model.Document")).Run(func(args mock.Arguments) {
+		doc := args.Get(1).(*model.Document)
+		doc.ID = "doc-" + doc.InvestmentID
+		created = append(created, *doc)
+	}).Return(nil)
+	mockRepo.On("UpdateDocumentStatus", mock.Anything, loan).Return(nil)
+	mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+	err = service.HandleAgreementsRequested(ctx, event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.DocumentsGenerated, loan.DocumentStatus)
+	assert.True(t, strings.HasPrefix(loan.AgreementLetterURL.String, "file://"))
+	// One loan agreement and one letter for the active investment
+	assert.Len(t, created, 2)
+	assert.Equal(t, model.DocumentLoanAgreement, created[0].Kind)
+	assert.Equal(t, "investment-2", created[1].InvestmentID)
+	mockRepo.AssertCalled(t, "CreateOutboxEvent", mock.Anything, mock.MatchedBy(func(e *model.OutboxEvent) bool {
+		return e.EventType == model.EventTypeAgreementsGenerated
+	}))
+
+	t.Run("Redelivered event", func(t *testing.T) {
+		// The same event renders the same documents, which are not recorded twice
+		mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return(created, nil)
+
+		err := service.HandleAgreementsRequested(ctx, event)
+
+		assert.NoError(t, err)
+		mockRepo.AssertNumberOfCalls(t, "CreateDocument", 2)
+		assert.Equal(t, model.DocumentsGenerated, loan.DocumentStatus)
+	})
+}
+
+func TestHandleAgreementsRequestedFailure(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	// Without a document store nothing can be uploaded
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+	loan := createTestLoan()
+	loan.State = model.StateInvested
+	loan.DocumentStatus = model.DocumentsPending
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{}, nil)
+	mockRepo.On("UpdateDocumentStatus", mock.Anything, loan).Return(nil)
+
+	err := service.HandleAgreementsRequested(context.Background(), model.OutboxEvent{EventType: model.EventTypeAgreementsRequested, LoanID: "loan-123"})
+
+	// The error is returned so the dispatcher retries the event
+	assert.Error(t, err)
+	assert.Equal(t, model.DocumentsFailed, loan.DocumentStatus)
+	assert.Equal(t, err.Error(), loan.DocumentError)
+	mockRepo.AssertCalled(t, "UpdateDocumentStatus", mock.Anything, loan)
+	mockRepo.AssertNotCalled(t, "CreateDocument", mock.Anything, mock.Anything)
+}
+
+func TestRegenerateAgreements(t *testing.T) {
+	testCases := []struct {
+		name        string
+		state       model.LoanState
+		status      model.DocumentStatus
+		expectError error
+	}{
+		{
+			name:   "Failed generation",
+			state:  model.StateInvested,
+			status: model.DocumentsFailed,
+		},
+		{
+			name:   "Generated agreements",
+			state:  model.StateDisbursed,
+			status: model.DocumentsGenerated,
+		},
+		{
+			name:        "Loan not fully funded",
+			state:       model.StateApproved,
+			expectError: model.ErrValidationFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			loan.DocumentStatus = tc.status
+			loan.DocumentError = "upload failed"
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("UpdateDocumentStatus", mock.Anything, loan).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			err := service.RegenerateAgreements(context.Background(), "loan-123")
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "CreateOutboxEvent", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, model.DocumentsPending, loan.DocumentStatus)
+			assert.Empty(t, loan.DocumentError)
+			mockRepo.AssertCalled(t, "CreateOutboxEvent", mock.Anything, mock.MatchedBy(func(e *model.OutboxEvent) bool {
+				return e.EventType == model.EventTypeAgreementsRequested && strings.Contains(string(e.Payload), `"reason":"regenerate"`)
+			}))
+		})
+	}
+}
+
+func TestHandleAgreementsGenerated(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := service.NewLoanService(mockRepo, mockNotifier).WithDocumentStore(store)
+
+	loan := createTestLoan()
+	loan.State = model.StateInvested
+	loan.SetAgreementURL("file:///documents/agreement.pdf")
+	first := model.Investment{ID: "investment-1", Name: "Jane", Email: "jane@example.com", Status: model.InvestmentActive}
+	second := model.Investment{ID: "investment-3", Name: "John", Email: "john@example.com", Status: model.InvestmentActive}
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		first,
+		{ID: "investment-2", Status: model.InvestmentWithdrawn},
+		second,
+	}, nil)
+	mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{
+		{ID: "doc-4", InvestmentID: "investment-3", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-3.pdf"},
+		{ID: "doc-3", InvestmentID: "investment-1", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-1b.pdf"},
+		{ID: "doc-2", InvestmentID: "investment-1", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-1a.pdf"},
+		{ID: "doc-1", Kind: model.DocumentLoanAgreement, StorageKey: "loans/loan-123/agreement.pdf"},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.Type == model.NotificationInvestmentAgreement && n.InvestmentID == first.ID && strings.HasSuffix(n.URL, "/loans/loan-123/letter-1b.pdf")
+	})).Return(nil)
+	mockNotifier.On("Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.Type == model.NotificationInvestmentAgreement && n.InvestmentID == second.ID && strings.HasSuffix(n.URL, "/loans/loan-123/letter-3.pdf")
+	})).Return(nil)
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return([]model.NotificationAttempt{}, nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+	err = service.HandleAgreementsGenerated(context.Background(), model.OutboxEvent{EventType: model.EventTypeAgreementsGenerated, LoanID: "loan-123"})
+
+	assert.NoError(t, err)
+	mockNotifier.AssertExpectations(t)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	assert.Len(t, loan.Investments, 2)
+}
+
+func TestHandleAgreementsGeneratedRetry(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := service.NewLoanService(mockRepo, mockNotifier).WithDocumentStore(store)
+
+	published := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	loan := createTestLoan()
+	loan.State = model.StateInvested
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", Email: "jane@example.com", Status: model.InvestmentActive},
+		{ID: "investment-2", Email: "john@example.com", Status: model.InvestmentActive},
+		{ID: "investment-3", Email: "joe@example.com", Status: model.InvestmentActive},
+	}, nil)
+	mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{
+		{ID: "doc-3", InvestmentID: "investment-3", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-3.pdf"},
+		{ID: "doc-2", InvestmentID: "investment-2", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-2.pdf"},
+		{ID: "doc-1", InvestmentID: "investment-1", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-1.pdf"},
+	}, nil)
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return([]model.NotificationAttempt{
+		// Sent by the first delivery of this event
+		{InvestmentID: "investment-1", Type: model.NotificationInvestmentAgreement, Status: model.NotificationSent, CreatedAt: published.Add(time.Second)},
+		// Failed on the first delivery
+		{InvestmentID: "investment-2", Type: model.NotificationInvestmentAgreement, Status: model.NotificationFailed, CreatedAt: published.Add(time.Second)},
+		// Sent for letters generated before
+		{InvestmentID: "investment-3", Type: model.NotificationInvestmentAgreement, Status: model.NotificationSent, CreatedAt: published.Add(-time.Hour)},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+	err = service.HandleAgreementsGenerated(context.Background(), model.OutboxEvent{EventType: model.EventTypeAgreementsGenerated, LoanID: "loan-123", CreatedAt: published})
+
+	assert.NoError(t, err)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.InvestmentID == "investment-1"
+	}))
+}
+
+func TestHandleAgreementsGeneratedMissingLetter(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := service.NewLoanService(mockRepo, mockNotifier).WithDocumentStore(store)
+
+	loan := createTestLoan()
+	loan.State = model.StateInvested
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", Email: "jane@example.com", Status: model.InvestmentActive},
+		{ID: "investment-2", Email: "john@example.com", Status: model.InvestmentActive},
+	}, nil)
+	mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{
+		{ID: "doc-2", InvestmentID: "investment-2", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-2.pdf"},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return([]model.NotificationAttempt{}, nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+	err = service.HandleAgreementsGenerated(context.Background(), model.OutboxEvent{EventType: model.EventTypeAgreementsGenerated, LoanID: "loan-123"})
+
+	// The other investor still gets their letter, but the event fails so it is retried
+	assert.ErrorContains(t, err, "investment-1")
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"loan-engine/model"
+)
+
+// DocumentLinks configures the time-limited download links handed out for
+// stored documents, e.g. in agreement emails.
+type DocumentLinks struct {
+	// BaseURL is the public address of the service, e.g. "https://loans.example.com".
+	BaseURL string
+	Secret  string
+	TTL     time.Duration
+}
+
+// WithDocumentLinks makes documents be linked through signed download URLs
+// served by the service instead of links of the document store.
+func (s *LoanService) WithDocumentLinks(l DocumentLinks) *LoanService {
+	s.links = l
+	return s
+}
+
+// DocumentURL returns a download link for the document. Without configured
+// document links it falls back to the link of the document store.
+func (s *LoanService) DocumentURL(ctx context.Context, doc *model.Document) (string, error) {
+	if s.links.Secret == "" {
+		return s.documents.URL(ctx, doc.StorageKey)
+	}
+
+	expires := time.Now().Add(s.links.TTL).Unix()
+	q := url.Values{}
+	q.Set("expires", fmt.Sprint(expires))
+	q.Set("signature", model.SignDocumentLink(s.links.Secret, doc.ID, expires))
+	return fmt.Sprintf("%s/documents/%s?%s", strings.TrimSuffix(s.links.BaseURL, "/"), url.PathEscape(doc.ID), q.Encode()), nil
+}
+
+// VerifyDocumentLink checks the expiry and signature of a link issued by DocumentURL.
+func (s *LoanService) VerifyDocumentLink(documentID string, expires int64, signature string) error {
+	if s.links.Secret == "" {
+		return model.ErrDocumentLinkInvalid
+	}
+	return model.VerifyDocumentLink(s.links.Secret, documentID, expires, signature, time.Now())
+}
+
+// ListDocuments returns the documents of the loan, newest first, each with a download link.
+func (s *LoanService) ListDocuments(ctx context.Context, loanID string) ([]model.Document, error) {
+	// Make sure the loan exists so an unknown ID is reported as not found
+	_, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := s.repo.GetDocuments(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err = s.withoutOthersAgreements(ctx, loanID, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range documents {
+		documents[i].DownloadURL, err = s.DocumentURL(ctx, &documents[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return documents, nil
+}
+
+// GetDocument returns the document and its content, refusing content that no
+// longer matches the recorded hash.
+func (s *LoanService) GetDocument(ctx context.Context, documentID string) (*model.Document, []byte, error) {
+	doc, err := s.repo.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if doc.InvestmentID != "" && model.UserFromContext(ctx) != nil {
+		investment, err := s.repo.GetInvestment(ctx, doc.LoanID, doc.InvestmentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = checkOwner(ctx, investment.InvestorID, "document")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	r, err := s.documents.Get(ctx, doc.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read document %s: %w", doc.ID, err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read document %s: %w", doc.ID, err)
+	}
+
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != doc.SHA256 {
+		return nil, nil, fmt.Errorf("document %s content does not match its hash", doc.ID)
+	}
+
+	return doc, body, nil
+}
+
+// withoutOthersAgreements drops the investment agreements of other investors,
+// which only staff and the investor they were written for may see.
+func (s *LoanService) withoutOthersAgreements(ctx context.Context, loanID string, documents []model.Document) ([]model.Document, error) {
+	user := model.UserFromContext(ctx)
+	if user == nil || user.HasRole(model.RoleStaff) {
+		return documents, nil
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	own := make(map[string]bool)
+	for _, inv := range investments {
+		if inv.InvestorID == user.ID {
+			own[inv.ID] = true
+		}
+	}
+
+	visible := documents[:0]
+	for _, doc := range documents {
+		if doc.InvestmentID == "" || own[doc.InvestmentID] {
+			visible = append(visible, doc)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"context"
+	"loan-engine/model"
+	"loan-engine/repository"
+	"loan-engine/service"
+	"loan-engine/storage"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func storeDocument(t *testing.T, store storage.DocumentStore, body string) *model.Document {
+	doc := model.NewDocument("loan-123", model.DocumentLoanAgreement, "application/pdf", "pdf", []byte(body))
+	doc.ID = "doc-1"
+	assert.NoError(t, store.Put(context.Background(), doc.StorageKey, []byte(body), doc.ContentType))
+	return doc
+}
+
+func TestListDocumentsSignsDownloadLinks(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	doc := storeDocument(t, store, "%PDF-agreement")
+
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier)).
+		WithDocumentStore(store).
+		WithDocumentLinks(service.DocumentLinks{BaseURL: "https://loans.example.com/", Secret: "link-secret", TTL: time.Hour})
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+	mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{*doc}, nil)
+
+	documents, err := service.ListDocuments(ctx, "loan-123")
+	assert.NoError(t, err)
+	assert.Len(t, documents, 1)
+
+	link, err := url.Parse(documents[0].DownloadURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "loans.example.com", link.Host)
+	assert.Equal(t, "/documents/doc-1", link.Path)
+	assert.NotContains(t, documents[0].DownloadURL, doc.StorageKey)
+
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	assert.NoError(t, err)
+	assert.NoError(t, service.VerifyDocumentLink("doc-1", expires, link.Query().Get("signature")))
+	assert.ErrorIs(t, service.VerifyDocumentLink("doc-2", expires, link.Query().Get("signature")), model.ErrDocumentLinkInvalid)
+}
+
+func TestListDocumentsUnknownLoan(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+	mockRepo.On("GetLoan", mock.Anything, "missing").Return(nil, repository.ErrLoanNotFound)
+
+	_, err := service.ListDocuments(context.Background(), "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	mockRepo.AssertNotCalled(t, "GetDocuments", mock.Anything, mock.Anything)
+}
+
+func TestGetDocument(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name        string
+		stored      string
+		recorded    string
+		expectError bool
+	}{
+		{name: "Content matches hash", stored: "%PDF-agreement", recorded: "%PDF-agreement"},
+		{name: "Content was altered", stored: "%PDF-forged", recorded: "%PDF-agreement", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := storage.NewLocalStore(t.TempDir())
+			assert.NoError(t, err)
+			doc := storeDocument(t, store, tc.recorded)
+			// Overwrite the object behind the recorded hash
+			assert.NoError(t, store.Put(ctx, doc.StorageKey, []byte(tc.stored), doc.ContentType))
+
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithDocumentStore(store)
+			mockRepo.On("GetDocument", mock.Anything, "doc-1").Return(doc, nil)
+
+			got, body, err := service.GetDocument(ctx, "doc-1")
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, doc, got)
+			assert.True(t, strings.HasPrefix(string(body), "%PDF"))
+		})
+	}
+}
+
+func TestInvestmentAgreementAccess(t *testing.T) {
+	investor := &model.User{ID: "investor-123", Roles: []model.Role{model.RoleInvestor}}
+	otherInvestor := &model.User{ID: "investor-456", Roles: []model.Role{model.RoleInvestor}}
+	staff := &model.User{ID: "staff-1", Roles: []model.Role{model.RoleStaff}}
+
+	testCases := []struct {
+		name        string
+		user        *model.User
+		expectError error
+	}{
+		{name: "Owning investor", user: investor},
+		{name: "Staff", user: staff},
+		{name: "Signed link without a user"},
+		{name: "Another investor", user: otherInvestor, expectError: model.ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.user != nil {
+				ctx = model.ContextWithUser(ctx, tc.user)
+			}
+			store, err := storage.NewLocalStore(t.TempDir())
+			assert.NoError(t, err)
+			loanAgreement := storeDocument(t, store, "%PDF-loan")
+			letter := model.NewDocument("loan-123", model.DocumentInvestmentAgreement, "application/pdf", "pdf", []byte("%PDF-letter"))
+			letter.ID = "doc-2"
+			letter.InvestmentID = "inv-1"
+			assert.NoError(t, store.Put(ctx, letter.StorageKey, []byte("%PDF-letter"), letter.ContentType))
+
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithDocumentStore(store)
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+			mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{*loanAgreement, *letter}, nil)
+			mockRepo.On("GetDocument", mock.Anything, "doc-2").Return(letter, nil)
+			mockRepo.On("GetInvestment", mock.Anything, "loan-123", "inv-1").Return(&model.Investment{ID: "inv-1", InvestorID: "investor-123"}, nil)
+			mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{{ID: "inv-1", InvestorID: "investor-123"}}, nil)
+
+			_, _, err = service.GetDocument(ctx, "doc-2")
+			documents, listErr := service.ListDocuments(ctx, "loan-123")
+			assert.NoError(t, listErr)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				assert.Len(t, documents, 1)
+				assert.Equal(t, "doc-1", documents[0].ID)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, documents, 2)
+			}
+		})
+	}
+}
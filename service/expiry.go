@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+)
+
+// ExpireLoans moves up to batchSize approved loans past their funding deadline
+// to "expired" and marks their investments as refundable. Each loan is expired
+// in its own transaction, so a loan that fails is logged and counted without
+// holding back the rest. Loans are locked with SELECT ... FOR UPDATE SKIP
+// LOCKED, so several instances can run it at once. The investors are notified
+// through the loan.expired event published with each expiry.
+func (s *LoanService) ExpireLoans(ctx context.Context, now time.Time, batchSize int) (expired, failed int, err error) {
+	ids, err := s.repo.GetExpiredLoanIDs(ctx, now, batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, id := range ids {
+		ok, err := s.expireLoan(ctx, id, now)
+		switch {
+		case err != nil:
+			log.Printf("Failed to expire loan %s: %v", id, err)
+			failed++
+		case ok:
+			expired++
+		}
+	}
+
+	return expired, failed, nil
+}
+
+// expireLoan expires the loan unless another instance has locked it or it no
+// longer qualifies, in which case it reports false.
+func (s *LoanService) expireLoan(ctx context.Context, loanID string, now time.Time) (bool, error) {
+	expired := false
+
+	err := s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := rTx.LockExpiredLoan(ctx, loanID, now)
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		loan.ExpiryCheckedAt = now
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "expired". The query only returns loans the rule
+		// accepts, so a failure means the data is inconsistent.
+		err = loanStateMachine.Transition(loan, model.EventExpire)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		_, err = rTx.SetInvestmentsStatus(ctx, loan.ID, model.InvestmentRefundable)
+		if err != nil {
+			return err
+		}
+
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventExpire, loanStateMachine.GetCurrentState(), loan.Approval)
+		if err != nil {
+			return err
+		}
+
+		err = recordTransition(ctx, rTx, transition)
+		if err != nil {
+			return err
+		}
+
+		err = publish(ctx, rTx, model.EventTypeLoanExpired, transition)
+		if err != nil {
+			return err
+		}
+
+		expired = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return expired, nil
+}
+
+// RunExpiryScheduler calls ExpireLoans every interval until ctx is cancelled.
+func (s *LoanService) RunExpiryScheduler(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep draining while full batches expire; failed loans come
+			// back first, so they end the run until the next tick
+			for {
+				n, failed, err := s.ExpireLoans(ctx, time.Now(), batchSize)
+				if err != nil {
+					log.Printf("Failed to expire loans: %v", err)
+					break
+				}
+				if n > 0 || failed > 0 {
+					log.Printf("Expired %d under-funded loans, %d failed", n, failed)
+				}
+				if n < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -1,110 +1,78 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"loan-engine/model"
-	"mime/multipart"
-	"net/http"
-	"os"
+	"time"
 
-	"github.com/jung-kurt/gofpdf"
+	"loan-engine/agreement"
+	"loan-engine/model"
 )
 
-// generate file
-func (s *LoanService) GenerateLoanAgreement(l *model.Loan) (string, error) {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(190, 10, "Loan Agreement")
-	pdf.Ln(20)
-
-	pdf.SetFont("Arial", "", 12)
-	pdf.MultiCell(190, 10, fmt.Sprintf(`
-This Loan Agreement is made between:
-
-Borrower: %s
-Loan ID: %s
-Principal Amount: %.2f
-
-By signing this agreement, the borrower agrees to repay the loan in accordance with the terms specified herein.
-`, l.BorrowerID, l.ID, l.PrincipalAmount), "", "", false)
-
-	// Save to file
-	fileName := fmt.Sprintf("loan_agreement_%s.pdf", l.ID)
-	err := pdf.OutputFileAndClose(fileName)
+// GenerateLoanAgreement renders the agreement PDF of the loan dated date from
+// the template of its product, listing the investments on l.Investments.
+func (s *LoanService) GenerateLoanAgreement(l *model.Loan, date time.Time) ([]byte, error) {
+	data, err := agreement.NewData(l, date)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return fileName, nil
+	return s.agreements.Render(data)
 }
 
-func (s *LoanService) UploadToFileIO(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+// GenerateAndUploadLoanAgreement renders the agreement of the loan, puts it in
+// the document store and returns its document record. The caller saves the record.
+func (s *LoanService) GenerateAndUploadLoanAgreement(ctx context.Context, l *model.Loan, date time.Time) (*model.Document, error) {
+	if s.documents == nil {
+		return nil, errors.New("document store is not configured")
 	}
-	defer file.Close()
 
-	// Create a new multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filePath)
+	// Generate the PDF
+	body, err := s.GenerateLoanAgreement(l, date)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to generate PDF: %w", err)
 	}
-	_, err = io.Copy(part, file)
+
+	// Upload the file to the document store
+	doc := model.NewDocument(l.ID, model.DocumentLoanAgreement, "application/pdf", "pdf", body)
+	err = s.documents.Put(ctx, doc.StorageKey, body, doc.ContentType)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to upload file: %w", err)
 	}
-	writer.Close()
 
-	// Send POST request to File.io
-	req, err := http.NewRequest("POST", "https://file.io", body)
-	if err != nil {
-		return "", err
+	return doc, nil
+}
+
+// GenerateAndUploadInvestmentAgreements renders an agreement letter for every
+// active investment on l.Investments, puts them in the document store and
+// returns their document records. The caller saves the records.
+func (s *LoanService) GenerateAndUploadInvestmentAgreements(ctx context.Context, l *model.Loan, date time.Time) ([]*model.Document, error) {
+	if s.documents == nil {
+		return nil, errors.New("document store is not configured")
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	data, err := agreement.NewData(l, date)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Parse response
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if result["success"].(bool) {
-		// Delete the file after successful upload
-		err = os.Remove(filePath)
+	var documents []*model.Document
+	for _, investment := range agreement.NewInvestmentData(data) {
+		// Generate the PDF
+		body, err := s.agreements.RenderInvestment(investment)
 		if err != nil {
-			return "", fmt.Errorf("file uploaded, but failed to delete local file: %w", err)
+			return nil, fmt.Errorf("failed to generate PDF for investment %s: %w", investment.Investment.ID, err)
 		}
 
-		return result["link"].(string), nil
-	}
-	return "", fmt.Errorf("upload failed: %v", result)
-}
-
-func (s *LoanService) GenerateAndUploadLoanAgreement(l *model.Loan) (string, error) {
-	// Generate the PDF
-	filePath, err := s.GenerateLoanAgreement(l)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate PDF: %w", err)
-	}
-
-	// Upload the file to File.io
-	link, err := s.UploadToFileIO(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+		// Upload the file to the document store
+		doc := model.NewDocument(l.ID, model.DocumentInvestmentAgreement, "application/pdf", "pdf", body)
+		doc.InvestmentID = investment.Investment.ID
+		err = s.documents.Put(ctx, doc.StorageKey, body, doc.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload file for investment %s: %w", investment.Investment.ID, err)
+		}
+		documents = append(documents, doc)
 	}
 
-	return link, nil
+	return documents, nil
 }
-
-// validate file
@@ -2,38 +2,237 @@ package service
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
 
+	"loan-engine/agreement"
 	"loan-engine/model"
 	repo "loan-engine/repository"
+	"loan-engine/storage"
 )
 
-type EmailService interface {
-	SendInvestmentAgreement(ctx context.Context, agreementURL string, loan *model.Loan) error
+// Notifier delivers notifications to borrowers and investors, e.g. by email.
+// It returns the record of the attempt whether it was sent or not.
+type Notifier interface {
+	Notify(ctx context.Context, n model.Notification) (model.NotificationAttempt, error)
 }
 
 type LoanService struct {
-	repo  repo.LoanRepositoryInterface
-	email EmailService
+	repo       repo.LoanRepositoryInterface
+	notifier   Notifier
+	retry      RetryPolicy
+	locking    LockingStrategy
+	documents  storage.DocumentStore
+	links      DocumentLinks
+	agreements *agreement.Renderer
+	lateFee    model.Money
 }
 
-func NewLoanService(repo repo.LoanRepositoryInterface, email EmailService) *LoanService {
-	return &LoanService{repo: repo, email: email}
+func NewLoanService(repo repo.LoanRepositoryInterface, notifier Notifier) *LoanService {
+	return &LoanService{
+		repo:       repo,
+		notifier:   notifier,
+		retry:      DefaultRetryPolicy,
+		locking:    LockingOptimistic,
+		agreements: agreement.DefaultRenderer(),
+	}
+}
+
+// WithAgreementRenderer replaces the built-in agreement templates.
+func (s *LoanService) WithAgreementRenderer(r *agreement.Renderer) *LoanService {
+	s.agreements = r
+	return s
+}
+
+// WithDocumentStore sets where generated agreements are kept.
+func (s *LoanService) WithDocumentStore(d storage.DocumentStore) *LoanService {
+	s.documents = d
+	return s
+}
+
+// WithLateFee sets the fee charged once on every installment still unpaid
+// after its due date, collected before its interest and principal.
+func (s *LoanService) WithLateFee(fee model.Money) *LoanService {
+	s.lateFee = fee
+	return s
+}
+
+// WithRetryPolicy sets how state transitions are retried after a version conflict.
+func (s *LoanService) WithRetryPolicy(p RetryPolicy) *LoanService {
+	s.retry = p
+	return s
+}
+
+// GetLoanPayouts returns the payout ledger of the loan. Users other than
+// staff only see the payouts of their own investments.
+func (s *LoanService) GetLoanPayouts(ctx context.Context, loanID string) ([]model.InvestorPayout, error) {
+	_, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	payouts, err := s.repo.GetPayoutsByLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := model.UserFromContext(ctx)
+	if user == nil || user.HasRole(model.RoleStaff) {
+		return payouts, nil
+	}
+	own := payouts[:0]
+	for _, p := range payouts {
+		if p.InvestorID == user.ID {
+			own = append(own, p)
+		}
+	}
+	return own, nil
+}
+
+// GetInvestorPayouts returns the payout ledger of the investor across all loans.
+func (s *LoanService) GetInvestorPayouts(ctx context.Context, investorID string) ([]model.InvestorPayout, error) {
+	err := checkOwner(ctx, investorID, "payouts")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPayoutsByInvestor(ctx, investorID)
+}
+
+// GetSchedule returns the repayment schedule generated when the loan was disbursed.
+func (s *LoanService) GetSchedule(ctx context.Context, loanID string) ([]model.Installment, error) {
+	_, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetInstallments(ctx, loanID)
+}
+
+// GetTransitions returns the state transition timeline of the loan, oldest first.
+func (s *LoanService) GetTransitions(ctx context.Context, loanID string) ([]model.Transition, error) {
+	// Make sure the loan exists so an unknown ID is reported as not found
+	_, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetTransitions(ctx, loanID)
+}
+
+// GetLoan returns the loan together with its investments.
+func (s *LoanService) GetLoan(ctx context.Context, loanID string) (*model.Loan, error) {
+	loan, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loan.ID)
+	if err != nil {
+		return nil, err
+	}
+	loan.Investments = investments
+	hideOtherInvestors(ctx, loan)
+
+	return loan, nil
+}
+
+// hideOtherInvestors clears who made the investments of other investors,
+// keeping the amounts. Only staff and the investor themselves may see them.
+func hideOtherInvestors(ctx context.Context, loans ...*model.Loan) {
+	user := model.UserFromContext(ctx)
+	if user == nil || user.HasRole(model.RoleStaff) {
+		return
+	}
+
+	for _, loan := range loans {
+		for i, inv := range loan.Investments {
+			if inv.InvestorID != user.ID {
+				loan.Investments[i] = model.Investment{
+					ID:        inv.ID,
+					Amount:    inv.Amount,
+					Status:    inv.Status,
+					CreatedAt: inv.CreatedAt,
+				}
+			}
+		}
+	}
+}
+
+// ListLoans returns one page of loans matching the filter and the cursor for the next page.
+func (s *LoanService) ListLoans(ctx context.Context, f model.LoanFilter) (*model.LoanPage, error) {
+	if f.Limit <= 0 {
+		f.Limit = model.DefaultPageSize
+	}
+	if f.Limit > model.MaxPageSize {
+		f.Limit = model.MaxPageSize
+	}
+	if f.Sort != model.SortAsc {
+		f.Sort = model.SortDesc
+	}
+
+	pageSize := f.Limit
+	// Fetch one extra row to know whether another page exists
+	f.Limit++
+	loans, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range loans {
+		hideOtherInvestors(ctx, &loans[i])
+	}
+
+	page := &model.LoanPage{Loans: loans}
+	if len(loans) > pageSize {
+		page.Loans = loans[:pageSize]
+		last := page.Loans[pageSize-1]
+		page.NextCursor = model.LoanCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
 }
 
 func (s *LoanService) CreateLoan(ctx context.Context, r model.CreateLoanRequest) (*model.Loan, error) {
+	var err error
+	r.BorrowerID, err = ownerFor(ctx, r.BorrowerID, "borrower_id")
+	if err != nil {
+		return nil, err
+	}
+
 	var loanID string
+	if r.Currency == "" {
+		r.Currency = model.DefaultCurrency
+	}
+	if r.RepaymentFrequency == "" {
+		r.RepaymentFrequency = model.FrequencyMonthly
+	}
+	if r.InterestMethod == "" {
+		r.InterestMethod = model.InterestFlat
+	}
+	if r.Product == "" {
+		r.Product = model.DefaultProduct
+	}
 	loan := &model.Loan{
-		BorrowerID:      r.BorrowerID,
-		PrincipalAmount: r.PrincipalAmount,
-		Rate:            r.Rate,
-		ROI:             r.ROI,
-		State:           model.StateProposed,
+		BorrowerID:         r.BorrowerID,
+		BorrowerName:       r.BorrowerName,
+		BorrowerEmail:      r.BorrowerEmail,
+		PrincipalAmount:    r.PrincipalAmount,
+		Currency:           r.Currency,
+		Rate:               r.Rate,
+		ROI:                r.ROI,
+		Tenor:              r.Tenor,
+		RepaymentFrequency: r.RepaymentFrequency,
+		InterestMethod:     r.InterestMethod,
+		Product:            r.Product,
+		State:              model.StateProposed,
 	}
 	// Initialize the state machine
 	loanStateMachine := model.NewStateMachine(model.StateInitial)
 	// Transition to "proposed"
-	err := loanStateMachine.Transition(loan, model.EventSubmission)
+	err = loanStateMachine.Transition(loan, model.EventSubmission)
 	if err != nil {
 		return nil, err
 	}
@@ -45,19 +244,17 @@ func (s *LoanService) CreateLoan(ctx context.Context, r model.CreateLoanRequest)
 			return err
 		}
 
-		transition := &model.Transition{
-			LoanID:        loanID,
-			PreviousState: model.StateInitial,
-			Event:         model.EventSubmission,
-			NextState:     model.StateProposed,
+		transition, err := newTransition(ctx, loanID, model.StateInitial, model.EventSubmission, model.StateProposed, r)
+		if err != nil {
+			return err
 		}
 
-		err = rTx.CreateTransition(ctx, transition)
+		err = recordTransition(ctx, rTx, transition)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return publish(ctx, rTx, model.EventTypeLoanSubmitted, transition)
 	})
 	if err != nil {
 		return nil, err
@@ -69,167 +266,570 @@ func (s *LoanService) CreateLoan(ctx context.Context, r model.CreateLoanRequest)
 }
 
 func (s *LoanService) ApproveLoan(ctx context.Context, r model.ApproveLoanRequest) error {
-	loan, err := s.repo.GetLoan(ctx, r.LoanID)
+	var err error
+	r.ValidatorID, err = actingUser(ctx, r.ValidatorID, "validator_id")
 	if err != nil {
 		return err
 	}
-	loan.Approval = r.ToApproval()
 
-	previousState := loan.State
-	// Initialize current the state machine
-	loanStateMachine := model.NewStateMachine(previousState)
-	// Transition to "approve"
-	err = loanStateMachine.Transition(loan, model.EventApprove)
-	if err != nil {
-		return err
-	}
+	return s.retryOnConflict(ctx, "approve", func() error {
+		return s.approveLoan(ctx, r)
+	})
+}
 
-	err = s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
-		err := rTx.Update(ctx, loan)
+func (s *LoanService) approveLoan(ctx context.Context, r model.ApproveLoanRequest) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
 		if err != nil {
 			return err
 		}
+		loan.Approval = r.ToApproval()
 
-		transition := &model.Transition{
-			LoanID:        loan.ID,
-			PreviousState: previousState,
-			Event:         model.EventApprove,
-			NextState:     loanStateMachine.GetCurrentState(),
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "approve"
+		err = loanStateMachine.Transition(loan, model.EventApprove)
+		if err != nil {
+			return err
 		}
 
-		err = rTx.CreateTransition(ctx, transition)
+		err = rTx.Update(ctx, loan)
 		if err != nil {
 			return err
 		}
 
-		return nil
-	})
-	if err != nil {
-		return err
-	}
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventApprove, loanStateMachine.GetCurrentState(), loan.Approval)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		err = recordTransition(ctx, rTx, transition)
+		if err != nil {
+			return err
+		}
+
+		return publish(ctx, rTx, model.EventTypeLoanApproved, transition)
+	})
 }
 
 func (s *LoanService) AddInvestment(ctx context.Context, r model.AddInvestmentRequest) (bool, error) {
-	loan, err := s.repo.GetLoan(ctx, r.LoanID)
+	var err error
+	r.InvestorID, err = actingUser(ctx, r.InvestorID, "investor_id")
 	if err != nil {
 		return false, err
 	}
-	loan.NewInvestment = r.ToInvestment()
 
-	previousState := loan.State
-	// Initialize current the state machine
-	loanStateMachine := model.NewStateMachine(previousState)
-	// Transition to "add_investment"
-	err = loanStateMachine.Transition(loan, model.EventAddInvestment)
+	var loan *model.Loan
+	err = s.retryOnConflict(ctx, "add_investment", func() error {
+		var err error
+		loan, err = s.addInvestment(ctx, r)
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
 
-	err = s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+	// The agreement email goes out through the outbox once the loan is invested
+	return loan.State == model.StateInvested, nil
+}
+
+func (s *LoanService) addInvestment(ctx context.Context, r model.AddInvestmentRequest) (*model.Loan, error) {
+	var loan *model.Loan
+	err := s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		var err error
+		loan, err = s.getLoanForUpdate(ctx, rTx, r.LoanID)
+		if err != nil {
+			return err
+		}
+		loan.NewInvestment = r.ToInvestment()
+
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "add_investment"
+		err = loanStateMachine.Transition(loan, model.EventAddInvestment)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.CreateInvestment(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventAddInvestment, loanStateMachine.GetCurrentState(), loan.NewInvestment)
+		if err != nil {
+			return err
+		}
+
+		err = recordTransition(ctx, rTx, transition)
+		if err != nil {
+			return err
+		}
+
+		err = publish(ctx, rTx, model.EventTypeInvestmentAdded, transition)
+		if err != nil {
+			return err
+		}
+
 		if loan.State == model.StateInvested {
-			agreementURL, err := s.GenerateAndUploadLoanAgreement(loan)
+			err = publish(ctx, rTx, model.EventTypeLoanInvested, transition)
 			if err != nil {
-				log.Printf("Failed to generate agreement for loan %s: %v", loan.ID, err)
 				return err
 			}
-			// set link agreement url
-			loan.SetAgreementURL(agreementURL)
+			// The agreements are generated after the commit
+			return s.requestAgreements(ctx, rTx, loan, "invested")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return loan, nil
+}
+
+func (s *LoanService) WithdrawInvestment(ctx context.Context, r model.WithdrawInvestmentRequest) error {
+	var err error
+	r.InvestorID, err = actingUser(ctx, r.InvestorID, "investor_id")
+	if err != nil {
+		return err
+	}
+
+	return s.retryOnConflict(ctx, "withdraw_investment", func() error {
+		return s.withdrawInvestment(ctx, r)
+	})
+}
+
+func (s *LoanService) withdrawInvestment(ctx context.Context, r model.WithdrawInvestmentRequest) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
+		if err != nil {
+			return err
 		}
-		err := rTx.Update(ctx, loan)
+		investment, err := rTx.GetInvestment(ctx, loan.ID, r.InvestmentID)
 		if err != nil {
 			return err
 		}
+		if r.InvestorID != "" && investment.InvestorID != r.InvestorID {
+			return fmt.Errorf("%w: investment of another investor", model.ErrForbidden)
+		}
+		loan.WithdrawInvestment = *investment
 
-		err = rTx.CreateInvestment(ctx, loan)
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "withdraw_investment"
+		err = loanStateMachine.Transition(loan, model.EventWithdrawInvestment)
 		if err != nil {
 			return err
 		}
 
-		transition := &model.Transition{
-			LoanID:        loan.ID,
-			PreviousState: previousState,
-			Event:         model.EventAddInvestment,
-			NextState:     loanStateMachine.GetCurrentState(),
+		// Decrements total_investment_amount, guarded by the version check
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
 		}
 
-		err = rTx.CreateTransition(ctx, transition)
+		err = rTx.UpdateInvestmentStatus(ctx, investment.ID, model.InvestmentWithdrawn)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventWithdrawInvestment, loanStateMachine.GetCurrentState(), loan.WithdrawInvestment)
+		if err != nil {
+			return err
+		}
+
+		return recordTransition(ctx, rTx, transition)
 	})
+}
+
+func (s *LoanService) DisburseLoan(ctx context.Context, r model.DisburseLoanRequest) error {
+	var err error
+	r.OfficerID, err = actingUser(ctx, r.OfficerID, "officer_id")
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	// send email if state invested
-	if loanStateMachine.GetCurrentState() == model.StateInvested {
-		// Async email sending
-		go func(loan *model.Loan) {
-			asyncCtx := context.Background()
-			// Get list investor
-			listInvestments, err := s.repo.GetInvestments(asyncCtx, loan.ID)
-			if err != nil {
-				log.Printf("Failed to get investments for loan %s: %v", loan.ID, err)
-			}
-			loan.Investments = listInvestments
+	return s.retryOnConflict(ctx, "disburse", func() error {
+		return s.disburseLoan(ctx, r)
+	})
+}
 
-			// Send broadcast email
-			err = s.email.SendInvestmentAgreement(asyncCtx, loan.AgreementLetterURL.String, loan)
-			if err != nil {
-				log.Printf("Failed to send email for loan %s: %v", loan.ID, err)
-			}
-		}(loan)
-		log.Printf("Send email for loan %s is IN PROGRESS", loan.ID)
+func (s *LoanService) disburseLoan(ctx context.Context, r model.DisburseLoanRequest) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
+		if err != nil {
+			return err
+		}
+		loan.Disbursement = r.ToDisbursement()
+
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "disburse_funds"
+		err = loanStateMachine.Transition(loan, model.EventDisburseFunds)
+		if err != nil {
+			return err
+		}
+
+		installments, err := model.GenerateSchedule(loan, loan.Disbursement.DisbursementDate.Time)
+		if err != nil {
+			return fmt.Errorf("failed to generate repayment schedule: %w", err)
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.CreateInstallments(ctx, installments)
+		if err != nil {
+			return err
+		}
+
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventDisburseFunds, loanStateMachine.GetCurrentState(), loan.Disbursement)
+		if err != nil {
+			return err
+		}
 
-		return true, nil
+		err = recordTransition(ctx, rTx, transition)
+		if err != nil {
+			return err
+		}
+
+		return publish(ctx, rTx, model.EventTypeLoanDisbursed, transition)
+	})
+}
+
+// newTransition builds the audit record of a transition, tagging it with the
+// acting user and request ID from ctx and a JSON snapshot of the event payload.
+func newTransition(ctx context.Context, loanID string, previous model.LoanState, event model.LoanEvent, next model.LoanState, payload interface{}) (*model.Transition, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s transition payload: %w", event, err)
 	}
 
-	return false, nil
+	return &model.Transition{
+		LoanID:        loanID,
+		PreviousState: previous,
+		Event:         event,
+		NextState:     next,
+		ActorID:       model.ActorFromContext(ctx),
+		RequestID:     model.RequestIDFromContext(ctx),
+		Payload:       data,
+	}, nil
 }
 
-func (s *LoanService) DisburseLoan(ctx context.Context, r model.DisburseLoanRequest) error {
-	loan, err := s.repo.GetLoan(ctx, r.LoanID)
+// recordTransition stores the audit record of the transition and publishes it
+// as a loan.transitioned event, so webhook subscribers see every transition.
+func recordTransition(ctx context.Context, rTx repo.LoanRepositoryInterface, transition *model.Transition) error {
+	err := rTx.CreateTransition(ctx, transition)
 	if err != nil {
 		return err
 	}
-	loan.Disbursement = r.ToDisbursement()
 
-	previousState := loan.State
-	// Initialize current the state machine
-	loanStateMachine := model.NewStateMachine(previousState)
-	// Transition to "disburse_funds"
-	err = loanStateMachine.Transition(loan, model.EventDisburseFunds)
+	return publish(ctx, rTx, model.EventTypeLoanTransitioned, transition)
+}
+
+// publish stores an outbox event carrying the transition. Call it on the
+// transaction of the transition so the event is committed together with it.
+func publish(ctx context.Context, rTx repo.LoanRepositoryInterface, eventType model.OutboxEventType, transition *model.Transition) error {
+	return publishEvent(ctx, rTx, eventType, transition.LoanID, transition)
+}
+
+// publishEvent stores an outbox event of the loan carrying payload.
+func publishEvent(ctx context.Context, rTx repo.LoanRepositoryInterface, eventType model.OutboxEventType, loanID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	return rTx.CreateOutboxEvent(ctx, &model.OutboxEvent{
+		EventType: eventType,
+		LoanID:    loanID,
+		Payload:   data,
+	})
+}
+
+func (s *LoanService) RejectLoan(ctx context.Context, r model.RejectLoanRequest) error {
+	var err error
+	r.ValidatorID, err = actingUser(ctx, r.ValidatorID, "validator_id")
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
-		err := rTx.Update(ctx, loan)
+	return s.retryOnConflict(ctx, "reject", func() error {
+		return s.rejectLoan(ctx, r)
+	})
+}
+
+func (s *LoanService) rejectLoan(ctx context.Context, r model.RejectLoanRequest) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
 		if err != nil {
 			return err
 		}
+		loan.Rejection = r.ToRejection()
 
-		transition := &model.Transition{
-			LoanID:        loan.ID,
-			PreviousState: previousState,
-			Event:         model.EventDisburseFunds,
-			NextState:     loanStateMachine.GetCurrentState(),
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "rejected"
+		err = loanStateMachine.Transition(loan, model.EventReject)
+		if err != nil {
+			return err
 		}
 
-		err = rTx.CreateTransition(ctx, transition)
+		err = rTx.Update(ctx, loan)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventReject, loanStateMachine.GetCurrentState(), loan.Rejection)
+		if err != nil {
+			return err
+		}
+
+		return recordTransition(ctx, rTx, transition)
 	})
-	if err != nil {
+}
+
+func (s *LoanService) CancelLoan(ctx context.Context, r model.CancelLoanRequest) error {
+	return s.retryOnConflict(ctx, "cancel", func() error {
+		return s.cancelLoan(ctx, r)
+	})
+}
+
+func (s *LoanService) cancelLoan(ctx context.Context, r model.CancelLoanRequest) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
+		if err != nil {
+			return err
+		}
+		err = checkOwner(ctx, loan.BorrowerID, "loan")
+		if err != nil {
+			return err
+		}
+		loan.Cancellation = r.ToCancellation()
+
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "cancelled"
+		err = loanStateMachine.Transition(loan, model.EventCancel)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		// Give the money back to investors of a partially funded loan
+		refunded, err := rTx.SetInvestmentsStatus(ctx, loan.ID, model.InvestmentRefunded)
+		if err != nil {
+			return err
+		}
+
+		payload := struct {
+			Cancellation        model.Cancellation `json:"cancellation"`
+			RefundedInvestments int64              `json:"refunded_investments"`
+		}{loan.Cancellation, refunded}
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventCancel, loanStateMachine.GetCurrentState(), payload)
+		if err != nil {
+			return err
+		}
+
+		return recordTransition(ctx, rTx, transition)
+	})
+}
+
+func (s *LoanService) RecordRepayment(ctx context.Context, r model.RecordRepaymentRequest) (*model.Repayment, error) {
+	var repayment *model.Repayment
+	err := s.retryOnConflict(ctx, "record_repayment", func() error {
+		var err error
+		repayment, err = s.recordRepayment(ctx, r)
 		return err
+	})
+	return repayment, err
+}
+
+func (s *LoanService) recordRepayment(ctx context.Context, r model.RecordRepaymentRequest) (*model.Repayment, error) {
+	var repayment *model.Repayment
+	err := s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, r.LoanID)
+		if err != nil {
+			return err
+		}
+		loan.Installments, err = rTx.GetInstallments(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		loan.Investments, err = rTx.GetInvestments(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		loan.NewRepayment = r.ToRepayment()
+		charged := model.ChargeLateFees(loan.Installments, r.PaidAt, s.lateFee)
+
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "repaying", "paid_off" or back to "defaulted"
+		err = loanStateMachine.Transition(loan, model.EventRecordRepayment)
+		if err != nil {
+			return err
+		}
+
+		repayment = &loan.NewRepayment
+		principalRepaidBefore := model.PrincipalRepaid(loan.Installments)
+		repayment.Allocations, err = model.AllocateRepayment(loan.Installments, repayment.Amount)
+		if err != nil {
+			return err
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		repayment.ID, err = rTx.CreateRepayment(ctx, repayment)
+		if err != nil {
+			return err
+		}
+
+		// Distribute the repaid principal and the matching ROI to the investors
+		payouts := model.CalculatePayouts(loan, repayment, principalRepaidBefore)
+		err = rTx.CreatePayouts(ctx, payouts)
+		if err != nil {
+			return err
+		}
+
+		for i := range loan.Installments {
+			in := &loan.Installments[i]
+			if !allocated(repayment.Allocations, in.ID) && !slices.Contains(charged, in.ID) {
+				continue
+			}
+			err = rTx.UpdateInstallment(ctx, in)
+			if err != nil {
+				return err
+			}
+		}
+
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventRecordRepayment, loanStateMachine.GetCurrentState(), repayment)
+		if err != nil {
+			return err
+		}
+
+		return recordTransition(ctx, rTx, transition)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return repayment, nil
+}
+
+// MarkDefault marks the loan defaulted when an installment is overdue at now.
+func (s *LoanService) MarkDefault(ctx context.Context, loanID string, now time.Time) error {
+	return s.retryOnConflict(ctx, "mark_default", func() error {
+		return s.markDefault(ctx, loanID, now)
+	})
+}
+
+func (s *LoanService) markDefault(ctx context.Context, loanID string, now time.Time) error {
+	return s.repo.WithTransaction(ctx, func(rTx repo.LoanRepositoryInterface) error {
+		loan, err := s.getLoanForUpdate(ctx, rTx, loanID)
+		if err != nil {
+			return err
+		}
+		loan.Installments, err = rTx.GetInstallments(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		loan.DefaultCheckedAt = now
+
+		previousState := loan.State
+		// Initialize current the state machine
+		loanStateMachine := model.NewStateMachine(previousState)
+		// Transition to "defaulted"
+		err = loanStateMachine.Transition(loan, model.EventMarkDefault)
+		if err != nil {
+			return err
+		}
+
+		var overdue []model.Installment
+		for _, in := range loan.Installments {
+			if in.IsOverdue(now) {
+				overdue = append(overdue, in)
+			}
+		}
+
+		err = rTx.Update(ctx, loan)
+		if err != nil {
+			return err
+		}
+
+		transition, err := newTransition(ctx, loan.ID, previousState, model.EventMarkDefault, loanStateMachine.GetCurrentState(), overdue)
+		if err != nil {
+			return err
+		}
+
+		return recordTransition(ctx, rTx, transition)
+	})
+}
+
+// allocated reports whether any allocation touches the installment.
+func allocated(allocations []model.RepaymentAllocation, installmentID string) bool {
+	for _, a := range allocations {
+		if a.InstallmentID == installmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// actingUser returns the user ID a request names for whoever performs it, or
+// the authenticated user when it names nobody. Naming someone else is
+// forbidden. Without an authenticated user, e.g. in background jobs, the ID
+// is taken as given.
+func actingUser(ctx context.Context, id, field string) (string, error) {
+	actorID := model.ActorFromContext(ctx)
+	switch {
+	case actorID == "" || id == actorID:
+		return id, nil
+	case id == "":
+		return actorID, nil
+	default:
+		return "", fmt.Errorf("%w: %s must be the authenticated user", model.ErrForbidden, field)
+	}
+}
+
+// ownerFor is actingUser for requests staff may also make on behalf of
+// someone else, such as proposing a loan for a borrower.
+func ownerFor(ctx context.Context, id, field string) (string, error) {
+	if user := model.UserFromContext(ctx); user != nil && user.HasRole(model.RoleStaff) {
+		return id, nil
+	}
+	return actingUser(ctx, id, field)
+}
+
+// checkOwner lets staff act on anyone's loans and investments and other users
+// only on their own. Without an authenticated user, e.g. in background jobs,
+// anything goes.
+func checkOwner(ctx context.Context, ownerID, what string) error {
+	user := model.UserFromContext(ctx)
+	if user == nil || user.HasRole(model.RoleStaff) || user.ID == ownerID {
+		return nil
+	}
+	return fmt.Errorf("%w: %s of another user", model.ErrForbidden, what)
 }
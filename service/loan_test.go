@@ -2,9 +2,18 @@ package service_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"loan-engine/model"
+	"loan-engine/repository"
 	"loan-engine/service"
-	"os"
+	"loan-engine/storage"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,21 +24,197 @@ import (
 // Helper function to create test loan
 func createTestLoan() *model.Loan {
 	return &model.Loan{
-		ID:              "loan-123",
-		BorrowerID:      "borrower-123",
-		PrincipalAmount: 1000.0,
-		Rate:            5.0,
-		ROI:             10.0,
-		State:           model.StateInitial,
-		Version:         1,
+		ID:                 "loan-123",
+		BorrowerID:         "borrower-123",
+		PrincipalAmount:    model.NewMoney(1000),
+		Currency:           model.DefaultCurrency,
+		Rate:               5.0,
+		ROI:                model.NewMoney(10),
+		Tenor:              12,
+		RepaymentFrequency: model.FrequencyMonthly,
+		InterestMethod:     model.InterestFlat,
+		State:              model.StateInitial,
+		Version:            1,
+	}
+}
+
+// inTransaction makes the mocked WithTransaction run its callback against mockRepo.
+func inTransaction(mockRepo *service.MockLoanRepository) func(func(repository.LoanRepositoryInterface) error) error {
+	return func(fn func(repository.LoanRepositoryInterface) error) error {
+		return fn(mockRepo)
+	}
+}
+
+func TestGetLoan(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name        string
+		setupMocks  func(mockRepo *service.MockLoanRepository)
+		expectError error
+	}{
+		{
+			name: "Successful loan retrieval",
+			setupMocks: func(mockRepo *service.MockLoanRepository) {
+				loan := createTestLoan()
+				loan.State = model.StateApproved
+				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+				mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+					{ID: "investment-1", InvestorID: "investor-123", Amount: model.NewMoney(500)},
+				}, nil)
+			},
+		},
+		{
+			name: "Failed retrieval - Loan not found",
+			setupMocks: func(mockRepo *service.MockLoanRepository) {
+				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(nil, repository.ErrLoanNotFound)
+			},
+			expectError: repository.ErrLoanNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			tc.setupMocks(mockRepo)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan, err := service.GetLoan(ctx, "loan-123")
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				assert.Nil(t, loan)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, loan.Investments, 1)
+			}
+		})
+	}
+}
+
+func TestGetLoanHidesOtherInvestors(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", InvestorID: "investor-123", Name: "Ana", Email: "ana@example.com", Amount: model.NewMoney(500)},
+		{ID: "investment-2", InvestorID: "investor-456", Name: "Budi", Email: "budi@example.com", Amount: model.NewMoney(300)},
+	}, nil)
+
+	ctx := model.ContextWithUser(context.Background(), &model.User{ID: "investor-123", Roles: []model.Role{model.RoleInvestor}})
+	loan, err := service.GetLoan(ctx, "loan-123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ana@example.com", loan.Investments[0].Email)
+	assert.Equal(t, model.Investment{ID: "investment-2", Amount: model.NewMoney(300)}, loan.Investments[1])
+}
+
+func TestGetTransitions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Successful transitions retrieval", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+		mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+		mockRepo.On("GetTransitions", mock.Anything, "loan-123").Return([]model.Transition{
+			{LoanID: "loan-123", PreviousState: model.StateInitial, Event: model.EventSubmission, NextState: model.StateProposed, ActorID: "user"},
+			{LoanID: "loan-123", PreviousState: model.StateProposed, Event: model.EventApprove, NextState: model.StateApproved, ActorID: "user"},
+		}, nil)
+
+		transitions, err := service.GetTransitions(ctx, "loan-123")
+
+		assert.NoError(t, err)
+		assert.Len(t, transitions, 2)
+		assert.Equal(t, model.EventApprove, transitions[1].Event)
+	})
+
+	t.Run("Failed transitions retrieval - Loan not found", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+		mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(nil, repository.ErrLoanNotFound)
+
+		transitions, err := service.GetTransitions(ctx, "loan-123")
+
+		assert.ErrorIs(t, err, repository.ErrLoanNotFound)
+		assert.Nil(t, transitions)
+		mockRepo.AssertNotCalled(t, "GetTransitions", mock.Anything, mock.Anything)
+	})
+}
+
+func TestListLoans(t *testing.T) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 12, 5, 15, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		filter         model.LoanFilter
+		rows           int
+		expectLimit    int
+		expectLoans    int
+		expectNextPage bool
+	}{
+		{
+			name:           "Default page size with next page",
+			filter:         model.LoanFilter{State: model.StateApproved},
+			rows:           model.DefaultPageSize + 1,
+			expectLimit:    model.DefaultPageSize + 1,
+			expectLoans:    model.DefaultPageSize,
+			expectNextPage: true,
+		},
+		{
+			name:        "Last page",
+			filter:      model.LoanFilter{Limit: 5},
+			rows:        3,
+			expectLimit: 6,
+			expectLoans: 3,
+		},
+		{
+			name:        "Limit capped at max page size",
+			filter:      model.LoanFilter{Limit: 1000},
+			rows:        0,
+			expectLimit: model.MaxPageSize + 1,
+			expectLoans: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loans := make([]model.Loan, tc.rows)
+			for i := range loans {
+				loans[i] = model.Loan{ID: fmt.Sprintf("loan-%d", i), CreatedAt: createdAt.Add(-time.Duration(i) * time.Minute)}
+			}
+			mockRepo.On("List", mock.Anything, mock.MatchedBy(func(f model.LoanFilter) bool {
+				return f.Limit == tc.expectLimit && f.Sort == model.SortDesc
+			})).Return(loans, nil)
+
+			page, err := service.ListLoans(ctx, tc.filter)
+
+			assert.NoError(t, err)
+			assert.Len(t, page.Loans, tc.expectLoans)
+			if !tc.expectNextPage {
+				assert.Empty(t, page.NextCursor)
+				return
+			}
+
+			cursor, err := model.DecodeLoanCursor(page.NextCursor)
+			assert.NoError(t, err)
+			last := page.Loans[len(page.Loans)-1]
+			assert.Equal(t, last.ID, cursor.ID)
+			assert.True(t, last.CreatedAt.Equal(cursor.CreatedAt))
+		})
 	}
 }
 
 func TestCreateLoan(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(service.MockLoanRepository)
-	mockEmail := new(service.MockEmailService)
-	service := service.NewLoanService(mockRepo, mockEmail)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
 
 	testCases := []struct {
 		name        string
@@ -41,9 +226,10 @@ func TestCreateLoan(t *testing.T) {
 			name: "Successful loan creation",
 			request: model.CreateLoanRequest{
 				BorrowerID:      "borrower-123",
-				PrincipalAmount: 1000.0,
+				PrincipalAmount: model.NewMoney(1000),
 				Rate:            5.0,
-				ROI:             10.0,
+				ROI:             model.NewMoney(10),
+				Tenor:           12,
 			},
 			setupMocks: func() {
 				mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(nil)
@@ -71,62 +257,155 @@ func TestCreateLoan(t *testing.T) {
 	}
 }
 
+func TestCreateLoanActingUser(t *testing.T) {
+	borrower := &model.User{ID: "borrower-123", Roles: []model.Role{model.RoleBorrower}}
+	staff := &model.User{ID: "staff-1", Roles: []model.Role{model.RoleStaff}}
+
+	testCases := []struct {
+		name           string
+		user           *model.User
+		borrowerID     string
+		expectError    error
+		expectBorrower string
+	}{
+		{name: "Borrower derived from the authenticated user", user: borrower, expectBorrower: "borrower-123"},
+		{name: "Borrower is the authenticated user", user: borrower, borrowerID: "borrower-123", expectBorrower: "borrower-123"},
+		{name: "Borrower is someone else", user: borrower, borrowerID: "borrower-456", expectError: model.ErrForbidden},
+		{name: "Staff proposes a loan for a borrower", user: staff, borrowerID: "borrower-456", expectBorrower: "borrower-456"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.Loan")).Return("loan-123", nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			loan, err := service.CreateLoan(model.ContextWithUser(context.Background(), tc.user), model.CreateLoanRequest{
+				BorrowerID:      tc.borrowerID,
+				PrincipalAmount: model.NewMoney(1000),
+				Rate:            5.0,
+				ROI:             model.NewMoney(10),
+				Tenor:           12,
+			})
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectBorrower, loan.BorrowerID)
+			}
+		})
+	}
+}
+
 func TestApproveLoan(t *testing.T) {
 	ctx := context.Background()
-	mockRepo := new(service.MockLoanRepository)
-	mockEmail := new(service.MockEmailService)
-	service := service.NewLoanService(mockRepo, mockEmail)
+	request := model.ApproveLoanRequest{
+		LoanID:        "loan-123",
+		ValidatorID:   "validator-123",
+		ProofImageURL: "http://example.com/proof.jpg",
+		ApprovalDate:  time.Now(),
+	}
 
 	testCases := []struct {
 		name        string
-		request     model.ApproveLoanRequest
-		setupMocks  func()
-		expectError bool
+		state       model.LoanState
+		locking     service.LockingStrategy
+		expectError error
 	}{
 		{
-			name: "Successful loan approval",
-			request: model.ApproveLoanRequest{
-				LoanID:        "loan-123",
-				ValidatorID:   "validator-123",
-				ProofImageURL: "http://example.com/proof.jpg",
-				ApprovalDate:  time.Now(),
-			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateProposed
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-				mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(nil)
-				mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
-			},
-			expectError: false,
+			name:    "Successful loan approval",
+			state:   model.StateProposed,
+			locking: service.LockingOptimistic,
 		},
 		{
-			name: "Failed approval - Invalid state",
-			request: model.ApproveLoanRequest{
-				LoanID:        "loan-123",
-				ValidatorID:   "validator-123",
-				ProofImageURL: "http://example.com/proof.jpg",
-				ApprovalDate:  time.Now(),
-			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateInitial // Wrong state
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-			},
-			expectError: true,
+			name:    "Successful loan approval with row lock",
+			state:   model.StateProposed,
+			locking: service.LockingPessimistic,
+		},
+		{
+			name:        "Failed approval - Invalid state",
+			state:       model.StateInitial, // Wrong state
+			locking:     service.LockingOptimistic,
+			expectError: model.ErrInvalidTransition,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.setupMocks()
-			err := service.ApproveLoan(ctx, tc.request)
+			getLoan := "GetLoan"
+			if tc.locking == service.LockingPessimistic {
+				getLoan = "GetLoanForUpdate"
+			}
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithLockingStrategy(tc.locking)
 
-			if tc.expectError {
-				assert.Error(t, err)
+			loan := createTestLoan()
+			loan.State = tc.state
+			mockRepo.On(getLoan, mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			err := service.ApproveLoan(ctx, request)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.StateApproved, loan.State)
+				mockRepo.AssertCalled(t, getLoan, mock.Anything, "loan-123")
+			}
+		})
+	}
+}
+
+func TestApproveLoanActingUser(t *testing.T) {
+	ctx := model.ContextWithUser(context.Background(), &model.User{ID: "validator-123", Roles: []model.Role{model.RoleFieldValidator}})
+
+	testCases := []struct {
+		name        string
+		validatorID string
+		expectError error
+	}{
+		{name: "Validator derived from the authenticated user"},
+		{name: "Validator is the authenticated user", validatorID: "validator-123"},
+		{name: "Validator is someone else", validatorID: "validator-456", expectError: model.ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = model.StateProposed
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			err := service.ApproveLoan(ctx, model.ApproveLoanRequest{
+				LoanID:        "loan-123",
+				ValidatorID:   tc.validatorID,
+				ProofImageURL: "http://example.com/proof.jpg",
+				ApprovalDate:  time.Now(),
+			})
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "GetLoan", mock.Anything, mock.Anything)
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, "validator-123", loan.Approval.FieldValidatorID.String)
 			}
 		})
 	}
@@ -134,15 +413,12 @@ func TestApproveLoan(t *testing.T) {
 
 func TestAddInvestment(t *testing.T) {
 	ctx := context.Background()
-	mockRepo := new(service.MockLoanRepository)
-	mockEmail := new(service.MockEmailService)
-	service := service.NewLoanService(mockRepo, mockEmail)
 
 	testCases := []struct {
 		name           string
 		request        model.AddInvestmentRequest
-		setupMocks     func()
-		expectError    bool
+		state          model.LoanState
+		expectError    error
 		expectInvested bool
 	}{
 		{
@@ -150,20 +426,11 @@ func TestAddInvestment(t *testing.T) {
 			request: model.AddInvestmentRequest{
 				LoanID:     "loan-123",
 				InvestorID: "investor-123",
-				Amount:     500.0,
+				Amount:     model.NewMoney(500),
 				Name:       "John Doe",
 				Email:      "john@example.com",
 			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateApproved
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-				mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(nil)
-				mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
-			},
-			expectError:    false,
+			state:          model.StateApproved,
 			expectInvested: false,
 		},
 		{
@@ -171,95 +438,594 @@ func TestAddInvestment(t *testing.T) {
 			request: model.AddInvestmentRequest{
 				LoanID:     "loan-123",
 				InvestorID: "investor-123",
-				Amount:     1000.0,
+				Amount:     model.NewMoney(1000),
 				Name:       "John Doe",
 				Email:      "john@example.com",
 			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateApproved
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-				mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(nil)
-				mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
-				mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{}, nil)
-				mockEmail.On("SendInvestmentAgreement", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-			},
-			expectError:    false,
+			state:          model.StateApproved,
 			expectInvested: true,
 		},
+		{
+			name: "Failed investment - Loan not approved",
+			request: model.AddInvestmentRequest{
+				LoanID:     "loan-123",
+				InvestorID: "investor-123",
+				Amount:     model.NewMoney(500),
+				Name:       "John Doe",
+				Email:      "john@example.com",
+			},
+			state:       model.StateProposed,
+			expectError: model.ErrInvalidTransition,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.setupMocks()
+			mockRepo := new(service.MockLoanRepository)
+			mockNotifier := new(service.MockNotifier)
+			service := service.NewLoanService(mockRepo, mockNotifier)
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("UpdateDocumentStatus", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
 			invested, err := service.AddInvestment(ctx, tc.request)
 
-			if tc.expectError {
-				assert.Error(t, err)
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tc.expectInvested, invested)
 			}
+			// The agreements are generated and emailed by the outbox dispatcher
+			mockRepo.AssertNotCalled(t, "CreateDocument", mock.Anything, mock.Anything)
+			mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.Anything)
+			investedEvent := mock.MatchedBy(func(e *model.OutboxEvent) bool { return e.EventType == model.EventTypeLoanInvested })
+			requestedEvent := mock.MatchedBy(func(e *model.OutboxEvent) bool { return e.EventType == model.EventTypeAgreementsRequested })
+			if tc.expectInvested {
+				assert.Equal(t, model.DocumentsPending, loan.DocumentStatus)
+				mockRepo.AssertCalled(t, "UpdateDocumentStatus", mock.Anything, loan)
+				mockRepo.AssertCalled(t, "CreateOutboxEvent", mock.Anything, investedEvent)
+				mockRepo.AssertCalled(t, "CreateOutboxEvent", mock.Anything, requestedEvent)
+			} else {
+				assert.Empty(t, loan.DocumentStatus)
+				mockRepo.AssertNotCalled(t, "CreateOutboxEvent", mock.Anything, investedEvent)
+				mockRepo.AssertNotCalled(t, "CreateOutboxEvent", mock.Anything, requestedEvent)
+			}
+		})
+	}
+}
+
+func TestAddInvestmentActingUser(t *testing.T) {
+	ctx := model.ContextWithUser(context.Background(), &model.User{ID: "investor-123", Roles: []model.Role{model.RoleInvestor}})
+
+	testCases := []struct {
+		name        string
+		investorID  string
+		expectError error
+	}{
+		{name: "Investor derived from the authenticated user"},
+		{name: "Investor is the authenticated user", investorID: "investor-123"},
+		{name: "Investor is someone else", investorID: "investor-456", expectError: model.ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = model.StateApproved
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			_, err := service.AddInvestment(ctx, model.AddInvestmentRequest{
+				LoanID:     "loan-123",
+				InvestorID: tc.investorID,
+				Amount:     model.NewMoney(500),
+				Name:       "John Doe",
+				Email:      "john@example.com",
+			})
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "GetLoan", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "investor-123", loan.NewInvestment.InvestorID)
+			}
+		})
+	}
+}
+
+func TestAddInvestmentRetriesOnVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	request := model.AddInvestmentRequest{
+		LoanID:     "loan-123",
+		InvestorID: "investor-123",
+		Amount:     model.NewMoney(500),
+		Name:       "John Doe",
+		Email:      "john@example.com",
+	}
+
+	testCases := []struct {
+		name             string
+		concurrentAmount model.Money
+		conflicts        int
+		expectError      error
+		expectAttempts   int
+	}{
+		{
+			name:           "Succeeds after a conflict",
+			conflicts:      1,
+			expectAttempts: 2,
+		},
+		{
+			name:             "Re-runs the rule on the re-read loan",
+			concurrentAmount: model.NewMoney(800),
+			conflicts:        1,
+			expectError:      model.ErrValidationFailed,
+			expectAttempts:   2,
+		},
+		{
+			name:           "Gives up after max attempts",
+			conflicts:      3,
+			expectError:    repository.ErrConcurrentModification,
+			expectAttempts: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithRetryPolicy(service.RetryPolicy{MaxAttempts: 3})
+
+			stale := createTestLoan()
+			stale.State = model.StateApproved
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(stale, nil).Once()
+			// Every later read sees the investment that won the race
+			fresh := createTestLoan()
+			fresh.State = model.StateApproved
+			fresh.TotalInvestmentAmount = tc.concurrentAmount
+			fresh.Version = 2
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(fresh, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(repository.ErrConcurrentModification).Times(tc.conflicts)
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			invested, err := service.AddInvestment(ctx, request)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+			} else {
+				assert.NoError(t, err)
+				assert.False(t, invested)
+				assert.Equal(t, "investor-123", fresh.NewInvestment.InvestorID)
+			}
+			mockRepo.AssertNumberOfCalls(t, "GetLoan", tc.expectAttempts)
+		})
+	}
+}
+
+func TestWithdrawInvestment(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name        string
+		state       model.LoanState
+		investment  *model.Investment
+		investor    string
+		lookupErr   error
+		expectError error
+	}{
+		{
+			name:       "Successful withdrawal",
+			state:      model.StateApproved,
+			investment: &model.Investment{ID: "investment-1", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+		},
+		{
+			name:       "Successful withdrawal by the investor",
+			state:      model.StateApproved,
+			investment: &model.Investment{ID: "investment-1", InvestorID: "investor-123", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+			investor:   "investor-123",
+		},
+		{
+			name:        "Failed withdrawal - Another investor's investment",
+			state:       model.StateApproved,
+			investment:  &model.Investment{ID: "investment-1", InvestorID: "investor-123", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+			investor:    "investor-456",
+			expectError: model.ErrForbidden,
+		},
+		{
+			name:        "Failed withdrawal - Loan fully invested",
+			state:       model.StateInvested,
+			investment:  &model.Investment{ID: "investment-1", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+			expectError: errors.New("event withdraw_investment not allowed in state invested"),
+		},
+		{
+			name:        "Failed withdrawal - Already withdrawn",
+			state:       model.StateApproved,
+			investment:  &model.Investment{ID: "investment-1", Amount: model.NewMoney(400), Status: model.InvestmentWithdrawn},
+			expectError: errors.New("state decision failed: investment is already withdrawn"),
+		},
+		{
+			name:        "Failed withdrawal - Investment not found",
+			state:       model.StateApproved,
+			lookupErr:   repository.ErrInvestmentNotFound,
+			expectError: repository.ErrInvestmentNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			loan.TotalInvestmentAmount = model.NewMoney(400)
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("GetInvestment", mock.Anything, "loan-123", "investment-1").Return(tc.investment, tc.lookupErr)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(l *model.Loan) bool {
+				return l.InvestmentDelta() == model.NewMoney(-400)
+			})).Return(nil)
+			mockRepo.On("UpdateInvestmentStatus", mock.Anything, "investment-1", model.InvestmentWithdrawn).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			ctx := ctx
+			if tc.investor != "" {
+				ctx = model.ContextWithUser(ctx, &model.User{ID: tc.investor, Roles: []model.Role{model.RoleInvestor}})
+			}
+			err := service.WithdrawInvestment(ctx, model.WithdrawInvestmentRequest{LoanID: "loan-123", InvestmentID: "investment-1"})
+
+			if tc.expectError != nil {
+				assert.Error(t, err)
+				assert.True(t, errors.Is(err, tc.expectError) || err.Error() == tc.expectError.Error(), err.Error())
+				mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				mockRepo.AssertCalled(t, "UpdateInvestmentStatus", mock.Anything, "investment-1", model.InvestmentWithdrawn)
+			}
 		})
 	}
 }
 
 func TestDisburseLoan(t *testing.T) {
 	ctx := context.Background()
+	request := model.DisburseLoanRequest{
+		LoanID:             "loan-123",
+		OfficerID:          "validator-123",
+		AgreementLetterURL: "http://example.com/proof.jpg",
+		DisbursementDate:   time.Now(),
+	}
+
+	testCases := []struct {
+		name           string
+		state          model.LoanState
+		interestMethod model.InterestMethod
+		expectError    error
+	}{
+		{
+			name:  "Successful loan disbursement",
+			state: model.StateInvested,
+		},
+		{
+			name:        "Failed disbursement - Invalid state",
+			state:       model.StateInitial, // Wrong state
+			expectError: model.ErrInvalidTransition,
+		},
+		{
+			name:           "Failed disbursement - No schedule for the loan terms",
+			state:          model.StateInvested,
+			interestMethod: "balloon",
+			expectError:    model.ErrValidationFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithLockingStrategy(service.LockingPessimistic)
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			if tc.interestMethod != "" {
+				loan.InterestMethod = tc.interestMethod
+			}
+			mockRepo.On("GetLoanForUpdate", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateInstallments", mock.Anything, mock.Anything).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			err := service.DisburseLoan(ctx, request)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "CreateInstallments", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.StateDisbursed, loan.State)
+				mockRepo.AssertCalled(t, "CreateInstallments", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDisburseLoanByAnotherOfficer(t *testing.T) {
+	ctx := model.ContextWithUser(context.Background(), &model.User{ID: "officer-123", Roles: []model.Role{model.RoleFieldOfficer}})
 	mockRepo := new(service.MockLoanRepository)
-	mockEmail := new(service.MockEmailService)
-	service := service.NewLoanService(mockRepo, mockEmail)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+	err := service.DisburseLoan(ctx, model.DisburseLoanRequest{
+		LoanID:             "loan-123",
+		OfficerID:          "officer-456",
+		AgreementLetterURL: "http://example.com/agreement.pdf",
+		DisbursementDate:   time.Now(),
+	})
+
+	assert.ErrorIs(t, err, model.ErrForbidden)
+	assert.ErrorContains(t, err, "officer_id")
+	mockRepo.AssertNotCalled(t, "WithTransaction", mock.Anything, mock.Anything)
+}
+
+func TestRejectLoan(t *testing.T) {
+	ctx := context.Background()
 
 	testCases := []struct {
 		name        string
-		request     model.DisburseLoanRequest
-		setupMocks  func()
-		expectError bool
+		request     model.RejectLoanRequest
+		state       model.LoanState
+		txErr       error
+		expectError error
 	}{
 		{
-			name: "Successful loan disbursement",
-			request: model.DisburseLoanRequest{
-				LoanID:             "loan-123",
-				OfficerID:          "validator-123",
-				AgreementLetterURL: "http://example.com/proof.jpg",
-				DisbursementDate:   time.Now(),
-			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateInvested
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-				mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(nil)
-				mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
-				mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
-			},
-			expectError: false,
+			name:    "Successful loan rejection",
+			request: model.RejectLoanRequest{LoanID: "loan-123", ValidatorID: "validator-123", Reason: "invalid documents"},
+			state:   model.StateProposed,
 		},
 		{
-			name: "Failed disbursement - Invalid state",
-			request: model.DisburseLoanRequest{
-				LoanID:             "loan-123",
-				OfficerID:          "validator-123",
-				AgreementLetterURL: "http://example.com/proof.jpg",
-				DisbursementDate:   time.Now(),
-			},
-			setupMocks: func() {
-				loan := createTestLoan()
-				loan.State = model.StateInitial // Wrong state
-				mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
-			},
-			expectError: true,
+			name:        "Failed rejection - Missing validator",
+			request:     model.RejectLoanRequest{LoanID: "loan-123", Reason: "invalid documents"},
+			state:       model.StateProposed,
+			expectError: model.ErrValidationFailed,
+		},
+		{
+			name:        "Failed rejection - Already approved",
+			request:     model.RejectLoanRequest{LoanID: "loan-123", ValidatorID: "validator-123", Reason: "invalid documents"},
+			state:       model.StateApproved,
+			expectError: model.ErrInvalidTransition,
+		},
+		{
+			name:        "Failed rejection - Concurrent modification",
+			request:     model.RejectLoanRequest{LoanID: "loan-123", ValidatorID: "validator-123", Reason: "invalid documents"},
+			state:       model.StateProposed,
+			txErr:       repository.ErrConcurrentModification,
+			expectError: repository.ErrConcurrentModification,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.setupMocks()
-			err := service.DisburseLoan(ctx, tc.request)
+			mockRepo := new(service.MockLoanRepository)
+			// A single attempt so the version conflict surfaces to the caller
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithRetryPolicy(service.RetryPolicy{MaxAttempts: 1})
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(tc.txErr)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			err := service.RejectLoan(ctx, tc.request)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				if tc.txErr == nil {
+					mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.StateRejected, loan.State)
+			}
+		})
+	}
+}
+
+func TestCancelLoan(t *testing.T) {
+	ctx := context.Background()
+
+	borrower := &model.User{ID: "borrower-123", Roles: []model.Role{model.RoleBorrower}}
+	otherBorrower := &model.User{ID: "borrower-456", Roles: []model.Role{model.RoleBorrower}}
+	staff := &model.User{ID: "staff-1", Roles: []model.Role{model.RoleStaff}}
+
+	testCases := []struct {
+		name        string
+		state       model.LoanState
+		user        *model.User
+		expectError error
+	}{
+		{name: "Successful cancellation of proposed loan", state: model.StateProposed},
+		{name: "Successful cancellation of approved loan", state: model.StateApproved},
+		{name: "Successful cancellation by the borrower", state: model.StateProposed, user: borrower},
+		{name: "Successful cancellation by staff", state: model.StateProposed, user: staff},
+		{name: "Failed cancellation - Disbursed loan", state: model.StateDisbursed, expectError: model.ErrInvalidTransition},
+		{name: "Failed cancellation - Another borrower's loan", state: model.StateProposed, user: otherBorrower, expectError: model.ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("SetInvestmentsStatus", mock.Anything, "loan-123", model.InvestmentRefunded).Return(int64(0), nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			ctx := ctx
+			if tc.user != nil {
+				ctx = model.ContextWithUser(ctx, tc.user)
+			}
+			err := service.CancelLoan(ctx, model.CancelLoanRequest{LoanID: "loan-123", Reason: "borrower withdrew"})
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.StateCancelled, loan.State)
+			}
+		})
+	}
+}
+
+func TestRecordRepayment(t *testing.T) {
+	ctx := context.Background()
+
+	installments := func() []model.Installment {
+		return []model.Installment{
+			{ID: "inst-1", Number: 1, Principal: model.NewMoney(500), Interest: model.NewMoney(5), Amount: model.NewMoney(505), Status: model.InstallmentPending},
+			{ID: "inst-2", Number: 2, Principal: model.NewMoney(500), Interest: model.NewMoney(5), Amount: model.NewMoney(505), Status: model.InstallmentPending},
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		amount      model.Money
+		state       model.LoanState
+		expectError bool
+		expectAlloc int
+	}{
+		{name: "Successful partial repayment", amount: model.NewMoney(600), state: model.StateDisbursed, expectAlloc: 2},
+		{name: "Successful full repayment", amount: model.NewMoney(1010), state: model.StateRepaying, expectAlloc: 2},
+		{name: "Failed repayment - Exceeds outstanding", amount: model.NewMoney(2000), state: model.StateRepaying, expectError: true},
+		{name: "Failed repayment - Invalid state", amount: model.NewMoney(100), state: model.StateApproved, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+			loan := createTestLoan()
+			loan.State = tc.state
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockRepo.On("GetInstallments", mock.Anything, "loan-123").Return(installments(), nil)
+			mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+				{ID: "investment-1", InvestorID: "investor-123", Amount: model.NewMoney(1000)},
+			}, nil)
+			mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+			mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+			mockRepo.On("CreateRepayment", mock.Anything, mock.AnythingOfType("*model.Repayment")).Return("repayment-1", nil)
+			mockRepo.On("CreatePayouts", mock.Anything, mock.Anything).Return(nil)
+			mockRepo.On("UpdateInstallment", mock.Anything, mock.AnythingOfType("*model.Installment")).Return(nil)
+			mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+			mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+			repayment, err := service.RecordRepayment(ctx, model.RecordRepaymentRequest{
+				LoanID: "loan-123",
+				Amount: tc.amount,
+				PaidAt: time.Now(),
+			})
 
 			if tc.expectError {
 				assert.Error(t, err)
+				assert.Nil(t, repayment)
+				mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, repayment.Allocations, tc.expectAlloc)
+			}
+		})
+	}
+}
+
+func TestRecordRepaymentChargesLateFees(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier)).WithLateFee(model.NewMoney(25))
+
+	paidAt := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	loan := createTestLoan()
+	loan.State = model.StateRepaying
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInstallments", mock.Anything, "loan-123").Return([]model.Installment{
+		{ID: "inst-1", Number: 1, DueDate: paidAt.AddDate(0, -2, 0), Principal: model.NewMoney(500), Interest: model.NewMoney(5), Amount: model.NewMoney(505), Status: model.InstallmentPending},
+		{ID: "inst-2", Number: 2, DueDate: paidAt.AddDate(0, -1, 0), Principal: model.NewMoney(500), Interest: model.NewMoney(5), Amount: model.NewMoney(505), Status: model.InstallmentPending},
+		{ID: "inst-3", Number: 3, DueDate: paidAt.AddDate(0, 1, 0), Principal: model.NewMoney(500), Interest: model.NewMoney(5), Amount: model.NewMoney(505), Status: model.InstallmentPending},
+	}, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{}, nil)
+	mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+	mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+	mockRepo.On("CreateRepayment", mock.Anything, mock.AnythingOfType("*model.Repayment")).Return("repayment-1", nil)
+	mockRepo.On("CreatePayouts", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("UpdateInstallment", mock.Anything, mock.AnythingOfType("*model.Installment")).Return(nil)
+	mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+	mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+	repayment, err := service.RecordRepayment(context.Background(), model.RecordRepaymentRequest{
+		LoanID: "loan-123",
+		Amount: model.NewMoney(10),
+		PaidAt: paidAt,
+	})
+
+	assert.NoError(t, err)
+	// The fee of the oldest installment is paid first
+	assert.Equal(t, []model.RepaymentAllocation{{InstallmentID: "inst-1", InstallmentNumber: 1, Fee: model.NewMoney(10)}}, repayment.Allocations)
+	// Both overdue installments are charged and saved, the one not yet due is left alone
+	mockRepo.AssertCalled(t, "UpdateInstallment", mock.Anything, mock.MatchedBy(func(in *model.Installment) bool {
+		return in.ID == "inst-1" && in.Fee == model.NewMoney(25) && in.PaidFee == model.NewMoney(10)
+	}))
+	mockRepo.AssertCalled(t, "UpdateInstallment", mock.Anything, mock.MatchedBy(func(in *model.Installment) bool {
+		return in.ID == "inst-2" && in.Fee == model.NewMoney(25) && in.PaidFee.IsZero()
+	}))
+	mockRepo.AssertNumberOfCalls(t, "UpdateInstallment", 2)
+}
+
+func TestGetInvestorPayouts(t *testing.T) {
+	testCases := []struct {
+		name        string
+		user        *model.User
+		expectError error
+	}{
+		{name: "Own payouts", user: &model.User{ID: "investor-123", Roles: []model.Role{model.RoleInvestor}}},
+		{name: "Staff", user: &model.User{ID: "staff-1", Roles: []model.Role{model.RoleStaff}}},
+		{name: "Another investor's payouts", user: &model.User{ID: "investor-456", Roles: []model.Role{model.RoleInvestor}}, expectError: model.ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+			mockRepo.On("GetPayoutsByInvestor", mock.Anything, "investor-123").Return([]model.InvestorPayout{}, nil)
+
+			_, err := service.GetInvestorPayouts(model.ContextWithUser(context.Background(), tc.user), "investor-123")
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "GetPayoutsByInvestor", mock.Anything, mock.Anything)
 			} else {
 				assert.NoError(t, err)
 			}
@@ -267,16 +1033,155 @@ func TestDisburseLoan(t *testing.T) {
 	}
 }
 
+func TestGetLoanPayouts(t *testing.T) {
+	payouts := []model.InvestorPayout{
+		{ID: "payout-1", LoanID: "loan-123", InvestorID: "investor-123", Amount: model.NewMoney(55)},
+		{ID: "payout-2", LoanID: "loan-123", InvestorID: "investor-456", Amount: model.NewMoney(45)},
+	}
+
+	testCases := []struct {
+		name    string
+		user    *model.User
+		payouts []string
+	}{
+		{name: "Staff", user: &model.User{ID: "staff-1", Roles: []model.Role{model.RoleStaff}}, payouts: []string{"payout-1", "payout-2"}},
+		{name: "Investor", user: &model.User{ID: "investor-456", Roles: []model.Role{model.RoleInvestor}}, payouts: []string{"payout-2"}},
+		{name: "Another investor's loan", user: &model.User{ID: "investor-789", Roles: []model.Role{model.RoleInvestor}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+			mockRepo.On("GetPayoutsByLoan", mock.Anything, "loan-123").Return(slices.Clone(payouts), nil)
+
+			result, err := service.GetLoanPayouts(model.ContextWithUser(context.Background(), tc.user), "loan-123")
+
+			assert.NoError(t, err)
+			var ids []string
+			for _, p := range result {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.payouts, ids)
+		})
+	}
+}
+
+func TestExpireLoans(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
+
+	expiredLoan := createTestLoan()
+	expiredLoan.State = model.StateApproved
+	expiredLoan.TotalInvestmentAmount = model.NewMoney(400)
+	expiredLoan.Approval.FundingDeadline = sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+
+	mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+	mockRepo.On("GetExpiredLoanIDs", mock.Anything, now, 10).Return([]string{"loan-123", "loan-456"}, nil)
+	mockRepo.On("LockExpiredLoan", mock.Anything, "loan-123", now).Return(expiredLoan, nil)
+	// Expired or locked by another instance in the meantime
+	mockRepo.On("LockExpiredLoan", mock.Anything, "loan-456", now).Return(nil, repository.ErrLoanNotFound)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(l *model.Loan) bool {
+		return l.State == model.StateExpired
+	})).Return(nil)
+	mockRepo.On("SetInvestmentsStatus", mock.Anything, "loan-123", model.InvestmentRefundable).Return(int64(1), nil)
+	mockRepo.On("CreateTransition", mock.Anything, mock.MatchedBy(func(tr *model.Transition) bool {
+		return tr.Event == model.EventExpire && tr.NextState == model.StateExpired
+	})).Return(nil)
+	mockRepo.On("CreateOutboxEvent", mock.Anything, mock.MatchedBy(func(e *model.OutboxEvent) bool {
+		return e.EventType == model.EventTypeLoanTransitioned || e.EventType == model.EventTypeLoanExpired
+	})).Return(nil)
+
+	n, failed, err := service.ExpireLoans(ctx, now, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Zero(t, failed)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertCalled(t, "CreateOutboxEvent", mock.Anything, mock.MatchedBy(func(e *model.OutboxEvent) bool {
+		return e.EventType == model.EventTypeLoanExpired && e.LoanID == "loan-123"
+	}))
+	// The investors are notified by the loan.expired handler once the expiry is committed
+	mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.Anything)
+}
+
+func TestExpireLoansContinuesAfterFailure(t *testing.T) {
+	now := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+	// A loan whose deadline has not passed at now, whatever the wall clock says
+	inconsistent := createTestLoan()
+	inconsistent.State = model.StateApproved
+	inconsistent.TotalInvestmentAmount = model.NewMoney(400)
+	inconsistent.Approval.FundingDeadline = sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+
+	expiredLoan := createTestLoan()
+	expiredLoan.ID = "loan-456"
+	expiredLoan.State = model.StateApproved
+	expiredLoan.TotalInvestmentAmount = model.NewMoney(400)
+	expiredLoan.Approval.FundingDeadline = sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+
+	mockRepo.On("WithTransaction", mock.Anything, mock.Anything).Return(inTransaction(mockRepo))
+	mockRepo.On("GetExpiredLoanIDs", mock.Anything, now, 10).Return([]string{"loan-123", "loan-789", "loan-456"}, nil)
+	mockRepo.On("LockExpiredLoan", mock.Anything, "loan-123", now).Return(inconsistent, nil)
+	mockRepo.On("LockExpiredLoan", mock.Anything, "loan-789", now).Return(nil, errors.New("connection reset"))
+	mockRepo.On("LockExpiredLoan", mock.Anything, "loan-456", now).Return(expiredLoan, nil)
+	mockRepo.On("Update", mock.Anything, mock.AnythingOfType("*model.Loan")).Return(nil)
+	mockRepo.On("SetInvestmentsStatus", mock.Anything, "loan-456", model.InvestmentRefundable).Return(int64(1), nil)
+	mockRepo.On("CreateTransition", mock.Anything, mock.AnythingOfType("*model.Transition")).Return(nil)
+	mockRepo.On("CreateOutboxEvent", mock.Anything, mock.AnythingOfType("*model.OutboxEvent")).Return(nil)
+
+	n, failed, err := service.ExpireLoans(context.Background(), now, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 2, failed)
+	mockRepo.AssertNumberOfCalls(t, "Update", 1)
+	mockRepo.AssertCalled(t, "Update", mock.Anything, mock.MatchedBy(func(l *model.Loan) bool {
+		return l.ID == "loan-456" && l.State == model.StateExpired
+	}))
+}
+
 func TestFileOperations(t *testing.T) {
-	service := &service.LoanService{}
+	ctx := context.Background()
 	loan := createTestLoan()
 
 	t.Run("Generate loan agreement", func(t *testing.T) {
-		filePath, err := service.GenerateLoanAgreement(loan)
+		service := service.NewLoanService(new(service.MockLoanRepository), new(service.MockNotifier))
+		body, err := service.GenerateLoanAgreement(loan, time.Now())
 		assert.NoError(t, err)
-		assert.FileExists(t, filePath)
+		assert.True(t, strings.HasPrefix(string(body), "%PDF-"))
+	})
+
+	t.Run("Upload loan agreement", func(t *testing.T) {
+		store, err := storage.NewLocalStore(t.TempDir())
+		assert.NoError(t, err)
+		service := service.NewLoanService(new(service.MockLoanRepository), new(service.MockNotifier)).WithDocumentStore(store)
+
+		doc, err := service.GenerateAndUploadLoanAgreement(ctx, loan, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, model.DocumentLoanAgreement, doc.Kind)
+		assert.Len(t, doc.SHA256, 64)
+
+		stored, err := store.Get(ctx, doc.StorageKey)
+		assert.NoError(t, err)
+		defer stored.Close()
+		body, _ := io.ReadAll(stored)
+		sum := sha256.Sum256(body)
+		assert.Equal(t, doc.SHA256, hex.EncodeToString(sum[:]))
+		assert.Equal(t, doc.Size, int64(len(body)))
+	})
 
-		// Cleanup
-		defer os.Remove(filePath)
+	t.Run("Upload without document store", func(t *testing.T) {
+		service := service.NewLoanService(new(service.MockLoanRepository), new(service.MockNotifier))
+		_, err := service.GenerateAndUploadLoanAgreement(ctx, loan, time.Now())
+		assert.Error(t, err)
 	})
 }
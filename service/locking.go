@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+)
+
+// LockingStrategy selects how a transition guards the loan row it reads.
+type LockingStrategy string
+
+const (
+	// LockingOptimistic reads the loan without a lock and relies on the
+	// version check in Update, retrying on conflicts.
+	LockingOptimistic LockingStrategy = "optimistic"
+	// LockingPessimistic reads the loan with SELECT ... FOR UPDATE so
+	// concurrent transitions on the same loan queue up instead of conflicting.
+	LockingPessimistic LockingStrategy = "pessimistic"
+)
+
+// ParseLockingStrategy validates a locking strategy name from configuration.
+func ParseLockingStrategy(s string) (LockingStrategy, error) {
+	switch l := LockingStrategy(s); l {
+	case LockingOptimistic, LockingPessimistic:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid locking strategy %q, must be optimistic or pessimistic", s)
+	}
+}
+
+// WithLockingStrategy sets how state transitions read the loan they update.
+func (s *LoanService) WithLockingStrategy(l LockingStrategy) *LoanService {
+	s.locking = l
+	return s
+}
+
+// getLoanForUpdate reads the loan inside the transaction, locking the row
+// when the service uses pessimistic locking.
+func (s *LoanService) getLoanForUpdate(ctx context.Context, rTx repo.LoanRepositoryInterface, id string) (*model.Loan, error) {
+	if s.locking == LockingPessimistic {
+		return rTx.GetLoanForUpdate(ctx, id)
+	}
+	return rTx.GetLoan(ctx, id)
+}
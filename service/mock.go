@@ -4,6 +4,7 @@ import (
 	"context"
 	"loan-engine/model"
 	"loan-engine/repository"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -31,11 +32,91 @@ func (m *MockLoanRepository) GetLoan(ctx context.Context, id string) (*model.Loa
 	return args.Get(0).(*model.Loan), args.Error(1)
 }
 
+func (m *MockLoanRepository) GetLoanForUpdate(ctx context.Context, id string) (*model.Loan, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Loan), args.Error(1)
+}
+
+func (m *MockLoanRepository) List(ctx context.Context, filter model.LoanFilter) ([]model.Loan, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]model.Loan), args.Error(1)
+}
+
+func (m *MockLoanRepository) GetExpiredLoanIDs(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	args := m.Called(ctx, now, limit)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockLoanRepository) LockExpiredLoan(ctx context.Context, id string, now time.Time) (*model.Loan, error) {
+	args := m.Called(ctx, id, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Loan), args.Error(1)
+}
+
 func (m *MockLoanRepository) CreateTransition(ctx context.Context, transition *model.Transition) error {
 	args := m.Called(ctx, transition)
 	return args.Error(0)
 }
 
+func (m *MockLoanRepository) GetTransitions(ctx context.Context, loanID string) ([]model.Transition, error) {
+	args := m.Called(ctx, loanID)
+	return args.Get(0).([]model.Transition), args.Error(1)
+}
+
+func (m *MockLoanRepository) CreateOutboxEvent(ctx context.Context, e *model.OutboxEvent) error {
+	args := m.Called(ctx, e)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) CreateDocument(ctx context.Context, d *model.Document) error {
+	args := m.Called(ctx, d)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) UpdateDocumentStatus(ctx context.Context, loan *model.Loan) error {
+	args := m.Called(ctx, loan)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) GetDocuments(ctx context.Context, loanID string) ([]model.Document, error) {
+	args := m.Called(ctx, loanID)
+	return args.Get(0).([]model.Document), args.Error(1)
+}
+
+func (m *MockLoanRepository) GetDocument(ctx context.Context, id string) (*model.Document, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Document), args.Error(1)
+}
+
+func (m *MockLoanRepository) CreateNotificationAttempt(ctx context.Context, a *model.NotificationAttempt) error {
+	args := m.Called(ctx, a)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) GetNotificationAttempts(ctx context.Context, loanID string) ([]model.NotificationAttempt, error) {
+	args := m.Called(ctx, loanID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.NotificationAttempt), args.Error(1)
+}
+
+func (m *MockLoanRepository) GetNotificationAttempt(ctx context.Context, loanID, id string) (*model.NotificationAttempt, error) {
+	args := m.Called(ctx, loanID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.NotificationAttempt), args.Error(1)
+}
+
 func (m *MockLoanRepository) CreateInvestment(ctx context.Context, loan *model.Loan) error {
 	args := m.Called(ctx, loan)
 	return args.Error(0)
@@ -46,17 +127,203 @@ func (m *MockLoanRepository) GetInvestments(ctx context.Context, loanID string)
 	return args.Get(0).([]model.Investment), args.Error(1)
 }
 
+func (m *MockLoanRepository) GetInvestment(ctx context.Context, loanID, investmentID string) (*model.Investment, error) {
+	args := m.Called(ctx, loanID, investmentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Investment), args.Error(1)
+}
+
+func (m *MockLoanRepository) UpdateInvestmentStatus(ctx context.Context, investmentID string, status model.InvestmentStatus) error {
+	args := m.Called(ctx, investmentID, status)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) SetInvestmentsStatus(ctx context.Context, loanID string, status model.InvestmentStatus) (int64, error) {
+	args := m.Called(ctx, loanID, status)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockLoanRepository) CreateInstallments(ctx context.Context, installments []model.Installment) error {
+	args := m.Called(ctx, installments)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) GetInstallments(ctx context.Context, loanID string) ([]model.Installment, error) {
+	args := m.Called(ctx, loanID)
+	return args.Get(0).([]model.Installment), args.Error(1)
+}
+
+func (m *MockLoanRepository) UpdateInstallment(ctx context.Context, installment *model.Installment) error {
+	args := m.Called(ctx, installment)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) CreateRepayment(ctx context.Context, repayment *model.Repayment) (string, error) {
+	args := m.Called(ctx, repayment)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockLoanRepository) CreatePayouts(ctx context.Context, payouts []model.InvestorPayout) error {
+	args := m.Called(ctx, payouts)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepository) GetPayoutsByLoan(ctx context.Context, loanID string) ([]model.InvestorPayout, error) {
+	args := m.Called(ctx, loanID)
+	return args.Get(0).([]model.InvestorPayout), args.Error(1)
+}
+
+func (m *MockLoanRepository) GetPayoutsByInvestor(ctx context.Context, investorID string) ([]model.InvestorPayout, error) {
+	args := m.Called(ctx, investorID)
+	return args.Get(0).([]model.InvestorPayout), args.Error(1)
+}
+
 func (m *MockLoanRepository) WithTransaction(ctx context.Context, fn func(repo repository.LoanRepositoryInterface) error) error {
 	args := m.Called(ctx, fn)
+	// Return a func to run the callback and report its error
+	if run, ok := args.Get(0).(func(func(repo repository.LoanRepositoryInterface) error) error); ok {
+		return run(fn)
+	}
+	return args.Error(0)
+}
+
+// Mock Outbox Repository
+type MockOutboxRepository struct {
+	mock.Mock
+}
+
+func (m *MockOutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]model.OutboxEvent), args.Error(1)
+}
+
+func (m *MockOutboxRepository) MarkDelivered(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) MarkFailed(ctx context.Context, id int64, lastError string, retryIn time.Duration, dead bool) error {
+	args := m.Called(ctx, id, lastError, retryIn, dead)
+	return args.Error(0)
+}
+
+// Mock Webhook Repository
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateSubscription(ctx context.Context, s *model.WebhookSubscription) error {
+	args := m.Called(ctx, s)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) DeactivateSubscription(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	args := m.Called(ctx, deliveries)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]model.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) RecordAttempt(ctx context.Context, d *model.WebhookDelivery, a *model.WebhookDeliveryAttempt, retryIn time.Duration) error {
+	args := m.Called(ctx, d, a, retryIn)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]model.WebhookDelivery, error) {
+	args := m.Called(ctx, subscriptionID, limit)
+	return args.Get(0).([]model.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetDelivery(ctx context.Context, subscriptionID, id string) (*model.WebhookDelivery, error) {
+	args := m.Called(ctx, subscriptionID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ReplayDelivery(ctx context.Context, subscriptionID, id string) error {
+	args := m.Called(ctx, subscriptionID, id)
 	return args.Error(0)
 }
 
-// Mock Email Service
-type MockEmailService struct {
+// Mock User Repository
+type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockEmailService) SendInvestmentAgreement(ctx context.Context, agreementURL string, loan *model.Loan) error {
-	args := m.Called(ctx, agreementURL, loan)
+func (m *MockUserRepository) CreateUser(ctx context.Context, u *model.User) error {
+	args := m.Called(ctx, u)
 	return args.Error(0)
 }
+
+func (m *MockUserRepository) GetUser(ctx context.Context, id string) (*model.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) ListUsers(ctx context.Context) ([]model.User, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, u *model.User) error {
+	args := m.Called(ctx, u)
+	return args.Error(0)
+}
+
+// Mock Notifier
+type MockNotifier struct {
+	mock.Mock
+}
+
+// Notify returns the attempt a notifier would record for the error the call
+// was set up to return.
+func (m *MockNotifier) Notify(ctx context.Context, n model.Notification) (model.NotificationAttempt, error) {
+	args := m.Called(ctx, n)
+	attempt := model.NewNotificationAttempt(n, "mock")
+	attempt.Status = model.NotificationSent
+	if err := args.Error(0); err != nil {
+		attempt.Status = model.NotificationFailed
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+	return attempt, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"loan-engine/model"
+)
+
+// notify sends every notification, skipping recipients without an email
+// address, and returns the joined errors of the failed ones. Each attempt is
+// recorded, sent or not.
+func (s *LoanService) notify(ctx context.Context, notifications ...model.Notification) error {
+	var errs []error
+	for _, n := range notifications {
+		if n.To.Email == "" {
+			log.Printf("Skipping %s notification for loan %s: recipient has no email address", n.Type, n.LoanID)
+			continue
+		}
+
+		_, err := s.sendNotification(ctx, n, "")
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendNotification sends the notification and records the attempt. Failing to
+// record it is only logged: the recipient got the message either way.
+func (s *LoanService) sendNotification(ctx context.Context, n model.Notification, resentFrom string) (*model.NotificationAttempt, error) {
+	attempt, sendErr := s.notifier.Notify(ctx, n)
+	attempt.ResentFrom = resentFrom
+
+	err := s.repo.CreateNotificationAttempt(ctx, &attempt)
+	if err != nil {
+		log.Printf("Failed to record %s notification for loan %s: %v", n.Type, n.LoanID, err)
+	}
+	return &attempt, sendErr
+}
+
+// ListNotifications returns the notification attempts of the loan, newest first.
+func (s *LoanService) ListNotifications(ctx context.Context, loanID string) ([]model.NotificationAttempt, error) {
+	// Make sure the loan exists so an unknown ID is reported as not found
+	_, err := s.repo.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetNotificationAttempts(ctx, loanID)
+}
+
+// ResendNotification sends the notification of a recorded attempt again,
+// rendered from the current templates, and returns the new attempt. An
+// investment agreement gets a fresh link to the latest letter since the one
+// sent before may have expired.
+func (s *LoanService) ResendNotification(ctx context.Context, loanID, notificationID string) (*model.NotificationAttempt, error) {
+	previous, err := s.repo.GetNotificationAttempt(ctx, loanID, notificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	n := previous.Notification
+	if n.Type == model.NotificationInvestmentAgreement {
+		n.URL, err = s.agreementLink(ctx, loanID, n.InvestmentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.sendNotification(ctx, n, previous.ID)
+}
+
+// agreementLink returns a download link to the latest agreement letter of the investment.
+func (s *LoanService) agreementLink(ctx context.Context, loanID, investmentID string) (string, error) {
+	documents, err := s.repo.GetDocuments(ctx, loanID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get documents for loan %s: %w", loanID, err)
+	}
+	// Documents come newest first
+	for i := range documents {
+		doc := &documents[i]
+		if doc.Kind == model.DocumentInvestmentAgreement && doc.InvestmentID == investmentID {
+			return s.DocumentURL(ctx, doc)
+		}
+	}
+	return "", fmt.Errorf("%w: no agreement letter for investment %s", model.ErrValidationFailed, investmentID)
+}
+
+// HandleLoanApproved tells the borrower their loan is open for investment.
+// It is registered for model.EventTypeLoanApproved.
+func (s *LoanService) HandleLoanApproved(ctx context.Context, e model.OutboxEvent) error {
+	loan, err := s.repo.GetLoan(ctx, e.LoanID)
+	if err != nil {
+		return err
+	}
+
+	return s.notify(ctx, model.NewLoanApprovedNotification(loan))
+}
+
+// HandleInvestmentAdded confirms the investment carried by the event to its
+// investor. It is registered for model.EventTypeInvestmentAdded.
+func (s *LoanService) HandleInvestmentAdded(ctx context.Context, e model.OutboxEvent) error {
+	var transition model.Transition
+	err := json.Unmarshal(e.Payload, &transition)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", e.EventType, err)
+	}
+	var investment model.Investment
+	err = json.Unmarshal(transition.Payload, &investment)
+	if err != nil {
+		return fmt.Errorf("failed to decode investment of %s event: %w", e.EventType, err)
+	}
+
+	loan, err := s.repo.GetLoan(ctx, e.LoanID)
+	if err != nil {
+		return err
+	}
+
+	return s.notify(ctx, model.NewInvestmentConfirmedNotification(loan, investment))
+}
+
+// HandleLoanDisbursed tells the borrower and every active investor that the
+// loan was disbursed. A failure for one recipient retries the whole event,
+// which skips the recipients already notified. It is registered for
+// model.EventTypeLoanDisbursed.
+func (s *LoanService) HandleLoanDisbursed(ctx context.Context, e model.OutboxEvent) error {
+	loan, err := s.repo.GetLoan(ctx, e.LoanID)
+	if err != nil {
+		return err
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get investments for loan %s: %w", loan.ID, err)
+	}
+	loan.Investments = model.FilterInvestments(investments, model.InvestmentActive)
+
+	notifications, err := s.unsent(ctx, model.NewLoanDisbursedNotifications(loan))
+	if err != nil {
+		return err
+	}
+
+	return s.notify(ctx, notifications...)
+}
+
+// unsent drops the notifications of the loan whose recipient already got one
+// of the same type, e.g. on an earlier delivery of the event that failed for
+// another recipient.
+func (s *LoanService) unsent(ctx context.Context, notifications []model.Notification) ([]model.Notification, error) {
+	if len(notifications) == 0 {
+		return notifications, nil
+	}
+
+	loanID := notifications[0].LoanID
+	attempts, err := s.repo.GetNotificationAttempts(ctx, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications for loan %s: %w", loanID, err)
+	}
+
+	type recipient struct {
+		notificationType model.NotificationType
+		investmentID     string
+		email            string
+	}
+	sent := make(map[recipient]bool)
+	for _, a := range attempts {
+		if a.Status == model.NotificationSent {
+			sent[recipient{a.Type, a.InvestmentID, a.Recipient.Email}] = true
+		}
+	}
+
+	var pending []model.Notification
+	for _, n := range notifications {
+		if !sent[recipient{n.Type, n.InvestmentID, n.To.Email}] {
+			pending = append(pending, n)
+		}
+	}
+	return pending, nil
+}
+
+// HandleLoanExpired tells the investors of a loan that missed its funding
+// deadline that their investments are refundable. It is registered for
+// model.EventTypeLoanExpired.
+func (s *LoanService) HandleLoanExpired(ctx context.Context, e model.OutboxEvent) error {
+	var transition model.Transition
+	err := json.Unmarshal(e.Payload, &transition)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", e.EventType, err)
+	}
+
+	loan, err := s.repo.GetLoan(ctx, e.LoanID)
+	if err != nil {
+		return err
+	}
+
+	investments, err := s.repo.GetInvestments(ctx, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get investments for loan %s: %w", loan.ID, err)
+	}
+	loan.Investments = model.FilterInvestments(investments, model.InvestmentRefundable)
+
+	return s.notify(ctx, model.NewFundingExpiredNotifications(loan, transition.TransitionTime)...)
+}
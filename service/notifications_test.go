@@ -0,0 +1,307 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"loan-engine/model"
+	"loan-engine/repository"
+	"loan-engine/service"
+	"loan-engine/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleLoanApproved(t *testing.T) {
+	approvedAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		email        string
+		expectNotify bool
+	}{
+		{name: "Borrower with email", email: "borrower@example.com", expectNotify: true},
+		{name: "Borrower without email", email: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockLoanRepository)
+			mockNotifier := new(service.MockNotifier)
+			service := service.NewLoanService(mockRepo, mockNotifier)
+
+			loan := createTestLoan()
+			loan.State = model.StateApproved
+			loan.BorrowerName = "Budi"
+			loan.BorrowerEmail = tc.email
+			loan.Approval.ApprovalDate = sql.NullTime{Time: approvedAt, Valid: true}
+			mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+			mockNotifier.On("Notify", mock.Anything, model.Notification{
+				Type:     model.NotificationLoanApproved,
+				LoanID:   "loan-123",
+				To:       model.Recipient{Name: "Budi", Email: tc.email},
+				Currency: model.DefaultCurrency,
+				Amount:   model.NewMoney(1000),
+				Date:     approvedAt,
+			}).Return(nil)
+			mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+			err := service.HandleLoanApproved(context.Background(), model.OutboxEvent{EventType: model.EventTypeLoanApproved, LoanID: "loan-123"})
+
+			assert.NoError(t, err)
+			if tc.expectNotify {
+				mockNotifier.AssertExpectations(t)
+			} else {
+				mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandleInvestmentAdded(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
+
+	investment := model.Investment{ID: "investment-1", InvestorID: "investor-1", Name: "Jane", Email: "jane@example.com", Amount: model.NewMoney(500), Status: model.InvestmentActive}
+	investmentData, err := json.Marshal(investment)
+	assert.NoError(t, err)
+	payload, err := json.Marshal(model.Transition{LoanID: "loan-123", Event: model.EventAddInvestment, Payload: investmentData})
+	assert.NoError(t, err)
+
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+	mockNotifier.On("Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.Type == model.NotificationInvestmentConfirmed && n.InvestmentID == "investment-1" &&
+			n.To.Email == "jane@example.com" && n.Amount.Cmp(model.NewMoney(500)) == 0
+	})).Return(nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+		return a.Type == model.NotificationInvestmentConfirmed && a.LoanID == "loan-123" && a.InvestmentID == "investment-1" &&
+			a.Recipient.Email == "jane@example.com" && a.Status == model.NotificationSent
+	})).Return(nil)
+
+	err = service.HandleInvestmentAdded(context.Background(), model.OutboxEvent{EventType: model.EventTypeInvestmentAdded, LoanID: "loan-123", Payload: payload})
+
+	assert.NoError(t, err)
+	mockNotifier.AssertExpectations(t)
+}
+
+func TestHandleLoanDisbursed(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
+
+	loan := createTestLoan()
+	loan.State = model.StateDisbursed
+	loan.BorrowerEmail = "borrower@example.com"
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", Email: "jane@example.com", Amount: model.NewMoney(600), Status: model.InvestmentActive},
+		{ID: "investment-2", Email: "joe@example.com", Amount: model.NewMoney(300), Status: model.InvestmentWithdrawn},
+		{ID: "investment-3", Email: "john@example.com", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.To.Email == "john@example.com"
+	})).Return(errors.New("mailbox unavailable"))
+	mockNotifier.On("Notify", mock.Anything, mock.Anything).Return(nil)
+	// Failing to record an attempt does not fail the event
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+		return a.Recipient.Email == "borrower@example.com"
+	})).Return(errors.New("connection reset"))
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return([]model.NotificationAttempt{}, nil)
+
+	err := service.HandleLoanDisbursed(context.Background(), model.OutboxEvent{EventType: model.EventTypeLoanDisbursed, LoanID: "loan-123"})
+
+	// The borrower and the other investor are still notified, but the event is retried
+	assert.ErrorContains(t, err, "mailbox unavailable")
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 3)
+	mockNotifier.AssertCalled(t, "Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.To.Email == "borrower@example.com" && n.InvestmentID == "" && n.Type == model.NotificationLoanDisbursed
+	}))
+	mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.To.Email == "joe@example.com"
+	}))
+	mockRepo.AssertCalled(t, "CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+		return a.Recipient.Email == "john@example.com" && a.Status == model.NotificationFailed && a.Error == "mailbox unavailable"
+	}))
+}
+
+func TestHandleLoanDisbursedSkipsNotifiedRecipients(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
+
+	loan := createTestLoan()
+	loan.State = model.StateDisbursed
+	loan.BorrowerEmail = "borrower@example.com"
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", Email: "jane@example.com", Amount: model.NewMoney(600), Status: model.InvestmentActive},
+		{ID: "investment-3", Email: "john@example.com", Amount: model.NewMoney(400), Status: model.InvestmentActive},
+	}, nil)
+	// The previous delivery reached the borrower and Jane but failed for John
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return([]model.NotificationAttempt{
+		{Type: model.NotificationLoanDisbursed, Recipient: model.Recipient{Email: "borrower@example.com"}, Status: model.NotificationSent},
+		{Type: model.NotificationLoanDisbursed, InvestmentID: "investment-1", Recipient: model.Recipient{Email: "jane@example.com"}, Status: model.NotificationSent},
+		{Type: model.NotificationLoanDisbursed, InvestmentID: "investment-3", Recipient: model.Recipient{Email: "john@example.com"}, Status: model.NotificationFailed},
+		{Type: model.NotificationInvestmentConfirmed, InvestmentID: "investment-3", Recipient: model.Recipient{Email: "john@example.com"}, Status: model.NotificationSent},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+	err := service.HandleLoanDisbursed(context.Background(), model.OutboxEvent{EventType: model.EventTypeLoanDisbursed, LoanID: "loan-123"})
+
+	assert.NoError(t, err)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	mockNotifier.AssertCalled(t, "Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+		return n.To.Email == "john@example.com"
+	}))
+}
+
+func TestHandleLoanExpired(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	mockNotifier := new(service.MockNotifier)
+	service := service.NewLoanService(mockRepo, mockNotifier)
+
+	expiredAt := time.Date(2024, 3, 15, 0, 5, 0, 0, time.UTC)
+	payload, err := json.Marshal(model.Transition{LoanID: "loan-123", Event: model.EventExpire, NextState: model.StateExpired, TransitionTime: expiredAt})
+	assert.NoError(t, err)
+
+	loan := createTestLoan()
+	loan.State = model.StateExpired
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(loan, nil)
+	mockRepo.On("GetInvestments", mock.Anything, "loan-123").Return([]model.Investment{
+		{ID: "investment-1", Email: "john@example.com", Amount: model.NewMoney(400), Status: model.InvestmentRefundable},
+		{ID: "investment-2", Email: "joe@example.com", Amount: model.NewMoney(300), Status: model.InvestmentWithdrawn},
+	}, nil)
+	mockNotifier.On("Notify", mock.Anything, model.Notification{
+		Type:         model.NotificationFundingExpired,
+		LoanID:       "loan-123",
+		To:           model.Recipient{Email: "john@example.com"},
+		InvestmentID: "investment-1",
+		Currency:     model.DefaultCurrency,
+		Amount:       model.NewMoney(400),
+		Date:         expiredAt,
+	}).Return(nil)
+	mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+		return a.Type == model.NotificationFundingExpired && a.Status == model.NotificationSent
+	})).Return(nil)
+
+	err = service.HandleLoanExpired(context.Background(), model.OutboxEvent{EventType: model.EventTypeLoanExpired, LoanID: "loan-123", Payload: payload})
+
+	assert.NoError(t, err)
+	mockNotifier.AssertExpectations(t)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestListNotifications(t *testing.T) {
+	mockRepo := new(service.MockLoanRepository)
+	service := service.NewLoanService(mockRepo, new(service.MockNotifier))
+
+	attempts := []model.NotificationAttempt{{ID: "notification-2", LoanID: "loan-123"}, {ID: "notification-1", LoanID: "loan-123"}}
+	mockRepo.On("GetLoan", mock.Anything, "loan-123").Return(createTestLoan(), nil)
+	mockRepo.On("GetNotificationAttempts", mock.Anything, "loan-123").Return(attempts, nil)
+	mockRepo.On("GetLoan", mock.Anything, "missing").Return(nil, repository.ErrLoanNotFound)
+
+	got, err := service.ListNotifications(context.Background(), "loan-123")
+	assert.NoError(t, err)
+	assert.Equal(t, attempts, got)
+
+	_, err = service.ListNotifications(context.Background(), "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	mockRepo.AssertNotCalled(t, "GetNotificationAttempts", mock.Anything, "missing")
+}
+
+func TestResendNotification(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Resends the recorded notification", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		mockNotifier := new(service.MockNotifier)
+		service := service.NewLoanService(mockRepo, mockNotifier)
+
+		n := model.Notification{Type: model.NotificationLoanApproved, LoanID: "loan-123", To: model.Recipient{Name: "Budi", Email: "budi@example.com"}}
+		mockRepo.On("GetNotificationAttempt", mock.Anything, "loan-123", "notification-1").Return(&model.NotificationAttempt{
+			ID: "notification-1", LoanID: "loan-123", Status: model.NotificationFailed, Notification: n,
+		}, nil)
+		mockNotifier.On("Notify", mock.Anything, n).Return(nil)
+		mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+			return a.ResentFrom == "notification-1" && a.Status == model.NotificationSent
+		})).Return(nil)
+
+		attempt, err := service.ResendNotification(ctx, "loan-123", "notification-1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "notification-1", attempt.ResentFrom)
+		mockRepo.AssertExpectations(t)
+		mockNotifier.AssertExpectations(t)
+	})
+
+	t.Run("Investment agreement gets a fresh link", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		mockNotifier := new(service.MockNotifier)
+		store, err := storage.NewLocalStore(t.TempDir())
+		assert.NoError(t, err)
+		service := service.NewLoanService(mockRepo, mockNotifier).WithDocumentStore(store)
+
+		n := model.Notification{
+			Type: model.NotificationInvestmentAgreement, LoanID: "loan-123", InvestmentID: "investment-1",
+			To: model.Recipient{Email: "jane@example.com"}, URL: "file:///expired/letter-1a.pdf",
+		}
+		mockRepo.On("GetNotificationAttempt", mock.Anything, "loan-123", "notification-1").Return(&model.NotificationAttempt{
+			ID: "notification-1", LoanID: "loan-123", Notification: n,
+		}, nil)
+		mockRepo.On("GetDocuments", mock.Anything, "loan-123").Return([]model.Document{
+			{ID: "doc-3", InvestmentID: "investment-2", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-2.pdf"},
+			{ID: "doc-2", InvestmentID: "investment-1", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-1b.pdf"},
+			{ID: "doc-1", InvestmentID: "investment-1", Kind: model.DocumentInvestmentAgreement, StorageKey: "loans/loan-123/letter-1a.pdf"},
+		}, nil)
+		mockNotifier.On("Notify", mock.Anything, mock.MatchedBy(func(n model.Notification) bool {
+			return strings.HasSuffix(n.URL, "/loans/loan-123/letter-1b.pdf")
+		})).Return(nil)
+		mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.Anything).Return(nil)
+
+		_, err = service.ResendNotification(ctx, "loan-123", "notification-1")
+
+		assert.NoError(t, err)
+		mockNotifier.AssertExpectations(t)
+	})
+
+	t.Run("Failed resend is recorded", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		mockNotifier := new(service.MockNotifier)
+		service := service.NewLoanService(mockRepo, mockNotifier)
+
+		n := model.Notification{Type: model.NotificationLoanApproved, LoanID: "loan-123", To: model.Recipient{Email: "budi@example.com"}}
+		mockRepo.On("GetNotificationAttempt", mock.Anything, "loan-123", "notification-1").Return(&model.NotificationAttempt{
+			ID: "notification-1", LoanID: "loan-123", Notification: n,
+		}, nil)
+		mockNotifier.On("Notify", mock.Anything, n).Return(errors.New("mailbox unavailable"))
+		mockRepo.On("CreateNotificationAttempt", mock.Anything, mock.MatchedBy(func(a *model.NotificationAttempt) bool {
+			return a.ResentFrom == "notification-1" && a.Status == model.NotificationFailed
+		})).Return(nil)
+
+		_, err := service.ResendNotification(ctx, "loan-123", "notification-1")
+
+		assert.ErrorContains(t, err, "mailbox unavailable")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown notification", func(t *testing.T) {
+		mockRepo := new(service.MockLoanRepository)
+		mockNotifier := new(service.MockNotifier)
+		service := service.NewLoanService(mockRepo, mockNotifier)
+
+		mockRepo.On("GetNotificationAttempt", mock.Anything, "loan-123", "missing").Return(nil, repository.ErrNotificationAttemptNotFound)
+
+		_, err := service.ResendNotification(ctx, "loan-123", "missing")
+
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		mockNotifier.AssertNotCalled(t, "Notify", mock.Anything, mock.Anything)
+	})
+}
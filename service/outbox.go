@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var outboxDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "loan_service_outbox_deliveries_total",
+	Help: "Outbox delivery attempts by event type and result (delivered, retried, dead).",
+}, []string{"event_type", "result"})
+
+// OutboxHandler reacts to a domain event. Events are delivered at least once,
+// so a handler must tolerate seeing the same event again.
+type OutboxHandler func(ctx context.Context, event model.OutboxEvent) error
+
+// OutboxDispatcher delivers outbox events to the handlers registered for
+// their type. A failed event is retried with backoff and moved to the dead
+// letters once the retry policy runs out of attempts.
+type OutboxDispatcher struct {
+	repo     repo.OutboxRepositoryInterface
+	handlers map[model.OutboxEventType][]OutboxHandler
+	retry    RetryPolicy
+	lease    time.Duration
+}
+
+// NewOutboxDispatcher returns a dispatcher that leases events for lease while
+// their handlers run; it should comfortably exceed the slowest handler.
+func NewOutboxDispatcher(repo repo.OutboxRepositoryInterface, retry RetryPolicy, lease time.Duration) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		repo:     repo,
+		handlers: make(map[model.OutboxEventType][]OutboxHandler),
+		retry:    retry,
+		lease:    lease,
+	}
+}
+
+// Register adds a handler for the event type. Register all handlers before Run.
+func (d *OutboxDispatcher) Register(eventType model.OutboxEventType, h OutboxHandler) {
+	d.handlers[eventType] = append(d.handlers[eventType], h)
+}
+
+// Dispatch delivers one batch of due events and returns how many were claimed.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context, batchSize int) (int, error) {
+	events, err := d.repo.Claim(ctx, batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		err := d.deliver(ctx, e)
+		if err == nil {
+			outboxDeliveries.WithLabelValues(string(e.EventType), "delivered").Inc()
+			if err := d.repo.MarkDelivered(ctx, e.ID); err != nil {
+				log.Printf("Failed to mark outbox event %d delivered: %v", e.ID, err)
+			}
+			continue
+		}
+
+		dead := e.Attempts >= d.retry.MaxAttempts
+		result := "retried"
+		if dead {
+			result = "dead"
+			log.Printf("Outbox event %d (%s) moved to dead letters after %d attempts: %v", e.ID, e.EventType, e.Attempts, err)
+		} else {
+			log.Printf("Outbox event %d (%s) failed on attempt %d: %v", e.ID, e.EventType, e.Attempts, err)
+		}
+		outboxDeliveries.WithLabelValues(string(e.EventType), result).Inc()
+
+		if err := d.repo.MarkFailed(ctx, e.ID, err.Error(), d.retry.backoff(e.Attempts), dead); err != nil {
+			log.Printf("Failed to record outbox event %d failure: %v", e.ID, err)
+		}
+	}
+
+	return len(events), nil
+}
+
+// deliver runs every handler of the event and returns the first error.
+func (d *OutboxDispatcher) deliver(ctx context.Context, e model.OutboxEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+
+	for _, h := range d.handlers[e.EventType] {
+		if err := h(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run calls Dispatch every interval until ctx is cancelled.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep draining while full batches come back
+			for {
+				n, err := d.Dispatch(ctx, batchSize)
+				if err != nil {
+					log.Printf("Failed to dispatch outbox events: %v", err)
+					break
+				}
+				if n < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
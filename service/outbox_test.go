@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"loan-engine/model"
+	"loan-engine/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOutboxDispatcher(t *testing.T) {
+	ctx := context.Background()
+	policy := service.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	testCases := []struct {
+		name       string
+		attempts   int
+		handlerErr error
+		expectDead bool
+	}{
+		{name: "Delivered", attempts: 1},
+		{name: "Retried after failure", attempts: 1, handlerErr: errors.New("smtp down")},
+		{name: "Dead lettered after last attempt", attempts: 3, handlerErr: errors.New("smtp down"), expectDead: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockOutbox := new(service.MockOutboxRepository)
+			dispatcher := service.NewOutboxDispatcher(mockOutbox, policy, time.Minute)
+
+			event := model.OutboxEvent{ID: 7, EventType: model.EventTypeLoanInvested, LoanID: "loan-123", Attempts: tc.attempts}
+			mockOutbox.On("Claim", mock.Anything, 10, time.Minute).Return([]model.OutboxEvent{event}, nil)
+			mockOutbox.On("MarkDelivered", mock.Anything, int64(7)).Return(nil)
+			mockOutbox.On("MarkFailed", mock.Anything, int64(7), mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			var handled []int64
+			dispatcher.Register(model.EventTypeLoanInvested, func(ctx context.Context, e model.OutboxEvent) error {
+				handled = append(handled, e.ID)
+				return tc.handlerErr
+			})
+			// Handlers of other event types are not called
+			dispatcher.Register(model.EventTypeLoanApproved, func(ctx context.Context, e model.OutboxEvent) error {
+				t.Fatal("unexpected handler call")
+				return nil
+			})
+
+			n, err := dispatcher.Dispatch(ctx, 10)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			assert.Equal(t, []int64{7}, handled)
+			if tc.handlerErr == nil {
+				mockOutbox.AssertCalled(t, "MarkDelivered", mock.Anything, int64(7))
+				mockOutbox.AssertNotCalled(t, "MarkFailed", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				mockOutbox.AssertCalled(t, "MarkFailed", mock.Anything, int64(7), "smtp down", mock.AnythingOfType("time.Duration"), tc.expectDead)
+				mockOutbox.AssertNotCalled(t, "MarkDelivered", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestOutboxDispatcherRecoversHandlerPanic(t *testing.T) {
+	mockOutbox := new(service.MockOutboxRepository)
+	dispatcher := service.NewOutboxDispatcher(mockOutbox, service.RetryPolicy{MaxAttempts: 3}, time.Minute)
+
+	mockOutbox.On("Claim", mock.Anything, 10, time.Minute).Return([]model.OutboxEvent{
+		{ID: 1, EventType: model.EventTypeLoanDisbursed, Attempts: 1},
+	}, nil)
+	mockOutbox.On("MarkFailed", mock.Anything, int64(1), "handler panicked: boom", mock.Anything, false).Return(nil)
+	dispatcher.Register(model.EventTypeLoanDisbursed, func(ctx context.Context, e model.OutboxEvent) error {
+		panic("boom")
+	})
+
+	_, err := dispatcher.Dispatch(context.Background(), 10)
+
+	assert.NoError(t, err)
+	mockOutbox.AssertExpectations(t)
+}
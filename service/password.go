@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Passwords are stored as "pbkdf2-sha256$<iterations>$<salt>$<key>" with the
+// salt and key in unpadded base64, so the cost can be raised later without
+// invalidating existing hashes.
+const (
+	passwordHashScheme     = "pbkdf2-sha256"
+	passwordHashIterations = 100000
+	passwordSaltSize       = 16
+	passwordKeySize        = 32
+)
+
+// HashPassword derives a salted PBKDF2-HMAC-SHA256 hash of the password.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := pbkdf2SHA256([]byte(password), salt, passwordHashIterations, passwordKeySize)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether the password matches a hash from HashPassword.
+func CheckPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+
+	derived := pbkdf2SHA256([]byte(password), salt, iterations, len(key))
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// maxCachedPasswords bounds the password cache; it is emptied when full.
+const maxCachedPasswords = 10000
+
+// passwordCache remembers passwords that recently matched a hash, so clients
+// sending their credentials with every request don't pay for PBKDF2 each
+// time. Entries are keyed by an HMAC of the hash and password under a random
+// per-process key, so the cache never holds the passwords themselves. Changing
+// the password changes the hash, which invalidates the entry.
+type passwordCache struct {
+	ttl time.Duration
+	key []byte
+	now func() time.Time
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newPasswordCache(ttl time.Duration) *passwordCache {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate password cache key: %v", err))
+	}
+	return &passwordCache{ttl: ttl, key: key, now: time.Now, expires: make(map[string]time.Time)}
+}
+
+// Check is CheckPassword, skipping the key derivation for a hash and password
+// that matched within the TTL.
+func (c *passwordCache) Check(hash, password string) bool {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(hash))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	entry := string(mac.Sum(nil))
+
+	c.mu.Lock()
+	expires, ok := c.expires[entry]
+	c.mu.Unlock()
+	if ok && c.now().Before(expires) {
+		return true
+	}
+
+	if !CheckPassword(hash, password) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.expires) >= maxCachedPasswords {
+		c.expires = make(map[string]time.Time)
+	}
+	c.expires[entry] = c.now().Add(c.ttl)
+	return true
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors for PBKDF2-HMAC-SHA256 from RFC 7914, section 11.
+func TestPBKDF2SHA256Vectors(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		key            string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			key:        "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			key:        "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			key := pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64)
+			assert.Equal(t, tt.key, hex.EncodeToString(key))
+		})
+	}
+}
+
+func TestPasswordCache(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	cache := newPasswordCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	assert.False(t, cache.Check(hash, "wrong password"))
+	assert.Empty(t, cache.expires, "failed checks are not cached")
+
+	assert.True(t, cache.Check(hash, "correct horse battery"))
+	assert.Len(t, cache.expires, 1)
+	for entry := range cache.expires {
+		assert.NotContains(t, entry, "correct horse battery")
+	}
+
+	// A cached entry matches neither another password nor another hash
+	assert.False(t, cache.Check(hash, "correct horse battery!"))
+	other, err := HashPassword("another password")
+	require.NoError(t, err)
+	assert.False(t, cache.Check(other, "correct horse battery"))
+
+	expiries := func() []time.Time {
+		var e []time.Time
+		for _, expires := range cache.expires {
+			e = append(e, expires)
+		}
+		return e
+	}
+
+	// Within the TTL the entry is used as is
+	now = now.Add(30 * time.Second)
+	assert.True(t, cache.Check(hash, "correct horse battery"))
+	assert.Equal(t, []time.Time{now.Add(30 * time.Second)}, expiries())
+
+	// An expired entry is verified and cached again
+	now = now.Add(time.Minute)
+	assert.True(t, cache.Check(hash, "correct horse battery"))
+	assert.Equal(t, []time.Time{now.Add(time.Minute)}, expiries())
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	repo "loan-engine/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	optimisticLockConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loan_service_optimistic_lock_conflicts_total",
+		Help: "Number of loan updates that failed the optimistic lock version check.",
+	}, []string{"operation"})
+
+	optimisticLockExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loan_service_optimistic_lock_retries_exhausted_total",
+		Help: "Number of loan operations that gave up after too many version conflicts.",
+	}, []string{"operation"})
+)
+
+// RetryPolicy bounds how often a loan operation is retried after a version conflict.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles on every further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between two attempts.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by NewLoanService.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    200 * time.Millisecond,
+}
+
+// backoff returns the delay before the given retry (1 for the first retry),
+// with up to 50% random jitter so competing requests spread out.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryOnConflict runs fn until it succeeds, fails with anything other than
+// a version conflict, or the policy runs out of attempts. fn must re-read the
+// loan and re-run the state machine rule on every call.
+func (s *LoanService) retryOnConflict(ctx context.Context, operation string, fn func() error) error {
+	attempts := s.retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = fn()
+		if !errors.Is(err, repo.ErrConcurrentModification) {
+			return err
+		}
+		optimisticLockConflicts.WithLabelValues(operation).Inc()
+		if attempt == attempts {
+			break
+		}
+
+		log.Printf("Version conflict on %s, retrying (attempt %d of %d)", operation, attempt+1, attempts)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.retry.backoff(attempt)):
+		}
+	}
+
+	optimisticLockExhausted.WithLabelValues(operation).Inc()
+	return err
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+)
+
+// UserService manages the users of the API and authenticates their requests.
+type UserService struct {
+	repo repo.UserRepositoryInterface
+
+	// dummyHash is checked for unknown usernames so they take as long to
+	// reject as wrong passwords
+	dummyHashOnce sync.Once
+	dummyHash     string
+
+	passwords *passwordCache
+}
+
+func NewUserService(repo repo.UserRepositoryInterface) *UserService {
+	return &UserService{repo: repo}
+}
+
+// Authenticate returns the active user with the username and password, or
+// model.ErrInvalidCredentials.
+func (s *UserService) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	user, err := s.repo.GetUserByUsername(ctx, username)
+	if errors.Is(err, repo.ErrNotFound) {
+		s.dummyHashOnce.Do(func() {
+			s.dummyHash, _ = HashPassword("not a password")
+		})
+		CheckPassword(s.dummyHash, password)
+		return nil, model.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.checkPassword(user.PasswordHash, password) || !user.Active {
+		return nil, model.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// WithPasswordCache makes Authenticate remember verified passwords for ttl.
+// The user is still read on every request, so deactivating a user or changing
+// their roles or password takes effect immediately.
+// A zero ttl turns the cache off.
+func (s *UserService) WithPasswordCache(ttl time.Duration) *UserService {
+	s.passwords = nil
+	if ttl > 0 {
+		s.passwords = newPasswordCache(ttl)
+	}
+	return s
+}
+
+func (s *UserService) checkPassword(hash, password string) bool {
+	if s.passwords == nil {
+		return CheckPassword(hash, password)
+	}
+	return s.passwords.Check(hash, password)
+}
+
+func (s *UserService) CreateUser(ctx context.Context, r model.CreateUserRequest) (*model.User, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(r.Password)
+	if err != nil {
+		return nil, err
+	}
+	user := model.User{
+		Username:     r.Username,
+		PasswordHash: hash,
+		Roles:        r.Roles,
+		Active:       true,
+	}
+	err = s.repo.CreateUser(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *UserService) ListUsers(ctx context.Context) ([]model.User, error) {
+	return s.repo.ListUsers(ctx)
+}
+
+// UpdateUser changes the password, roles or active flag of the user. Users
+// cannot deactivate themselves or drop their own admin role, so the last
+// admin cannot lock everyone out by accident.
+func (s *UserService) UpdateUser(ctx context.Context, id string, r model.UpdateUserRequest) (*model.User, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	self := id == model.ActorFromContext(ctx)
+	if r.Password != nil {
+		user.PasswordHash, err = HashPassword(*r.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Roles != nil {
+		if self && user.HasRole(model.RoleAdmin) && !hasRole(*r.Roles, model.RoleAdmin) {
+			return nil, fmt.Errorf("%w: you cannot remove your own admin role", model.ErrValidationFailed)
+		}
+		user.Roles = *r.Roles
+	}
+	if r.Active != nil {
+		if self && !*r.Active {
+			return nil, fmt.Errorf("%w: you cannot deactivate yourself", model.ErrValidationFailed)
+		}
+		user.Active = *r.Active
+	}
+
+	err = s.repo.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// EnsureAdmin creates an admin with the username and password while there
+// are no users yet, so a fresh deployment can sign in and create the others.
+func (s *UserService) EnsureAdmin(ctx context.Context, username, password string) error {
+	users, err := s.repo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreateUser(ctx, &model.User{
+		Username:     username,
+		PasswordHash: hash,
+		Roles:        []model.Role{model.RoleAdmin},
+		Active:       true,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Created admin user %q; sign in with it to create the other users", username)
+	return nil
+}
+
+func hasRole(roles []model.Role, role model.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
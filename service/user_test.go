@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"loan-engine/model"
+	"loan-engine/repository"
+	"loan-engine/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := service.HashPassword("correct horse battery")
+	require.NoError(t, err)
+
+	assert.True(t, service.CheckPassword(hash, "correct horse battery"))
+	assert.False(t, service.CheckPassword(hash, "correct horse battery!"))
+	assert.False(t, service.CheckPassword("correct horse battery", "correct horse battery"))
+
+	other, err := service.HashPassword("correct horse battery")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	hash, err := service.HashPassword("validator-password")
+	require.NoError(t, err)
+
+	mockRepo := new(service.MockUserRepository)
+	users := service.NewUserService(mockRepo)
+	mockRepo.On("GetUserByUsername", mock.Anything, "validator").Return(&model.User{
+		ID: "user-1", Username: "validator", PasswordHash: hash, Roles: []model.Role{model.RoleFieldValidator}, Active: true,
+	}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "former").Return(&model.User{
+		ID: "user-2", Username: "former", PasswordHash: hash, Active: false,
+	}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "nobody").Return(nil, repository.ErrUserNotFound)
+	mockRepo.On("GetUserByUsername", mock.Anything, "broken").Return(nil, errors.New("connection refused"))
+
+	user, err := users.Authenticate(ctx, "validator", "validator-password")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+
+	_, err = users.Authenticate(ctx, "validator", "wrong-password")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = users.Authenticate(ctx, "former", "validator-password")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = users.Authenticate(ctx, "nobody", "validator-password")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+
+	_, err = users.Authenticate(ctx, "broken", "validator-password")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, model.ErrInvalidCredentials)
+}
+
+func TestCreateUser(t *testing.T) {
+	mockRepo := new(service.MockUserRepository)
+	users := service.NewUserService(mockRepo)
+	mockRepo.On("CreateUser", mock.Anything, mock.AnythingOfType("*model.User")).Return(nil)
+
+	user, err := users.CreateUser(context.Background(), model.CreateUserRequest{
+		Username: "officer", Password: "officer-password", Roles: []model.Role{model.RoleFieldOfficer},
+	})
+
+	require.NoError(t, err)
+	assert.True(t, user.Active)
+	assert.True(t, service.CheckPassword(user.PasswordHash, "officer-password"))
+
+	_, err = users.CreateUser(context.Background(), model.CreateUserRequest{
+		Username: "officer", Password: "officer-password", Roles: []model.Role{"superuser"},
+	})
+	assert.ErrorIs(t, err, model.ErrValidationFailed)
+	mockRepo.AssertNumberOfCalls(t, "CreateUser", 1)
+}
+
+func TestUpdateUser(t *testing.T) {
+	admin := &model.User{ID: "admin-1", Username: "admin", Roles: []model.Role{model.RoleAdmin}, Active: true}
+	ctx := model.ContextWithUser(context.Background(), admin)
+	inactive := false
+	staffOnly := []model.Role{model.RoleStaff}
+
+	testCases := []struct {
+		name        string
+		id          string
+		request     model.UpdateUserRequest
+		expectError error
+	}{
+		{name: "Change another user's roles", id: "user-2", request: model.UpdateUserRequest{Roles: &staffOnly}},
+		{name: "Deactivate another user", id: "user-2", request: model.UpdateUserRequest{Active: &inactive}},
+		{name: "Drop own admin role", id: "admin-1", request: model.UpdateUserRequest{Roles: &staffOnly}, expectError: model.ErrValidationFailed},
+		{name: "Deactivate self", id: "admin-1", request: model.UpdateUserRequest{Active: &inactive}, expectError: model.ErrValidationFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockUserRepository)
+			users := service.NewUserService(mockRepo)
+			mockRepo.On("GetUser", mock.Anything, "admin-1").Return(&model.User{ID: "admin-1", Roles: []model.Role{model.RoleAdmin}, Active: true}, nil)
+			mockRepo.On("GetUser", mock.Anything, "user-2").Return(&model.User{ID: "user-2", Roles: []model.Role{model.RoleAdmin}, Active: true}, nil)
+			mockRepo.On("UpdateUser", mock.Anything, mock.AnythingOfType("*model.User")).Return(nil)
+
+			_, err := users.UpdateUser(ctx, tc.id, tc.request)
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				mockRepo.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				mockRepo.AssertCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestEnsureAdmin(t *testing.T) {
+	t.Run("Creates the first user", func(t *testing.T) {
+		mockRepo := new(service.MockUserRepository)
+		mockRepo.On("ListUsers", mock.Anything).Return([]model.User{}, nil)
+		mockRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u *model.User) bool {
+			return u.Username == "root" && u.Active && len(u.Roles) == 1 && u.Roles[0] == model.RoleAdmin
+		})).Return(nil)
+
+		err := service.NewUserService(mockRepo).EnsureAdmin(context.Background(), "root", "root-password")
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Leaves existing users alone", func(t *testing.T) {
+		mockRepo := new(service.MockUserRepository)
+		mockRepo.On("ListUsers", mock.Anything).Return([]model.User{{ID: "user-1"}}, nil)
+
+		err := service.NewUserService(mockRepo).EnsureAdmin(context.Background(), "root", "root-password")
+
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"loan-engine/model"
+	repo "loan-engine/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Headers sent with every webhook request.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookDeliveryPageSize bounds the delivery log returned for a subscription.
+const webhookDeliveryPageSize = 100
+
+var webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "loan_service_webhook_deliveries_total",
+	Help: "Webhook delivery attempts by result (delivered, retried, failed).",
+}, []string{"result"})
+
+// WebhookService manages partner subscriptions and delivers loan transitions to them.
+type WebhookService struct {
+	repo   repo.WebhookRepositoryInterface
+	client *http.Client
+	retry  RetryPolicy
+	lease  time.Duration
+}
+
+// NewWebhookService returns a service that posts with client and retries
+// failed deliveries according to retry. lease must exceed the client timeout.
+func NewWebhookService(repo repo.WebhookRepositoryInterface, client *http.Client, retry RetryPolicy, lease time.Duration) *WebhookService {
+	return &WebhookService{repo: repo, client: client, retry: retry, lease: lease}
+}
+
+func (s *WebhookService) CreateSubscription(ctx context.Context, r model.CreateWebhookSubscriptionRequest) (*model.WebhookSubscription, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := r.ToSubscription()
+	err = s.repo.CreateSubscription(ctx, &subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	return s.repo.ListSubscriptions(ctx)
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	return s.repo.DeactivateSubscription(ctx, id)
+}
+
+// ListDeliveries returns the latest deliveries of the subscription, newest first.
+func (s *WebhookService) ListDeliveries(ctx context.Context, subscriptionID string) ([]model.WebhookDelivery, error) {
+	_, err := s.repo.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListDeliveries(ctx, subscriptionID, webhookDeliveryPageSize)
+}
+
+// GetDelivery returns the delivery with its attempt log.
+func (s *WebhookService) GetDelivery(ctx context.Context, subscriptionID, deliveryID string) (*model.WebhookDelivery, error) {
+	return s.repo.GetDelivery(ctx, subscriptionID, deliveryID)
+}
+
+// ReplayDelivery sends the delivery again, even if it already succeeded.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, subscriptionID, deliveryID string) error {
+	return s.repo.ReplayDelivery(ctx, subscriptionID, deliveryID)
+}
+
+// HandleTransition queues a delivery of the transition for every matching
+// subscription. It is registered for model.EventTypeLoanTransitioned.
+func (s *WebhookService) HandleTransition(ctx context.Context, e model.OutboxEvent) error {
+	var transition model.Transition
+	err := json.Unmarshal(e.Payload, &transition)
+	if err != nil {
+		return fmt.Errorf("failed to decode transition of outbox event %d: %w", e.ID, err)
+	}
+
+	subscriptions, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []model.WebhookDelivery
+	for i := range subscriptions {
+		if !subscriptions[i].Matches(transition.Event) {
+			continue
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			SubscriptionID: subscriptions[i].ID,
+			OutboxEventID:  e.ID,
+			LoanID:         transition.LoanID,
+			Event:          transition.Event,
+			Payload:        e.Payload,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return s.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// DeliverPending sends one batch of due deliveries and returns how many were claimed.
+func (s *WebhookService) DeliverPending(ctx context.Context, batchSize int) (int, error) {
+	deliveries, err := s.repo.ClaimDeliveries(ctx, batchSize, s.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		d := &deliveries[i]
+		attempt := s.send(ctx, d)
+
+		var retryIn time.Duration
+		switch {
+		case attempt.Error == "":
+			d.Status = model.WebhookDeliveryDelivered
+			webhookDeliveries.WithLabelValues("delivered").Inc()
+		case d.Attempts >= s.retry.MaxAttempts:
+			d.Status = model.WebhookDeliveryFailed
+			webhookDeliveries.WithLabelValues("failed").Inc()
+			log.Printf("Webhook delivery %s to %s failed after %d attempts: %s", d.ID, d.URL, d.Attempts, attempt.Error)
+		default:
+			d.Status = model.WebhookDeliveryPending
+			retryIn = s.retry.backoff(d.Attempts)
+			webhookDeliveries.WithLabelValues("retried").Inc()
+		}
+
+		err := s.repo.RecordAttempt(ctx, d, attempt, retryIn)
+		if err != nil {
+			log.Printf("Failed to record webhook delivery %s attempt: %v", d.ID, err)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// send posts the signed payload of the delivery. Any 2xx response counts as delivered.
+func (s *WebhookService) send(ctx context.Context, d *model.WebhookDelivery) *model.WebhookDeliveryAttempt {
+	attempt := &model.WebhookDeliveryAttempt{DeliveryID: d.ID}
+	start := time.Now()
+	defer func() {
+		attempt.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	var transition model.Transition
+	err := json.Unmarshal(d.Payload, &transition)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("invalid payload: %v", err)
+		return attempt
+	}
+	body, err := json.Marshal(model.WebhookPayload{
+		DeliveryID: d.ID,
+		Event:      d.Event,
+		LoanID:     d.LoanID,
+		Transition: transition,
+	})
+	if err != nil {
+		attempt.Error = fmt.Sprintf("invalid payload: %v", err)
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(d.Event))
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+model.SignWebhookPayload(d.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return attempt
+}
+
+// Run calls DeliverPending every interval until ctx is cancelled.
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep draining while full batches come back
+			for {
+				n, err := s.DeliverPending(ctx, batchSize)
+				if err != nil {
+					log.Printf("Failed to deliver webhooks: %v", err)
+					break
+				}
+				if n < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
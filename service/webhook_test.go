@@ -0,0 +1,178 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"loan-engine/model"
+	"loan-engine/service"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+func newTestDelivery(t *testing.T, url string, attempts int) model.WebhookDelivery {
+	payload, err := json.Marshal(model.Transition{
+		ID:            42,
+		LoanID:        "loan-123",
+		PreviousState: model.StateProposed,
+		Event:         model.EventApprove,
+		NextState:     model.StateApproved,
+	})
+	assert.NoError(t, err)
+
+	return model.WebhookDelivery{
+		ID:             "delivery-1",
+		SubscriptionID: "subscription-1",
+		LoanID:         "loan-123",
+		Event:          model.EventApprove,
+		Payload:        payload,
+		Status:         model.WebhookDeliveryPending,
+		Attempts:       attempts,
+		URL:            url,
+		Secret:         testWebhookSecret,
+	}
+}
+
+func TestWebhookDeliverPending(t *testing.T) {
+	ctx := context.Background()
+	policy := service.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	testCases := []struct {
+		name         string
+		status       int
+		attempts     int
+		expectStatus model.WebhookDeliveryStatus
+		expectRetry  bool
+	}{
+		{name: "Delivered on 2xx", status: http.StatusNoContent, attempts: 1, expectStatus: model.WebhookDeliveryDelivered},
+		{name: "Retried on 5xx", status: http.StatusInternalServerError, attempts: 1, expectStatus: model.WebhookDeliveryPending, expectRetry: true},
+		{name: "Failed after last attempt", status: http.StatusBadGateway, attempts: 3, expectStatus: model.WebhookDeliveryFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received model.WebhookPayload
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+
+				timestamp, err := strconv.ParseInt(r.Header.Get(service.WebhookTimestampHeader), 10, 64)
+				assert.NoError(t, err)
+				signature := strings.TrimPrefix(r.Header.Get(service.WebhookSignatureHeader), "sha256=")
+				assert.NoError(t, model.VerifyWebhookSignature(testWebhookSecret, timestamp, body, signature))
+				assert.Equal(t, "approve", r.Header.Get(service.WebhookEventHeader))
+				assert.Equal(t, "delivery-1", r.Header.Get(service.WebhookDeliveryHeader))
+				assert.NoError(t, json.Unmarshal(body, &received))
+
+				w.WriteHeader(tc.status)
+			}))
+			defer receiver.Close()
+
+			mockRepo := new(service.MockWebhookRepository)
+			webhooks := service.NewWebhookService(mockRepo, receiver.Client(), policy, time.Minute)
+
+			mockRepo.On("ClaimDeliveries", mock.Anything, 10, time.Minute).Return([]model.WebhookDelivery{newTestDelivery(t, receiver.URL, tc.attempts)}, nil)
+			mockRepo.On("RecordAttempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			n, err := webhooks.DeliverPending(ctx, 10)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			assert.Equal(t, "delivery-1", received.DeliveryID)
+			assert.Equal(t, int64(42), received.Transition.ID)
+			assert.Equal(t, model.StateApproved, received.Transition.NextState)
+
+			mockRepo.AssertCalled(t, "RecordAttempt", mock.Anything,
+				mock.MatchedBy(func(d *model.WebhookDelivery) bool { return d.Status == tc.expectStatus }),
+				mock.MatchedBy(func(a *model.WebhookDeliveryAttempt) bool {
+					return a.StatusCode == tc.status && (a.Error == "") == (tc.expectStatus == model.WebhookDeliveryDelivered)
+				}),
+				mock.MatchedBy(func(retryIn time.Duration) bool { return (retryIn > 0) == tc.expectRetry }),
+			)
+		})
+	}
+}
+
+func TestWebhookDeliverPendingUnreachableReceiver(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	mockRepo := new(service.MockWebhookRepository)
+	webhooks := service.NewWebhookService(mockRepo, &http.Client{Timeout: time.Second}, service.RetryPolicy{MaxAttempts: 3}, time.Minute)
+
+	mockRepo.On("ClaimDeliveries", mock.Anything, 10, time.Minute).Return([]model.WebhookDelivery{newTestDelivery(t, url, 1)}, nil)
+	mockRepo.On("RecordAttempt", mock.Anything,
+		mock.MatchedBy(func(d *model.WebhookDelivery) bool { return d.Status == model.WebhookDeliveryPending }),
+		mock.MatchedBy(func(a *model.WebhookDeliveryAttempt) bool { return a.StatusCode == 0 && a.Error != "" }),
+		mock.Anything,
+	).Return(nil)
+
+	_, err := webhooks.DeliverPending(context.Background(), 10)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookHandleTransition(t *testing.T) {
+	mockRepo := new(service.MockWebhookRepository)
+	webhooks := service.NewWebhookService(mockRepo, http.DefaultClient, service.DefaultRetryPolicy, time.Minute)
+
+	mockRepo.On("ListSubscriptions", mock.Anything).Return([]model.WebhookSubscription{
+		{ID: "all-events", Active: true},
+		{ID: "approvals", Active: true, Events: []model.LoanEvent{model.EventApprove}},
+		{ID: "disbursements", Active: true, Events: []model.LoanEvent{model.EventDisburseFunds}},
+		{ID: "inactive", Active: false},
+	}, nil)
+	mockRepo.On("CreateDeliveries", mock.Anything, mock.Anything).Return(nil)
+
+	payload, _ := json.Marshal(model.Transition{LoanID: "loan-123", Event: model.EventApprove})
+	err := webhooks.HandleTransition(context.Background(), model.OutboxEvent{ID: 9, EventType: model.EventTypeLoanTransitioned, Payload: payload})
+
+	assert.NoError(t, err)
+	mockRepo.AssertCalled(t, "CreateDeliveries", mock.Anything, mock.MatchedBy(func(deliveries []model.WebhookDelivery) bool {
+		return len(deliveries) == 2 &&
+			deliveries[0].SubscriptionID == "all-events" && deliveries[1].SubscriptionID == "approvals" &&
+			deliveries[0].OutboxEventID == 9 && deliveries[0].LoanID == "loan-123"
+	}))
+}
+
+func TestWebhookCreateSubscriptionValidation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		request     model.CreateWebhookSubscriptionRequest
+		expectError bool
+	}{
+		{name: "Valid", request: model.CreateWebhookSubscriptionRequest{URL: "https://partner.example.com/hooks", Secret: testWebhookSecret, Events: []model.LoanEvent{model.EventApprove}}},
+		{name: "Relative URL", request: model.CreateWebhookSubscriptionRequest{URL: "/hooks", Secret: testWebhookSecret}, expectError: true},
+		{name: "Short secret", request: model.CreateWebhookSubscriptionRequest{URL: "https://partner.example.com/hooks", Secret: "short"}, expectError: true},
+		{name: "Unknown event", request: model.CreateWebhookSubscriptionRequest{URL: "https://partner.example.com/hooks", Secret: testWebhookSecret, Events: []model.LoanEvent{"funded"}}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(service.MockWebhookRepository)
+			webhooks := service.NewWebhookService(mockRepo, http.DefaultClient, service.DefaultRetryPolicy, time.Minute)
+			mockRepo.On("CreateSubscription", mock.Anything, mock.AnythingOfType("*model.WebhookSubscription")).Return(nil)
+
+			subscription, err := webhooks.CreateSubscription(context.Background(), tc.request)
+
+			if tc.expectError {
+				assert.ErrorIs(t, err, model.ErrValidationFailed)
+				mockRepo.AssertNotCalled(t, "CreateSubscription", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, subscription.Active)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package storage keeps generated documents such as loan agreements.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrObjectNotFound is returned when no document is stored under the key.
+var ErrObjectNotFound = errors.New("document object not found")
+
+// DocumentStore stores documents under slash-separated keys such as
+// "loans/<loan id>/loan_agreement.pdf". Putting an existing key replaces it.
+type DocumentStore interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// URL returns a link a client can download the document from.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// validKey rejects empty keys and keys escaping the store root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"loan-engine/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an in-memory stand-in for an S3-compatible service using path-style addressing.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	s := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			sum := sha256.Sum256(body)
+			if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+				http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+				return
+			}
+			s.objects[r.URL.Path] = body
+			s.types[r.URL.Path] = r.Header.Get("Content-Type")
+		case http.MethodGet:
+			body, ok := s.objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", s.types[r.URL.Path])
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestDocumentStores(t *testing.T) {
+	ctx := context.Background()
+
+	server := newFakeS3(t)
+	defer server.Close()
+	s3Store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "documents",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		PathStyle:       true,
+		PresignTTL:      time.Hour,
+	}, server.Client())
+	assert.NoError(t, err)
+
+	localStore, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	stores := map[string]storage.DocumentStore{"local": localStore, "s3": s3Store}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			key := "loans/loan-123/loan_agreement.pdf"
+
+			_, err := store.Get(ctx, key)
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+
+			assert.NoError(t, store.Put(ctx, key, []byte("first"), "application/pdf"))
+			assert.NoError(t, store.Put(ctx, key, []byte("%PDF-1.3 agreement"), "application/pdf"))
+
+			body, err := store.Get(ctx, key)
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(body)
+			body.Close()
+			assert.Equal(t, "%PDF-1.3 agreement", string(data))
+
+			link, err := store.URL(ctx, key)
+			assert.NoError(t, err)
+			assert.Contains(t, link, "loans/loan-123/loan_agreement.pdf")
+
+			assert.Error(t, store.Put(ctx, "../escape.pdf", []byte("x"), "application/pdf"))
+		})
+	}
+}
+
+func TestS3StorePresignedURL(t *testing.T) {
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:        "http://localhost:9000",
+		Region:          "us-east-1",
+		Bucket:          "documents",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		PathStyle:       true,
+		PresignTTL:      15 * time.Minute,
+	}, http.DefaultClient)
+	assert.NoError(t, err)
+
+	link, err := store.URL(context.Background(), "loans/loan-123/loan_agreement.pdf")
+	assert.NoError(t, err)
+
+	u, err := url.Parse(link)
+	assert.NoError(t, err)
+	assert.Equal(t, "/documents/loans/loan-123/loan_agreement.pdf", u.Path)
+	assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "host", u.Query().Get("X-Amz-SignedHeaders"))
+	assert.Len(t, u.Query().Get("X-Amz-Signature"), 64)
+}